@@ -0,0 +1,47 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// foo-bench runs the controller against fake clientsets seeded with Foos, and
+// reports how fast it syncs them and how much memory it uses.
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/sample-controller/pkg/benchmark"
+)
+
+func main() {
+	var cfg benchmark.Config
+	flag.IntVar(&cfg.Foos, "foos", 1000, "Number of Foos to seed the clientsets with.")
+	flag.IntVar(&cfg.Workers, "workers", 2, "Number of workers the controller runs.")
+	flag.IntVar(&cfg.Scale, "scale", 100, "Number of Foos to scale once they are all synced, or 0 to skip the scale phase.")
+	flag.DurationVar(&cfg.Timeout, "timeout", 5*time.Minute, "How long each phase may take.")
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	result, err := benchmark.Run(cfg)
+	if err != nil {
+		klog.Fatalf("Error running benchmark: %s", err.Error())
+	}
+	if err := result.WriteReport(os.Stdout); err != nil {
+		klog.Fatalf("Error writing report: %s", err.Error())
+	}
+}
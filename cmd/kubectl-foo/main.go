@@ -0,0 +1,159 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-foo is a kubectl plugin for inspecting and operating Foo
+// resources. Installed on the PATH, it is run as `kubectl foo`.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+)
+
+// options holds what every command needs: the clients, where to look for
+// Foos and how to print what it finds.
+type options struct {
+	kubeclientset   kubernetes.Interface
+	sampleclientset clientset.Interface
+
+	namespace     string
+	allNamespaces bool
+	output        string
+
+	out io.Writer
+}
+
+// command is a subcommand of the plugin. flags registers the flags specific to
+// the command, and run is called with the remaining positional arguments.
+type command struct {
+	name  string
+	usage string
+	short string
+	flags func(fs *pflag.FlagSet)
+	run   func(o *options, args []string) error
+}
+
+func commands() []*command {
+	return []*command{
+		newStatusCommand(),
+		newTreeCommand(),
+		newPauseCommand(),
+		newResumeCommand(),
+		newScaleCommand(),
+		newRollbackCommand(),
+		newWaitCommand(),
+	}
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out, errOut io.Writer) error {
+	cmds := commands()
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(errOut, cmds)
+		return nil
+	}
+	var cmd *command
+	for _, c := range cmds {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		usage(errOut, cmds)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	o := &options{out: out}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+
+	fs := pflag.NewFlagSet("kubectl foo "+cmd.name, pflag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	fs.StringVar(&overrides.CurrentContext, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVarP(&overrides.Context.Namespace, "namespace", "n", "", "The namespace of the Foos. Defaults to the namespace of the current context.")
+	fs.BoolVarP(&o.allNamespaces, "all-namespaces", "A", false, "List Foos across all namespaces.")
+	fs.StringVarP(&o.output, "output", "o", "table", "Output format. One of: table, json, yaml.")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(errOut, "%s\n\nUsage:\n  kubectl foo %s\n\nFlags:\n%s", cmd.short, cmd.usage, fs.FlagUsages())
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == pflag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	switch o.output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of table, json or yaml", o.output)
+	}
+
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return err
+	}
+	o.namespace = namespace
+	cfg, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	if o.kubeclientset, err = kubernetes.NewForConfig(cfg); err != nil {
+		return err
+	}
+	if o.sampleclientset, err = clientset.NewForConfig(cfg); err != nil {
+		return err
+	}
+	return cmd.run(o, fs.Args())
+}
+
+func usage(w io.Writer, cmds []*command) {
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].name < cmds[j].name })
+	fmt.Fprintf(w, "Inspect and operate Foo resources.\n\nUsage:\n  kubectl foo COMMAND [flags]\n\nCommands:\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(w, "\nRun 'kubectl foo COMMAND --help' for the flags of a command.\n")
+}
+
+// singleName returns the one Foo name a command operates on.
+func (o *options) singleName(args []string) (string, error) {
+	if o.allNamespaces {
+		return "", fmt.Errorf("--all-namespaces cannot be used with a named Foo")
+	}
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one Foo name is required")
+	}
+	return args[0], nil
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
+)
+
+var created = metav1.NewTime(time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC))
+
+func newFoo(name, image string) *samplev1alpha1.Foo {
+	replicas := int32(2)
+	return &samplev1alpha1.Foo{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault, UID: types.UID(name + "-uid")},
+		Spec: samplev1alpha1.FooSpec{
+			DeploymentName: name + "-deployment",
+			Replicas:       &replicas,
+			Image:          image,
+		},
+		Status: samplev1alpha1.FooStatus{
+			AvailableReplicas: 2,
+			DeploymentName:    name + "-deployment",
+		},
+	}
+}
+
+func controllerRef(owner metav1.Object, kind string) []metav1.OwnerReference {
+	isController := true
+	return []metav1.OwnerReference{{Kind: kind, Name: owner.GetName(), UID: owner.GetUID(), Controller: &isController}}
+}
+
+func newDeployment(foo *samplev1alpha1.Foo, name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       foo.Namespace,
+			UID:             types.UID(name + "-uid"),
+			OwnerReferences: controllerRef(foo, "Foo"),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: foo.Spec.Replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: foo.Spec.Image}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			Replicas:          2,
+			UpdatedReplicas:   2,
+			ReadyReplicas:     2,
+			AvailableReplicas: 2,
+		},
+	}
+}
+
+func newReplicaSet(d *appsv1.Deployment, name, image string, age time.Duration) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         d.Namespace,
+			UID:               types.UID(name + "-uid"),
+			OwnerReferences:   controllerRef(d, "Deployment"),
+			CreationTimestamp: metav1.NewTime(created.Add(-age)),
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: image}}},
+			},
+		},
+	}
+}
+
+func newPod(rs *appsv1.ReplicaSet, name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       rs.Namespace,
+			OwnerReferences: controllerRef(rs, "ReplicaSet"),
+		},
+		Spec:   rs.Spec.Template.Spec,
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func newOptions(output string, foos []runtime.Object, objects ...runtime.Object) (*options, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &options{
+		kubeclientset:   k8sfake.NewSimpleClientset(objects...),
+		sampleclientset: fake.NewSimpleClientset(foos...),
+		namespace:       metav1.NamespaceDefault,
+		output:          output,
+		out:             out,
+	}, out
+}
+
+func TestStatus(t *testing.T) {
+	foo := newFoo("test", "nginx:1.21")
+	d := newDeployment(foo, "test-deployment")
+	rs := newReplicaSet(d, "test-deployment-abc", "nginx:1.21", 0)
+	other := newPod(newReplicaSet(newDeployment(newFoo("other", ""), "other-deployment"), "other-rs", "nginx", 0), "other-pod")
+	o, out := newOptions("table", []runtime.Object{foo}, d, rs, newPod(rs, "test-pod-1"), newPod(rs, "test-pod-2"), other)
+
+	if err := o.fooStatus("test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"test-deployment", "nginx:1.21", "test-pod-1", "test-pod-2", "Running"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out.String(), "other-pod") {
+		t.Errorf("expected pods of other Foos to be left out, got:\n%s", out)
+	}
+
+	o.output = "json"
+	out.Reset()
+	if err := o.fooStatus("test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var list struct {
+		Kind  string `json:"kind"`
+		Items []struct {
+			Kind string `json:"kind"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatalf("error decoding output: %v\n%s", err, out)
+	}
+	var kinds []string
+	for _, item := range list.Items {
+		kinds = append(kinds, item.Kind)
+	}
+	if got, want := strings.Join(kinds, ","), "Foo,Deployment,Pod,Pod"; list.Kind != "List" || got != want {
+		t.Errorf("expected a List of %s, got a %s of %s", want, list.Kind, got)
+	}
+}
+
+func TestTree(t *testing.T) {
+	foo := newFoo("test", "")
+	d := newDeployment(foo, "test-deployment")
+	rs := newReplicaSet(d, "test-deployment-abc", "nginx", 0)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: foo.Namespace, OwnerReferences: controllerRef(foo, "Foo")}}
+	o, out := newOptions("table", []runtime.Object{foo}, d, rs, newPod(rs, "test-pod"), svc)
+
+	if err := newTreeCommand().run(o, []string{"test"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"Foo/test",
+		"├─Deployment/test-deployment",
+		"│ └─ReplicaSet/test-deployment-abc",
+		"│   └─Pod/test-pod",
+		"└─Service/test",
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got:\n%s", len(expected), out)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], line)
+		}
+	}
+}
+
+func TestStatusByDeployment(t *testing.T) {
+	shared := newFoo("shared", "")
+	shared.Spec.DeploymentName = "web"
+	o, out := newOptions("table", []runtime.Object{newFoo("test", ""), shared, newFoo("web", "")})
+
+	status := newStatusCommand()
+	fs := pflag.NewFlagSet("status", pflag.ContinueOnError)
+	status.flags(fs)
+	if err := fs.Parse([]string{"--deployment=web"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := status.run(o, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "shared ") {
+		t.Errorf("expected only foo shared to be listed, got:\n%s", out)
+	}
+	if err := status.run(o, []string{"test"}); err == nil {
+		t.Errorf("expected --deployment with a named Foo to fail")
+	}
+}
+
+func TestPauseAndScale(t *testing.T) {
+	foo := newFoo("test", "")
+	o, out := newOptions("table", []runtime.Object{foo})
+
+	if err := newPauseCommand().run(o, []string{"test"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scale := newScaleCommand()
+	fs := pflag.NewFlagSet("scale", pflag.ContinueOnError)
+	scale.flags(fs)
+	if err := scale.run(o, []string{"test"}); err == nil {
+		t.Errorf("expected scale without --replicas to fail")
+	}
+	for _, replicas := range []string{"0", "11"} {
+		if err := fs.Parse([]string{"--replicas=" + replicas}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := scale.run(o, []string{"test"}); err == nil {
+			t.Errorf("expected scale to %s replicas to fail", replicas)
+		}
+	}
+	if err := fs.Parse([]string{"--replicas=5"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := scale.run(o, []string{"test"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := run([]string{"scale", "test", "--replicas=5", "-o", "xml"}, out, out); err == nil {
+		t.Errorf("expected an unsupported output format to fail")
+	}
+
+	got, err := o.getFoo("test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Spec.Paused || *got.Spec.Replicas != 5 {
+		t.Errorf("expected foo to be paused with 5 replicas, got paused=%t replicas=%d", got.Spec.Paused, *got.Spec.Replicas)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	foo := newFoo("test", "nginx:1.22")
+	d := newDeployment(foo, "test-deployment")
+	o, out := newOptions("table", []runtime.Object{foo}, d,
+		newReplicaSet(d, "rs-1", "nginx:1.20", 2*time.Hour),
+		newReplicaSet(d, "rs-2", "nginx:1.21", time.Hour),
+		newReplicaSet(d, "rs-3", "nginx:1.22", 0),
+	)
+
+	if err := newRollbackCommand().run(o, []string{"test"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := o.sampleclientset.SamplecontrollerV1alpha1().Foos(metav1.NamespaceDefault).Get(context.TODO(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Spec.Image != "nginx:1.21" {
+		t.Errorf("expected rollback to nginx:1.21, got %s\n%s", got.Spec.Image, out)
+	}
+}
+
+func TestFooReady(t *testing.T) {
+	ready := newFoo("test", "")
+	canary := newFoo("test", "")
+	canary.Status.Canary = &samplev1alpha1.CanaryStatus{Phase: samplev1alpha1.CanaryPhasePaused}
+	renamed := newFoo("test", "")
+	renamed.Spec.DeploymentName = "renamed"
+	blueGreen := newFoo("test", "")
+	blueGreen.Spec.Strategy = &samplev1alpha1.FooStrategy{BlueGreen: &samplev1alpha1.BlueGreenStrategy{}}
+	blueGreen.Status.BlueGreen = &samplev1alpha1.BlueGreenStatus{ActiveColor: samplev1alpha1.ColorGreen}
+
+	complete := newDeployment(ready, "test-deployment")
+	progressing := newDeployment(ready, "test-deployment")
+	progressing.Status.UpdatedReplicas = 1
+	stale := newDeployment(ready, "test-deployment")
+	stale.Generation = 2
+	green := newDeployment(ready, "test-deployment-green")
+
+	tests := []struct {
+		name       string
+		foo        *samplev1alpha1.Foo
+		deployment *appsv1.Deployment
+		expected   bool
+	}{
+		{"complete", ready, complete, true},
+		{"progressing", ready, progressing, false},
+		{"not observed", ready, stale, false},
+		{"canary in progress", canary, complete, false},
+		{"rename pending", renamed, complete, false},
+		{"missing deployment", ready, green, false},
+		{"blue/green active color", blueGreen, green, true},
+	}
+	for _, test := range tests {
+		got, reason := fooReady(test.foo, &ownedObjects{deployments: []*appsv1.Deployment{test.deployment}})
+		if got != test.expected {
+			t.Errorf("%s: expected ready=%t, got %t (%s)", test.name, test.expected, got, reason)
+		}
+	}
+}
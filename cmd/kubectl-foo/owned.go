@@ -0,0 +1,149 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// ownedObjects are the objects making up a Foo, found by following
+// controller references down from it.
+type ownedObjects struct {
+	deployments []*appsv1.Deployment
+	services    []*corev1.Service
+	// replicaSets and pods are keyed by the UID of their controller.
+	replicaSets map[types.UID][]*appsv1.ReplicaSet
+	pods        map[types.UID][]*corev1.Pod
+}
+
+func (o *options) getFoo(name string) (*samplev1alpha1.Foo, error) {
+	return o.sampleclientset.SamplecontrollerV1alpha1().Foos(o.namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// ownedObjects lists the Deployments and Services controlled by a Foo, the
+// ReplicaSets of those Deployments and the Pods of those ReplicaSets.
+func (o *options) ownedObjects(foo *samplev1alpha1.Foo) (*ownedObjects, error) {
+	owned := &ownedObjects{
+		replicaSets: map[types.UID][]*appsv1.ReplicaSet{},
+		pods:        map[types.UID][]*corev1.Pod{},
+	}
+	ctx := context.TODO()
+
+	deployments, err := o.kubeclientset.AppsV1().Deployments(foo.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing deployments: %v", err)
+	}
+	for i := range deployments.Items {
+		if d := &deployments.Items[i]; metav1.IsControlledBy(d, foo) {
+			owned.deployments = append(owned.deployments, d)
+		}
+	}
+	services, err := o.kubeclientset.CoreV1().Services(foo.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing services: %v", err)
+	}
+	for i := range services.Items {
+		if s := &services.Items[i]; metav1.IsControlledBy(s, foo) {
+			owned.services = append(owned.services, s)
+		}
+	}
+	if len(owned.deployments) == 0 {
+		return owned, nil
+	}
+
+	controlled := map[types.UID]bool{}
+	for _, d := range owned.deployments {
+		controlled[d.UID] = true
+	}
+	replicaSets, err := o.kubeclientset.AppsV1().ReplicaSets(foo.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing replicasets: %v", err)
+	}
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if ref := metav1.GetControllerOf(rs); ref != nil && controlled[ref.UID] {
+			owned.replicaSets[ref.UID] = append(owned.replicaSets[ref.UID], rs)
+			controlled[rs.UID] = true
+		}
+	}
+	pods, err := o.kubeclientset.CoreV1().Pods(foo.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods: %v", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if ref := metav1.GetControllerOf(pod); ref != nil && controlled[ref.UID] {
+			owned.pods[ref.UID] = append(owned.pods[ref.UID], pod)
+		}
+	}
+	for _, rss := range owned.replicaSets {
+		sort.Slice(rss, func(i, j int) bool { return rss[i].Name < rss[j].Name })
+	}
+	for _, pods := range owned.pods {
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	}
+	return owned, nil
+}
+
+// allPods returns the Pods of every ReplicaSet of every Deployment.
+func (owned *ownedObjects) allPods() []*corev1.Pod {
+	var pods []*corev1.Pod
+	for _, d := range owned.deployments {
+		for _, rs := range owned.replicaSets[d.UID] {
+			pods = append(pods, owned.pods[rs.UID]...)
+		}
+	}
+	return pods
+}
+
+// primaryDeploymentName returns the name of the Deployment serving the stable
+// pod template of a Foo. Blue/green Foos run one Deployment per color, named
+// the same way the controller names them.
+func primaryDeploymentName(foo *samplev1alpha1.Foo) string {
+	name := foo.Status.DeploymentName
+	if name == "" {
+		name = foo.Spec.DeploymentName
+	}
+	if foo.Spec.Strategy != nil && foo.Spec.Strategy.BlueGreen != nil {
+		color := samplev1alpha1.ColorBlue
+		if foo.Status.BlueGreen != nil && foo.Status.BlueGreen.ActiveColor != "" {
+			color = foo.Status.BlueGreen.ActiveColor
+		}
+		name = fmt.Sprintf("%s-%s", name, color)
+	}
+	return name
+}
+
+func strategyName(foo *samplev1alpha1.Foo) string {
+	switch {
+	case foo.Spec.Strategy != nil && foo.Spec.Strategy.Canary != nil:
+		return "Canary"
+	case foo.Spec.Strategy != nil && foo.Spec.Strategy.BlueGreen != nil:
+		return "BlueGreen"
+	default:
+		return "Default"
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	samplescheme "k8s.io/sample-controller/pkg/generated/clientset/versioned/scheme"
+)
+
+func init() {
+	// Objects returned by the typed clients have no kind set; registering
+	// the Foo types lets printObjects fill it in for them as well.
+	samplescheme.AddToScheme(scheme.Scheme)
+}
+
+// printObjects writes objects as JSON or YAML. A single object is written as
+// is, several are wrapped in a List the way kubectl does.
+func (o *options) printObjects(objs ...runtime.Object) error {
+	for _, obj := range objs {
+		if err := setKind(obj); err != nil {
+			return err
+		}
+	}
+	var v interface{}
+	if len(objs) == 1 {
+		v = objs[0]
+	} else {
+		list := &metav1.List{TypeMeta: metav1.TypeMeta{Kind: "List", APIVersion: "v1"}}
+		for _, obj := range objs {
+			list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+		}
+		v = list
+	}
+	return o.print(v)
+}
+
+// print writes any value as JSON or YAML, depending on the output format.
+func (o *options) print(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	if o.output == "yaml" {
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			return err
+		}
+		_, err = o.out.Write(data)
+		return err
+	}
+	_, err = fmt.Fprintf(o.out, "%s\n", data)
+	return err
+}
+
+func setKind(obj runtime.Object) error {
+	if !obj.GetObjectKind().GroupVersionKind().Empty() {
+		return nil
+	}
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	return nil
+}
+
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+}
+
+// age formats the time since t the way kubectl get does.
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
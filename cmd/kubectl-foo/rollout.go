@@ -0,0 +1,171 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func newPauseCommand() *command {
+	return &command{
+		name:  "pause",
+		usage: "pause NAME [-n NAMESPACE]",
+		short: "Stop the controller from changing a Foo and its objects",
+		run: func(o *options, args []string) error {
+			return o.setPaused(args, true)
+		},
+	}
+}
+
+func newResumeCommand() *command {
+	return &command{
+		name:  "resume",
+		usage: "resume NAME [-n NAMESPACE]",
+		short: "Let the controller sync a paused Foo again",
+		run: func(o *options, args []string) error {
+			return o.setPaused(args, false)
+		},
+	}
+}
+
+func (o *options) setPaused(args []string, paused bool) error {
+	name, err := o.singleName(args)
+	if err != nil {
+		return err
+	}
+	if err := o.patchSpec(name, map[string]interface{}{"paused": paused}); err != nil {
+		return err
+	}
+	verb := "paused"
+	if !paused {
+		verb = "resumed"
+	}
+	fmt.Fprintf(o.out, "foo.samplecontroller.k8s.io/%s %s\n", name, verb)
+	return nil
+}
+
+// minReplicas and maxReplicas are the bounds the CRD schema sets on
+// spec.replicas, checked here so that scale reports them plainly rather than
+// as a validation error from the apiserver.
+const (
+	minReplicas = 1
+	maxReplicas = 10
+)
+
+func newScaleCommand() *command {
+	var replicas int32
+	return &command{
+		name:  "scale",
+		usage: "scale NAME --replicas=COUNT [-n NAMESPACE]",
+		short: "Set the number of replicas of a Foo",
+		flags: func(fs *pflag.FlagSet) {
+			fs.Int32Var(&replicas, "replicas", -1, "The new number of replicas. Required.")
+		},
+		run: func(o *options, args []string) error {
+			name, err := o.singleName(args)
+			if err != nil {
+				return err
+			}
+			if replicas < minReplicas || replicas > maxReplicas {
+				return fmt.Errorf("--replicas must be set to a number between %d and %d", minReplicas, maxReplicas)
+			}
+			if err := o.patchSpec(name, map[string]interface{}{"replicas": replicas}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "foo.samplecontroller.k8s.io/%s scaled\n", name)
+			return nil
+		},
+	}
+}
+
+func newRollbackCommand() *command {
+	return &command{
+		name:  "rollback",
+		usage: "rollback NAME [-n NAMESPACE]",
+		short: "Return a Foo to the image it ran before the current one",
+		run: func(o *options, args []string) error {
+			name, err := o.singleName(args)
+			if err != nil {
+				return err
+			}
+			foo, err := o.getFoo(name)
+			if err != nil {
+				return err
+			}
+			owned, err := o.ownedObjects(foo)
+			if err != nil {
+				return err
+			}
+			image, err := previousImage(foo, owned)
+			if err != nil {
+				return err
+			}
+			if err := o.patchSpec(name, map[string]interface{}{"image": image}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "foo.samplecontroller.k8s.io/%s rolled back to %s\n", name, image)
+			return nil
+		},
+	}
+}
+
+// previousImage finds the image a Foo ran before its current one. Every
+// Deployment of the Foo keeps the pod templates it ran as ReplicaSets, so the
+// newest ReplicaSet running a different image holds the previous one. Looking
+// at all of them rather than at a single Deployment covers the canary and
+// blue/green strategies, which spread templates over several Deployments.
+func previousImage(foo *samplev1alpha1.Foo, owned *ownedObjects) (string, error) {
+	current := foo.Spec.Image
+	if current == "" {
+		current = samplev1alpha1.DefaultImage
+	}
+	var replicaSets []*appsv1.ReplicaSet
+	for _, d := range owned.deployments {
+		replicaSets = append(replicaSets, owned.replicaSets[d.UID]...)
+	}
+	sort.SliceStable(replicaSets, func(i, j int) bool {
+		return replicaSets[j].CreationTimestamp.Before(&replicaSets[i].CreationTimestamp)
+	})
+	for _, rs := range replicaSets {
+		for _, c := range rs.Spec.Template.Spec.Containers {
+			if c.Image != current {
+				return c.Image, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no previous image found for foo %q", foo.Name)
+}
+
+// patchSpec applies a JSON merge patch to the spec of the named Foo.
+func (o *options) patchSpec(name string, spec map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{"spec": spec})
+	if err != nil {
+		return err
+	}
+	_, err = o.sampleclientset.SamplecontrollerV1alpha1().Foos(o.namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	listers "k8s.io/sample-controller/pkg/generated/listers/samplecontroller/v1alpha1"
+)
+
+func newStatusCommand() *command {
+	var deployment string
+	return &command{
+		name:  "status",
+		usage: "status [NAME | --deployment=NAME] [-n NAMESPACE | -A] [-o table|json|yaml]",
+		short: "Show a Foo together with its Deployments and Pods, or list Foos",
+		flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&deployment, "deployment", "", "List only the Foos that want a Deployment of this name.")
+		},
+		run: func(o *options, args []string) error {
+			if len(args) == 0 {
+				return o.listFoos(deployment)
+			}
+			if deployment != "" {
+				return fmt.Errorf("--deployment cannot be used with a named Foo")
+			}
+			name, err := o.singleName(args)
+			if err != nil {
+				return err
+			}
+			return o.fooStatus(name)
+		},
+	}
+}
+
+// listFoos lists the Foos of the namespace, or only those that want the
+// named Deployment unless deployment is empty.
+func (o *options) listFoos(deployment string) error {
+	namespace := o.namespace
+	if o.allNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+	foos, err := o.sampleclientset.SamplecontrollerV1alpha1().Foos(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if deployment != "" {
+		if foos.Items, err = foosByDeploymentName(foos.Items, namespace, deployment); err != nil {
+			return err
+		}
+	}
+	if o.output != "table" {
+		foos.SetGroupVersionKind(samplev1alpha1.SchemeGroupVersion.WithKind("FooList"))
+		for i := range foos.Items {
+			if err := setKind(&foos.Items[i]); err != nil {
+				return err
+			}
+		}
+		return o.print(foos)
+	}
+
+	w := newTabWriter(o.out)
+	if o.allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tDEPLOYMENT\tDESIRED\tAVAILABLE\tSTRATEGY\tPAUSED\tAGE")
+	for i := range foos.Items {
+		foo := &foos.Items[i]
+		if o.allNamespaces {
+			fmt.Fprintf(w, "%s\t", foo.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%t\t%s\n", foo.Name, foo.Spec.DeploymentName,
+			replicasString(foo.Spec.Replicas), foo.Status.AvailableReplicas, strategyName(foo), foo.Spec.Paused, age(foo.CreationTimestamp))
+	}
+	return w.Flush()
+}
+
+func (o *options) fooStatus(name string) error {
+	foo, err := o.getFoo(name)
+	if err != nil {
+		return err
+	}
+	owned, err := o.ownedObjects(foo)
+	if err != nil {
+		return err
+	}
+	pods := owned.allPods()
+
+	if o.output != "table" {
+		objs := []runtime.Object{foo}
+		for _, d := range owned.deployments {
+			objs = append(objs, d)
+		}
+		for _, pod := range pods {
+			objs = append(objs, pod)
+		}
+		return o.printObjects(objs...)
+	}
+
+	w := newTabWriter(o.out)
+	fmt.Fprintf(w, "Name:\t%s\n", foo.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", foo.Namespace)
+	fmt.Fprintf(w, "Deployment:\t%s\n", foo.Spec.DeploymentName)
+	fmt.Fprintf(w, "Strategy:\t%s\n", strategyName(foo))
+	fmt.Fprintf(w, "Paused:\t%t\n", foo.Spec.Paused)
+	fmt.Fprintf(w, "Replicas:\t%s desired | %d available\n", replicasString(foo.Spec.Replicas), foo.Status.AvailableReplicas)
+	if foo.Status.ActiveSchedule != "" {
+		fmt.Fprintf(w, "Active schedule:\t%s\n", foo.Status.ActiveSchedule)
+	}
+	if canary := foo.Status.Canary; canary != nil {
+		fmt.Fprintf(w, "Canary:\tstep %d, %s (%d stable, %d canary)\n", canary.CurrentStepIndex, canary.Phase, canary.StableReplicas, canary.CanaryReplicas)
+	}
+	if bg := foo.Status.BlueGreen; bg != nil {
+		fmt.Fprintf(w, "Active color:\t%s\n", bg.ActiveColor)
+		if bg.PreviewColor != "" {
+			fmt.Fprintf(w, "Preview color:\t%s\n", bg.PreviewColor)
+		}
+	}
+
+	if len(foo.Status.Conditions) > 0 {
+		fmt.Fprintln(w, "\nConditions:")
+		fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tMESSAGE")
+		for _, c := range foo.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", c.Type, c.Status, c.Reason, c.Message)
+		}
+	}
+
+	fmt.Fprintln(w, "\nDeployments:")
+	if len(owned.deployments) == 0 {
+		fmt.Fprintln(w, "  <none>")
+	} else {
+		fmt.Fprintln(w, "  NAME\tREADY\tUP-TO-DATE\tAVAILABLE\tIMAGE\tAGE")
+		for _, d := range owned.deployments {
+			fmt.Fprintf(w, "  %s\t%d/%s\t%d\t%d\t%s\t%s\n", d.Name, d.Status.ReadyReplicas, replicasString(d.Spec.Replicas),
+				d.Status.UpdatedReplicas, d.Status.AvailableReplicas, podImages(&d.Spec.Template.Spec), age(d.CreationTimestamp))
+		}
+	}
+
+	fmt.Fprintln(w, "\nPods:")
+	if len(pods) == 0 {
+		fmt.Fprintln(w, "  <none>")
+	} else {
+		fmt.Fprintln(w, "  NAME\tREADY\tSTATUS\tRESTARTS\tNODE\tAGE")
+		for _, pod := range pods {
+			ready, restarts := 0, int32(0)
+			for _, cs := range pod.Status.ContainerStatuses {
+				if cs.Ready {
+					ready++
+				}
+				restarts += cs.RestartCount
+			}
+			fmt.Fprintf(w, "  %s\t%d/%d\t%s\t%d\t%s\t%s\n", pod.Name, ready, len(pod.Spec.Containers),
+				podPhase(pod), restarts, pod.Spec.NodeName, age(pod.CreationTimestamp))
+		}
+	}
+	return w.Flush()
+}
+
+// foosByDeploymentName returns the Foos that want the named Deployment, with
+// the same lookup the controller uses.
+func foosByDeploymentName(items []samplev1alpha1.Foo, namespace, deployment string) ([]samplev1alpha1.Foo, error) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, listers.FooIndexers())
+	for i := range items {
+		if err := indexer.Add(&items[i]); err != nil {
+			return nil, err
+		}
+	}
+	foos, err := listers.NewFooLister(indexer).Foos(namespace).ByDeploymentName(deployment)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(foos, func(i, j int) bool {
+		return foos[i].Namespace+"/"+foos[i].Name < foos[j].Namespace+"/"+foos[j].Name
+	})
+	matched := make([]samplev1alpha1.Foo, 0, len(foos))
+	for _, foo := range foos {
+		matched = append(matched, *foo)
+	}
+	return matched, nil
+}
+
+func replicasString(replicas *int32) string {
+	if replicas == nil {
+		return "1"
+	}
+	return fmt.Sprint(*replicas)
+}
+
+func podImages(spec *corev1.PodSpec) string {
+	images := ""
+	for i, c := range spec.Containers {
+		if i > 0 {
+			images += ","
+		}
+		images += c.Image
+	}
+	return images
+}
+
+// podPhase returns the phase of a Pod, or Terminating if it is being deleted.
+func podPhase(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	if pod.Status.Phase == "" {
+		return string(corev1.PodPending)
+	}
+	return string(pod.Status.Phase)
+}
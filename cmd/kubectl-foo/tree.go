@@ -0,0 +1,107 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// treeNode is an object in the ownership tree of a Foo.
+type treeNode struct {
+	Kind     string      `json:"kind"`
+	Name     string      `json:"name"`
+	Status   string      `json:"status,omitempty"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+func newTreeCommand() *command {
+	return &command{
+		name:  "tree",
+		usage: "tree NAME [-n NAMESPACE] [-o table|json|yaml]",
+		short: "Show the objects owned by a Foo",
+		run: func(o *options, args []string) error {
+			name, err := o.singleName(args)
+			if err != nil {
+				return err
+			}
+			foo, err := o.getFoo(name)
+			if err != nil {
+				return err
+			}
+			owned, err := o.ownedObjects(foo)
+			if err != nil {
+				return err
+			}
+			root := fooTree(foo, owned)
+			if o.output != "table" {
+				return o.print(root)
+			}
+			w := newTabWriter(o.out)
+			fmt.Fprintln(w, "NAME\tSTATUS")
+			printTree(w, root, "", "")
+			return w.Flush()
+		},
+	}
+}
+
+// fooTree arranges a Foo and the objects it owns into a tree.
+func fooTree(foo *samplev1alpha1.Foo, owned *ownedObjects) *treeNode {
+	root := &treeNode{
+		Kind:   "Foo",
+		Name:   foo.Name,
+		Status: fmt.Sprintf("%d/%s available", foo.Status.AvailableReplicas, replicasString(foo.Spec.Replicas)),
+	}
+	for _, d := range owned.deployments {
+		dn := &treeNode{
+			Kind:   "Deployment",
+			Name:   d.Name,
+			Status: fmt.Sprintf("%d/%s ready", d.Status.ReadyReplicas, replicasString(d.Spec.Replicas)),
+		}
+		for _, rs := range owned.replicaSets[d.UID] {
+			rsn := &treeNode{
+				Kind:   "ReplicaSet",
+				Name:   rs.Name,
+				Status: fmt.Sprintf("%d/%s ready", rs.Status.ReadyReplicas, replicasString(rs.Spec.Replicas)),
+			}
+			for _, pod := range owned.pods[rs.UID] {
+				rsn.Children = append(rsn.Children, &treeNode{Kind: "Pod", Name: pod.Name, Status: podPhase(pod)})
+			}
+			dn.Children = append(dn.Children, rsn)
+		}
+		root.Children = append(root.Children, dn)
+	}
+	for _, s := range owned.services {
+		root.Children = append(root.Children, &treeNode{Kind: "Service", Name: s.Name, Status: s.Spec.ClusterIP})
+	}
+	return root
+}
+
+// printTree writes a node and its children, one per line, with box-drawing
+// prefixes showing where each sits in the tree.
+func printTree(w io.Writer, node *treeNode, prefix, childPrefix string) {
+	fmt.Fprintf(w, "%s%s/%s\t%s\n", prefix, node.Kind, node.Name, node.Status)
+	for i, child := range node.Children {
+		if i == len(node.Children)-1 {
+			printTree(w, child, childPrefix+"└─", childPrefix+"  ")
+		} else {
+			printTree(w, child, childPrefix+"├─", childPrefix+"│ ")
+		}
+	}
+}
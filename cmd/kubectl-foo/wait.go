@@ -0,0 +1,115 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// waitPollInterval is how often wait checks on the Foo.
+var waitPollInterval = time.Second
+
+func newWaitCommand() *command {
+	var condition string
+	var timeout time.Duration
+	return &command{
+		name:  "wait",
+		usage: "wait NAME --for=ready [--timeout=DURATION] [-n NAMESPACE]",
+		short: "Wait until a Foo is ready",
+		flags: func(fs *pflag.FlagSet) {
+			fs.StringVar(&condition, "for", "ready", "The condition to wait for. Only ready is supported.")
+			fs.DurationVar(&timeout, "timeout", 30*time.Second, "How long to wait before giving up.")
+		},
+		run: func(o *options, args []string) error {
+			name, err := o.singleName(args)
+			if err != nil {
+				return err
+			}
+			if condition != "ready" {
+				return fmt.Errorf("unsupported condition %q, only ready is supported", condition)
+			}
+			var reason string
+			err = wait.PollImmediate(waitPollInterval, timeout, func() (bool, error) {
+				foo, err := o.getFoo(name)
+				if err != nil {
+					return false, err
+				}
+				owned, err := o.ownedObjects(foo)
+				if err != nil {
+					return false, err
+				}
+				var ready bool
+				ready, reason = fooReady(foo, owned)
+				return ready, nil
+			})
+			if err == wait.ErrWaitTimeout {
+				return fmt.Errorf("timed out waiting for foo %q to be ready: %s", name, reason)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "foo.samplecontroller.k8s.io/%s condition met\n", name)
+			return nil
+		},
+	}
+}
+
+// fooReady reports whether a Foo has settled: the controller has caught up
+// with its deployment name, no canary or blue/green rollout is in progress,
+// and its primary Deployment has rolled out completely. When it has not, the
+// reason says what is outstanding.
+func fooReady(foo *samplev1alpha1.Foo, owned *ownedObjects) (bool, string) {
+	if foo.Status.DeploymentName != foo.Spec.DeploymentName {
+		return false, fmt.Sprintf("deployment %q has not been synced yet", foo.Spec.DeploymentName)
+	}
+	if canary := foo.Status.Canary; canary != nil {
+		return false, fmt.Sprintf("canary rollout at step %d is %s", canary.CurrentStepIndex, canary.Phase)
+	}
+	if bg := foo.Status.BlueGreen; bg != nil && bg.PreviewColor != "" {
+		return false, fmt.Sprintf("%s preview has not been promoted", bg.PreviewColor)
+	}
+
+	name := primaryDeploymentName(foo)
+	var deployment *appsv1.Deployment
+	for _, d := range owned.deployments {
+		if d.Name == name {
+			deployment = d
+		}
+	}
+	if deployment == nil {
+		return false, fmt.Sprintf("deployment %q not found", name)
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	if status.ObservedGeneration < deployment.Generation {
+		return false, fmt.Sprintf("deployment %q has not observed its latest spec", name)
+	}
+	if status.UpdatedReplicas != replicas || status.Replicas != replicas || status.AvailableReplicas != replicas {
+		return false, fmt.Sprintf("deployment %q has %d of %d replicas updated and available", name, status.AvailableReplicas, replicas)
+	}
+	return true, ""
+}
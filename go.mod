@@ -5,11 +5,17 @@ module k8s.io/sample-controller
 go 1.16
 
 require (
-	k8s.io/api v0.0.0-20210825040442-f20796d02069
-	k8s.io/apimachinery v0.0.0-20210825040238-74be3b88bedb
-	k8s.io/client-go v0.0.0-20210827200652-b350fc31ceb9
-	k8s.io/code-generator v0.0.0-20210825160035-e7c2dcc7dff4
+	github.com/go-logr/logr v0.4.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/spf13/pflag v1.0.5
+	k8s.io/api v0.22.2
+	k8s.io/apimachinery v0.22.2
+	k8s.io/client-go v0.22.2
+	k8s.io/code-generator v0.22.2
 	k8s.io/klog/v2 v2.9.0
+	sigs.k8s.io/controller-tools v0.7.0
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
@@ -33,3 +33,19 @@ bash "${CODEGEN_PKG}"/generate-groups.sh "deepcopy,client,informer,lister" \
 
 # To use your own boilerplate text append:
 #   --go-header-file "${SCRIPT_ROOT}"/hack/custom-boilerplate.go.txt
+
+# The CRD manifests are generated from the kubebuilder markers on the API
+# types. controller-gen is built from the module cache at the version go.mod
+# pins it to through hack/tools.go. Set CONTROLLER_GEN to the absolute path of
+# a controller-gen binary to use it instead.
+crd_tmp=$(mktemp -d)
+trap 'rm -rf "${crd_tmp}"' EXIT
+if [[ -z "${CONTROLLER_GEN:-}" ]]; then
+  (cd "${SCRIPT_ROOT}"; GOBIN="${crd_tmp}/bin" go install sigs.k8s.io/controller-tools/cmd/controller-gen)
+  CONTROLLER_GEN="${crd_tmp}/bin/controller-gen"
+fi
+(cd "${SCRIPT_ROOT}"; "${CONTROLLER_GEN}" crd:crdVersions=v1 paths=./pkg/apis/... output:crd:dir="${crd_tmp}/crd")
+
+crd="${crd_tmp}/crd/samplecontroller.k8s.io_foos.yaml"
+header="# Generated by hack/update-codegen.sh from the markers in pkg/apis. DO NOT EDIT."
+{ echo "${header}"; cat "${crd}"; } > "${SCRIPT_ROOT}/artifacts/examples/crd.yaml"
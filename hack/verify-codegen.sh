@@ -20,8 +20,7 @@ set -o pipefail
 
 SCRIPT_ROOT=$(dirname "${BASH_SOURCE[0]}")/..
 
-DIFFROOT="${SCRIPT_ROOT}/pkg"
-TMP_DIFFROOT="${SCRIPT_ROOT}/_tmp/pkg"
+DIFFROOTS=("pkg" "artifacts/examples")
 _tmp="${SCRIPT_ROOT}/_tmp"
 
 cleanup() {
@@ -31,18 +30,22 @@ trap "cleanup" EXIT SIGINT
 
 cleanup
 
-mkdir -p "${TMP_DIFFROOT}"
-cp -a "${DIFFROOT}"/* "${TMP_DIFFROOT}"
+for root in "${DIFFROOTS[@]}"; do
+  mkdir -p "${_tmp}/${root}"
+  cp -a "${SCRIPT_ROOT}/${root}"/* "${_tmp}/${root}"
+done
 
 "${SCRIPT_ROOT}/hack/update-codegen.sh"
-echo "diffing ${DIFFROOT} against freshly generated codegen"
 ret=0
-diff -Naupr "${DIFFROOT}" "${TMP_DIFFROOT}" || ret=$?
-cp -a "${TMP_DIFFROOT}"/* "${DIFFROOT}"
+for root in "${DIFFROOTS[@]}"; do
+  echo "diffing ${SCRIPT_ROOT}/${root} against freshly generated codegen"
+  diff -Naupr "${SCRIPT_ROOT}/${root}" "${_tmp}/${root}" || ret=$?
+  cp -a "${_tmp}/${root}"/* "${SCRIPT_ROOT}/${root}"
+done
 if [[ $ret -eq 0 ]]
 then
-  echo "${DIFFROOT} up to date."
+  echo "${DIFFROOTS[*]} up to date."
 else
-  echo "${DIFFROOT} is out of date. Please run hack/update-codegen.sh"
+  echo "${DIFFROOTS[*]} out of date. Please run hack/update-codegen.sh"
   exit 1
 fi
@@ -18,32 +18,71 @@ package main
 
 import (
 	"flag"
+	"net/http"
+	"os"
+	"strings"
 	"time"
-
+	// Schedules on Foos name IANA time zones, which must resolve even in
+	// images without a time zone database.
+	_ "time/tzdata"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
+	"k8s.io/sample-controller/pkg/controller"
 	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
 	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
 	"k8s.io/sample-controller/pkg/signals"
 )
 
 var (
-	masterURL  string
-	kubeconfig string
+	masterURL   string
+	kubeconfig  string
+	maxRetries  int
+	metricsAddr string
+	podSummary  bool
+	stripCache  bool
+	ownedKinds  string
+
+	sweepInterval    time.Duration
+	sweepGracePeriod time.Duration
+	sweepReportOnly  bool
+
+	eventsAPI  bool
+	eventBurst int
+	eventQPS   float64
 )
 
 func main() {
+	// The render and diff subcommands work on manifests alone and do not
+	// start the controller.
+	if len(os.Args) > 1 && (os.Args[1] == "render" || os.Args[1] == "diff") {
+		os.Exit(runOffline(os.Args[1], os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	klog.InitFlags(nil)
 	flag.Parse()
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
 
+	if metricsAddr != "" {
+		controller.SetMetricsProvider(controller.NewExpvarMetricsProvider())
+		go func() {
+			// expvar serves the metrics under /debug/vars.
+			klog.Fatal(http.ListenAndServe(metricsAddr, nil))
+		}()
+	}
+
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
 		klog.Fatalf("Error building kubeconfig: %s", err.Error())
@@ -61,17 +100,85 @@ func main() {
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
 	exampleInformerFactory := informers.NewSharedInformerFactory(exampleClient, time.Second*30)
+	if stripCache {
+		if err := controller.StripKubeInformers(kubeInformerFactory, nil, &appsv1.Deployment{}, &corev1.Service{}); err != nil {
+			klog.Fatalf("Error stripping informers: %s", err.Error())
+		}
+		controller.StripFooInformer(exampleInformerFactory, nil)
+	}
+
+	opts := controller.Options{
+		KubeClientset:      kubeClient,
+		SampleClientset:    exampleClient,
+		DeploymentInformer: kubeInformerFactory.Apps().V1().Deployments(),
+		ServiceInformer:    kubeInformerFactory.Core().V1().Services(),
+		FooInformer:        exampleInformerFactory.Samplecontroller().V1alpha1().Foos(),
+		MaxRetries:         maxRetries,
+		UseEventsAPI:       eventsAPI,
+	}
+	if eventBurst > 0 {
+		opts.EventCorrelator = &controller.EventCorrelatorOptions{
+			BurstSize: eventBurst,
+			QPS:       float32(eventQPS),
+		}
+	}
+	if sweepInterval > 0 {
+		opts.Sweep = &controller.SweepOptions{
+			Interval:    sweepInterval,
+			GracePeriod: sweepGracePeriod,
+			ReportOnly:  sweepReportOnly,
+		}
+	}
 
-	controller := NewController(kubeClient, exampleClient,
-		kubeInformerFactory.Apps().V1().Deployments(),
-		exampleInformerFactory.Samplecontroller().V1alpha1().Foos())
+	// Pods are only watched when they are summarized, and then only those
+	// of Foos, through an informer factory of their own.
+	var podInformerFactory kubeinformers.SharedInformerFactory
+	if podSummary {
+		selectPods := func(options *metav1.ListOptions) {
+			options.LabelSelector = controller.PodLabelSelector
+		}
+		podInformerFactory = kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second*30,
+			kubeinformers.WithTweakListOptions(selectPods))
+		if stripCache {
+			if err := controller.StripKubeInformers(podInformerFactory, selectPods, &corev1.Pod{}); err != nil {
+				klog.Fatalf("Error stripping informers: %s", err.Error())
+			}
+		}
+		opts.PodInformer = podInformerFactory.Core().V1().Pods()
+	}
+
+	// Other kinds of objects Foos control are watched as metadata alone.
+	if ownedKinds != "" {
+		metadataClient, err := metadata.NewForConfig(cfg)
+		if err != nil {
+			klog.Fatalf("Error building metadata client: %s", err.Error())
+		}
+		for _, arg := range strings.Split(ownedKinds, ",") {
+			gvr, _ := schema.ParseResourceArg(strings.TrimSpace(arg))
+			if gvr == nil {
+				klog.Fatalf("Invalid resource %q in -owned-resources, expected resource.version.group", arg)
+			}
+			opts.OwnedInformers = append(opts.OwnedInformers, controller.NewMetadataInformer(metadataClient, *gvr, time.Second*30, nil))
+		}
+	}
+
+	c, err := controller.NewController(opts)
+	if err != nil {
+		klog.Fatalf("Error creating controller: %s", err.Error())
+	}
 
 	// notice that there is no need to run Start methods in a separate goroutine. (i.e. go kubeInformerFactory.Start(stopCh)
 	// Start method is non-blocking and runs all registered informers in a dedicated goroutine.
 	kubeInformerFactory.Start(stopCh)
 	exampleInformerFactory.Start(stopCh)
+	if podInformerFactory != nil {
+		podInformerFactory.Start(stopCh)
+	}
+	for _, informer := range opts.OwnedInformers {
+		go informer.Run(stopCh)
+	}
 
-	if err = controller.Run(2, stopCh); err != nil {
+	if err = c.Run(2, stopCh); err != nil {
 		klog.Fatalf("Error running controller: %s", err.Error())
 	}
 }
@@ -79,4 +186,15 @@ func main() {
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.IntVar(&maxRetries, "max-retries", controller.DefaultMaxRetries, "How many times a Foo failing with transient errors is retried before it is marked Stalled.")
+	flag.BoolVar(&podSummary, "pod-summary", false, "Watch the pods of Foos and summarize them in status.pods.")
+	flag.BoolVar(&stripCache, "strip-cached-objects", true, "Drop the managed fields of the objects the controller caches, and the last applied configuration of pods.")
+	flag.StringVar(&ownedKinds, "owned-resources", "", "Comma-separated resources Foos may control besides Deployments and Services, as resource.version.group, such as configmaps.v1. (with a trailing dot for the core group). A change to one queues the Foo that controls it. Only their metadata is cached.")
+	flag.BoolVar(&eventsAPI, "events-api", false, "Record Events through the events.k8s.io/v1 API rather than as core/v1 Events.")
+	flag.IntVar(&eventBurst, "event-burst", 0, "How many Events about a Foo are recorded in a burst before they are capped. Events are not capped when zero.")
+	flag.Float64Var(&eventQPS, "event-qps", controller.DefaultEventQPS, "How many Events about a Foo are recorded per second once its burst is spent.")
+	flag.DurationVar(&sweepInterval, "sweep-interval", 0, "How often to look for Deployments left behind by Foos that no longer exist. They are not looked for when zero.")
+	flag.DurationVar(&sweepGracePeriod, "sweep-grace-period", controller.DefaultSweepGracePeriod, "How long a Deployment left behind by a Foo is reported before it is deleted.")
+	flag.BoolVar(&sweepReportOnly, "sweep-report-only", false, "Report the Deployments left behind by Foos without deleting them.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", "", "The address to serve metrics on, under /debug/vars. Metrics are not served when empty.")
 }
@@ -22,28 +22,300 @@ import (
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=fo,categories=sample
+// +kubebuilder:subresource:status
+// +kubebuilder:metadata:annotations="api-approved.kubernetes.io=unapproved, experimental-only; please get an approval from Kubernetes API reviewers if you're trying to develop a CRD in the *.k8s.io or *.kubernetes.io groups"
+// +kubebuilder:printcolumn:name="Deployment",type=string,JSONPath=`.spec.deploymentName`
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.availableReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Foo is a specification for a Foo resource
 type Foo struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   FooSpec   `json:"spec"`
+	// +optional
+	Spec FooSpec `json:"spec"`
+	// +optional
 	Status FooStatus `json:"status"`
 }
 
 // FooSpec is the spec for a Foo resource
 type FooSpec struct {
+	// +optional
 	DeploymentName string `json:"deploymentName"`
-	Replicas       *int32 `json:"replicas"`
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	Replicas *int32 `json:"replicas"`
+	// Image is the container image run by the Deployment. Defaults to
+	// nginx:latest when empty.
+	Image string `json:"image,omitempty"`
+	// Strategy describes how changes to the pod template are rolled out.
+	// When unset, the Deployment is updated in place.
+	Strategy *FooStrategy `json:"strategy,omitempty"`
+	// Schedules override Replicas at the times they describe. When several
+	// schedules are in effect, the one that fired most recently wins.
+	Schedules []ReplicaSchedule `json:"schedules,omitempty"`
+	// DeploymentRenamePolicy decides what happens when DeploymentName is
+	// changed after the Foo has been synced. Defaults to Refuse.
+	DeploymentRenamePolicy DeploymentRenamePolicy `json:"deploymentRenamePolicy,omitempty"`
+	// AdoptionPolicy decides whether an existing Deployment without a
+	// controller is taken over when it has the name the Foo asks for.
+	// Defaults to Never.
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+	// Paused stops the controller from changing the objects of the Foo,
+	// including its status, until it is cleared.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// DefaultImage is the container image run for a Foo that does not set
+// spec.image.
+const DefaultImage = "nginx:latest"
+
+// AdoptionPolicy decides whether a Foo takes over existing Deployments
+// +kubebuilder:validation:Enum=Never;Adopt
+type AdoptionPolicy string
+
+const (
+	// AdoptionPolicyNever reports existing Deployments as conflicts.
+	AdoptionPolicyNever AdoptionPolicy = "Never"
+	// AdoptionPolicyAdopt takes over existing Deployments that have no
+	// controller and a selector matching the one the Foo would create.
+	AdoptionPolicyAdopt AdoptionPolicy = "Adopt"
+)
+
+// DeploymentRenamePolicy decides what happens when the deployment name of a
+// Foo is changed
+// +kubebuilder:validation:Enum=Refuse;Migrate
+type DeploymentRenamePolicy string
+
+const (
+	// DeploymentRenamePolicyRefuse leaves the existing Deployments alone and
+	// reports the rename as refused until the name is changed back.
+	DeploymentRenamePolicyRefuse DeploymentRenamePolicy = "Refuse"
+	// DeploymentRenamePolicyMigrate creates the Deployments under the new
+	// name and deletes the old ones once the new ones are available.
+	DeploymentRenamePolicyMigrate DeploymentRenamePolicy = "Migrate"
+)
+
+// ReplicaSchedule sets the replicas of a Foo from the times described by a
+// cron expression
+type ReplicaSchedule struct {
+	// Name identifies the schedule in the status of the Foo.
+	Name string `json:"name"`
+	// Schedule is a standard five field cron expression, or a descriptor
+	// such as @daily, marking when the schedule takes effect.
+	Schedule string `json:"schedule"`
+	// TimeZone is the IANA name of the time zone Schedule is evaluated in.
+	// Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Replicas is the number of replicas while the schedule is in effect.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// Duration is how long the schedule stays in effect each time it fires.
+	// When unset, it stays in effect until another schedule fires.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// FooStrategy describes how changes to a Foo are rolled out to its
+// Deployments. At most one strategy may be set.
+type FooStrategy struct {
+	// Canary rolls out a new pod template through a second Deployment,
+	// shifting replicas to it step by step.
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+	// BlueGreen rolls out a new pod template by bringing up a full second
+	// copy of the Deployment and switching a Service over to it.
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+}
+
+// CanaryStrategy is the spec for a canary rollout
+type CanaryStrategy struct {
+	// Steps are the weights the canary is taken through, in order. Once the
+	// last step has completed the canary is promoted.
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+	// Promote skips the remaining steps of the rollout in progress and
+	// promotes the canary to stable. It only applies to the rollout in
+	// progress when it is set, and has to be cleared before it can promote
+	// a later one.
+	Promote bool `json:"promote,omitempty"`
+	// Abort scales the canary away and returns all replicas to the stable
+	// Deployment. No rollout progresses while Abort is set.
+	Abort bool `json:"abort,omitempty"`
+}
+
+// CanaryStep is a single step of a canary rollout
+type CanaryStep struct {
+	// Weight is the percentage of replicas, between 0 and 100, that run the
+	// canary pod template during this step.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+	// Pause is how long to stay at this step before moving to the next one.
+	// When unset the rollout waits at this step until it is promoted.
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// BlueGreenStrategy is the spec for a blue/green rollout
+type BlueGreenStrategy struct {
+	// ServiceName is the name of the Service whose selector is switched
+	// between colors. Defaults to the deployment name.
+	ServiceName string `json:"serviceName,omitempty"`
+	// Promote switches the Service to the preview color as soon as the
+	// preview Deployment is available.
+	Promote bool `json:"promote,omitempty"`
+	// AutoPromotionDelay, when set, switches the Service to the preview
+	// color once the preview Deployment has been available this long.
+	AutoPromotionDelay *metav1.Duration `json:"autoPromotionDelay,omitempty"`
 }
 
 // FooStatus is the status for a Foo resource
 type FooStatus struct {
 	AvailableReplicas int32 `json:"availableReplicas"`
+	// DeploymentName is the name of the Deployment currently managed for
+	// the Foo. It only differs from the spec while a rename is refused or
+	// being migrated.
+	DeploymentName string `json:"deploymentName,omitempty"`
+	// Conditions are the latest observations of the state of the Foo.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Canary is the state of the canary rollout in progress, if any.
+	Canary *CanaryStatus `json:"canary,omitempty"`
+	// PromotedTemplateHash is the hash of the pod template last promoted
+	// through spec.strategy.canary.promote. While promote stays set, it is
+	// ignored for the rollouts of any other pod template.
+	PromotedTemplateHash string `json:"promotedTemplateHash,omitempty"`
+	// BlueGreen is the state of the blue/green strategy, if used.
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+	// ActiveSchedule is the name of the schedule setting the replicas, if
+	// any.
+	ActiveSchedule string `json:"activeSchedule,omitempty"`
+	// NextScheduleTransition is the next time a schedule fires or stops
+	// being in effect.
+	NextScheduleTransition *metav1.Time `json:"nextScheduleTransition,omitempty"`
+	// Pods summarizes the pods of the Foo. It is only reported when the
+	// controller runs with pod summaries enabled.
+	Pods *PodSummary `json:"pods,omitempty"`
+}
+
+// PodSummary summarizes the pods of a Foo
+type PodSummary struct {
+	// Pending is the number of pods in the Pending phase.
+	Pending int32 `json:"pending,omitempty"`
+	// Running is the number of pods in the Running phase.
+	Running int32 `json:"running,omitempty"`
+	// Succeeded is the number of pods in the Succeeded phase.
+	Succeeded int32 `json:"succeeded,omitempty"`
+	// Failed is the number of pods in the Failed phase.
+	Failed int32 `json:"failed,omitempty"`
+	// Unknown is the number of pods in the Unknown phase.
+	Unknown int32 `json:"unknown,omitempty"`
+	// Ready is the number of pods that are ready.
+	Ready int32 `json:"ready,omitempty"`
+	// Restarts is the total number of container restarts across the pods.
+	Restarts int32 `json:"restarts,omitempty"`
+	// RecentTerminations are the most recent container terminations across
+	// the pods, newest first.
+	RecentTerminations []ContainerTermination `json:"recentTerminations,omitempty"`
+	// LastUpdateTime is when the summary was last written. Changes to the
+	// pods alone are written at most once per update interval.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
+}
+
+// ContainerTermination describes a container of a Foo that terminated
+type ContainerTermination struct {
+	// Pod is the name of the pod the container belongs to.
+	Pod string `json:"pod"`
+	// Container is the name of the container.
+	Container string `json:"container"`
+	// Reason is why the container terminated, such as OOMKilled or Error.
+	Reason string `json:"reason,omitempty"`
+	// ExitCode is the exit code of the container.
+	ExitCode int32 `json:"exitCode"`
+	// FinishedAt is when the container terminated.
+	FinishedAt metav1.Time `json:"finishedAt,omitempty"`
+}
+
+const (
+	// FooConditionSynced is True when the last sync of a Foo succeeded, and
+	// False with the error that stopped it otherwise.
+	FooConditionSynced = "Synced"
+	// FooConditionStalled is True when the controller has stopped retrying a
+	// Foo, either because the error cannot be fixed by retrying or because
+	// it ran out of retries. Its message is the last error.
+	FooConditionStalled = "Stalled"
+	// FooConditionProgressing reports on the rollout of the Deployments of a
+	// Foo, from their Progressing conditions.
+	FooConditionProgressing = "Progressing"
+	// FooConditionAvailable reports whether the Deployments of a Foo have
+	// their minimum availability, from their Available conditions.
+	FooConditionAvailable = "Available"
+	// FooConditionReplicaFailure is True when a Deployment of a Foo fails to
+	// create or delete pods, from its ReplicaFailure condition.
+	FooConditionReplicaFailure = "ReplicaFailure"
+	// FooConditionDeploymentRenamed reports on the last change of the
+	// deployment name of a Foo.
+	FooConditionDeploymentRenamed = "DeploymentRenamed"
+)
+
+// CanaryPhase is the phase of a canary rollout
+type CanaryPhase string
+
+const (
+	// CanaryPhaseProgressing means the canary is moving through its steps.
+	CanaryPhaseProgressing CanaryPhase = "Progressing"
+	// CanaryPhasePaused means the canary is waiting at a step without a
+	// pause duration until it is promoted.
+	CanaryPhasePaused CanaryPhase = "Paused"
+	// CanaryPhaseAborted means the rollout was aborted and all replicas run
+	// the stable pod template.
+	CanaryPhaseAborted CanaryPhase = "Aborted"
+)
+
+// CanaryStatus is the status of a canary rollout
+type CanaryStatus struct {
+	// TemplateHash is the hash of the pod template being rolled out.
+	TemplateHash string `json:"templateHash"`
+	// CurrentStepIndex is the index of the step the rollout is at.
+	CurrentStepIndex int32 `json:"currentStepIndex"`
+	// StepStartTime is when the current step was entered.
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
+	// Phase is the phase of the rollout.
+	Phase CanaryPhase `json:"phase"`
+	// StableReplicas is the number of replicas requested from the stable
+	// Deployment.
+	StableReplicas int32 `json:"stableReplicas"`
+	// CanaryReplicas is the number of replicas requested from the canary
+	// Deployment.
+	CanaryReplicas int32 `json:"canaryReplicas"`
+}
+
+// Color identifies one of the two Deployments of a blue/green Foo
+// +kubebuilder:validation:Enum=blue;green
+type Color string
+
+const (
+	// ColorBlue is the color of the first Deployment of a blue/green Foo.
+	ColorBlue Color = "blue"
+	// ColorGreen is the color of the second Deployment of a blue/green Foo.
+	ColorGreen Color = "green"
+)
+
+// BlueGreenStatus is the status of a blue/green Foo
+type BlueGreenStatus struct {
+	// ActiveColor is the color the Service currently selects.
+	ActiveColor Color `json:"activeColor"`
+	// PreviewColor is the color running the pod template being rolled out,
+	// if a rollout is in progress.
+	PreviewColor Color `json:"previewColor,omitempty"`
+	// PreviewAvailableTime is when the preview Deployment became available.
+	PreviewAvailableTime *metav1.Time `json:"previewAvailableTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
 
 // FooList is a list of Foo resources
 type FooList struct {
@@ -0,0 +1,551 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package benchmark measures how many Foos the controller can handle. It runs
+// the full controller, with informers and workers, against fake clientsets
+// seeded with Foos and their Deployments, and reports its throughput, the
+// latency of its workqueue and its memory use.
+//
+// The fake clientsets are much faster than an API server, so the numbers are
+// an upper bound on what a replica of the controller can do, and are most
+// useful compared with each other to catch regressions.
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/controller"
+	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+)
+
+// pollInterval is how often a phase checks whether the controller is done.
+const pollInterval = 10 * time.Millisecond
+
+// Config describes a benchmark run.
+type Config struct {
+	// Foos is the number of Foos the clientsets are seeded with, each with
+	// a Deployment that is already rolled out.
+	Foos int
+	// Workers is the number of workers the controller runs.
+	Workers int
+	// Scale is the number of Foos scaled up once they have all been synced.
+	// The scale phase is skipped if it is zero.
+	Scale int
+	// Timeout bounds each phase.
+	Timeout time.Duration
+}
+
+// Result reports the phases of a benchmark run, and the memory the process
+// allocated over the whole run, the fake clientsets included.
+type Result struct {
+	Config Config
+	Phases []Phase
+
+	// Allocs is the number of heap objects allocated.
+	Allocs uint64
+	// AllocBytes is the number of bytes allocated.
+	AllocBytes uint64
+	// HeapInuse is the number of bytes in use on the heap at the end.
+	HeapInuse uint64
+}
+
+// Phase reports how the controller did at one task: "sync", syncing every
+// Foo after it starts, or "scale", scaling the Deployments of some of them.
+type Phase struct {
+	Name string
+	// Reconciles is the number of Foos the workers processed.
+	Reconciles int
+	// Duration is how long it took until the controller was idle.
+	Duration time.Duration
+	// QueueLatency is how long Foos waited in the workqueue.
+	QueueLatency Percentiles
+	// SyncDuration is how long the workers took to process a Foo.
+	SyncDuration Percentiles
+}
+
+// ReconcilesPerSecond is the throughput of the phase.
+func (p Phase) ReconcilesPerSecond() float64 {
+	if p.Duration <= 0 {
+		return 0
+	}
+	return float64(p.Reconciles) / p.Duration.Seconds()
+}
+
+// Percentiles summarizes a distribution of durations.
+type Percentiles struct {
+	P50, P90, P99, Max time.Duration
+}
+
+func percentilesOf(seconds []float64) Percentiles {
+	if len(seconds) == 0 {
+		return Percentiles{}
+	}
+	sort.Float64s(seconds)
+	at := func(q float64) time.Duration {
+		i := int(q * float64(len(seconds)-1))
+		return time.Duration(seconds[i] * float64(time.Second))
+	}
+	return Percentiles{P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: at(1)}
+}
+
+// Run runs the controller as described by cfg.
+func Run(cfg Config) (*Result, error) {
+	if cfg.Foos <= 0 || cfg.Workers <= 0 {
+		return nil, fmt.Errorf("the number of foos and workers must be positive")
+	}
+	if cfg.Scale > cfg.Foos {
+		return nil, fmt.Errorf("cannot scale %d of %d foos", cfg.Scale, cfg.Foos)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+
+	var foos, deployments []k8sruntime.Object
+	for i := 0; i < cfg.Foos; i++ {
+		foo, deployment, err := newObjects(i)
+		if err != nil {
+			return nil, err
+		}
+		foos = append(foos, foo)
+		deployments = append(deployments, deployment)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	queue := &queueRecorder{}
+	client := fake.NewSimpleClientset(foos...)
+	kubeclient := k8sfake.NewSimpleClientset(deployments...)
+	bufferWatches(&client.Fake, client.Tracker())
+	bufferWatches(&kubeclient.Fake, kubeclient.Tracker())
+	i := informers.NewSharedInformerFactory(client, 0)
+	k8sI := kubeinformers.NewSharedInformerFactory(kubeclient, 0)
+	c, err := controller.NewController(controller.Options{
+		KubeClientset:      kubeclient,
+		SampleClientset:    client,
+		DeploymentInformer: k8sI.Apps().V1().Deployments(),
+		ServiceInformer:    k8sI.Core().V1().Services(),
+		FooInformer:        i.Samplecontroller().V1alpha1().Foos(),
+		Recorder:           &record.FakeRecorder{},
+		Logger:             logr.Discard(),
+		MetricsProvider:    queue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fooLister := i.Samplecontroller().V1alpha1().Foos().Lister()
+	deploymentLister := k8sI.Apps().V1().Deployments().Lister()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	i.Start(stopCh)
+	k8sI.Start(stopCh)
+
+	result := &Result{Config: cfg}
+	phase, err := queue.phase("sync", cfg.Timeout, func() error {
+		go c.Run(cfg.Workers, stopCh)
+		return nil
+	}, func() bool {
+		foos, err := fooLister.List(labels.Everything())
+		if err != nil || len(foos) != cfg.Foos {
+			return false
+		}
+		for _, foo := range foos {
+			if !meta.IsStatusConditionTrue(foo.Status.Conditions, samplev1alpha1.FooConditionSynced) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Phases = append(result.Phases, phase)
+
+	if cfg.Scale > 0 {
+		phase, err := queue.phase("scale", cfg.Timeout, func() error {
+			for n := 0; n < cfg.Scale; n++ {
+				foo, err := fooLister.Foos(metav1.NamespaceDefault).Get(fooName(n))
+				if err != nil {
+					return err
+				}
+				foo = foo.DeepCopy()
+				foo.Spec.Replicas = int32Ptr(2)
+				if _, err := client.SamplecontrollerV1alpha1().Foos(foo.Namespace).Update(context.TODO(), foo, metav1.UpdateOptions{}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, func() bool {
+			for n := 0; n < cfg.Scale; n++ {
+				d, err := deploymentLister.Deployments(metav1.NamespaceDefault).Get(fooName(n))
+				if err != nil || d.Spec.Replicas == nil || *d.Spec.Replicas != 2 {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Phases = append(result.Phases, phase)
+	}
+
+	runtime.ReadMemStats(&after)
+	result.Allocs = after.Mallocs - before.Mallocs
+	result.AllocBytes = after.TotalAlloc - before.TotalAlloc
+	result.HeapInuse = after.HeapInuse
+	return result, nil
+}
+
+func fooName(i int) string {
+	return fmt.Sprintf("foo-%d", i)
+}
+
+// newObjects returns a Foo and the Deployment the controller would create for
+// it, rolled out.
+func newObjects(i int) (*samplev1alpha1.Foo, *appsv1.Deployment, error) {
+	foo := &samplev1alpha1.Foo{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fooName(i),
+			Namespace: metav1.NamespaceDefault,
+			UID:       uuid.NewUUID(),
+		},
+		Spec: samplev1alpha1.FooSpec{
+			DeploymentName: fooName(i),
+			Replicas:       int32Ptr(1),
+		},
+	}
+	objs, err := controller.RenderObjects(foo, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	deployment := objs[0].(*appsv1.Deployment)
+	deployment.Status = appsv1.DeploymentStatus{
+		Replicas:          1,
+		UpdatedReplicas:   1,
+		ReadyReplicas:     1,
+		AvailableReplicas: 1,
+	}
+	return foo, deployment, nil
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+// bufferWatches makes the watches of a fake clientset buffer their events
+// without bound. The watches of its tracker panic once 100 events are
+// pending, which the informers fall behind by under load.
+func bufferWatches(fake *k8stesting.Fake, tracker k8stesting.ObjectTracker) {
+	t := &watchingTracker{ObjectTracker: tracker}
+	fake.PrependReactor("*", "*", k8stesting.ObjectReaction(t))
+	fake.PrependWatchReactor("*", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		return true, t.watch(action.GetResource(), action.GetNamespace()), nil
+	})
+}
+
+// watchingTracker is an ObjectTracker that sends the changes made through
+// it to its own watches, rather than to those of the tracker it wraps.
+type watchingTracker struct {
+	k8stesting.ObjectTracker
+
+	mu       sync.Mutex
+	watchers map[schema.GroupVersionResource][]*bufferedWatch
+}
+
+func (t *watchingTracker) watch(gvr schema.GroupVersionResource, ns string) *bufferedWatch {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.watchers == nil {
+		t.watchers = map[schema.GroupVersionResource][]*bufferedWatch{}
+	}
+	w := newBufferedWatch(ns)
+	t.watchers[gvr] = append(t.watchers[gvr], w)
+	return w
+}
+
+func (t *watchingTracker) Create(gvr schema.GroupVersionResource, obj k8sruntime.Object, ns string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.ObjectTracker.Create(gvr, obj, ns); err != nil {
+		return err
+	}
+	return t.send(gvr, ns, watch.Added, obj)
+}
+
+func (t *watchingTracker) Update(gvr schema.GroupVersionResource, obj k8sruntime.Object, ns string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.ObjectTracker.Update(gvr, obj, ns); err != nil {
+		return err
+	}
+	return t.send(gvr, ns, watch.Modified, obj)
+}
+
+func (t *watchingTracker) Delete(gvr schema.GroupVersionResource, ns, name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	obj, err := t.ObjectTracker.Get(gvr, ns, name)
+	if err != nil {
+		return err
+	}
+	if err := t.ObjectTracker.Delete(gvr, ns, name); err != nil {
+		return err
+	}
+	return t.send(gvr, ns, watch.Deleted, obj)
+}
+
+// send sends the stored state of obj to the watches of its resource and
+// namespace. Changes are sent in the order they were made, as t.mu is held.
+func (t *watchingTracker) send(gvr schema.GroupVersionResource, ns string, eventType watch.EventType, obj k8sruntime.Object) error {
+	if eventType != watch.Deleted {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		if obj, err = t.ObjectTracker.Get(gvr, ns, accessor.GetName()); err != nil {
+			return err
+		}
+	}
+	watchers := t.watchers[gvr][:0]
+	for _, w := range t.watchers[gvr] {
+		if w.stopped() {
+			continue
+		}
+		watchers = append(watchers, w)
+		if w.namespace == metav1.NamespaceAll || w.namespace == ns {
+			w.send(watch.Event{Type: eventType, Object: obj.DeepCopyObject()})
+		}
+	}
+	t.watchers[gvr] = watchers
+	return nil
+}
+
+// bufferedWatch is a watch that buffers its events without bound.
+type bufferedWatch struct {
+	namespace string
+	in        chan watch.Event
+	result    chan watch.Event
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newBufferedWatch(namespace string) *bufferedWatch {
+	w := &bufferedWatch{
+		namespace: namespace,
+		in:        make(chan watch.Event),
+		result:    make(chan watch.Event),
+		stop:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *bufferedWatch) run() {
+	defer close(w.result)
+	var pending []watch.Event
+	for {
+		var out chan watch.Event
+		var next watch.Event
+		if len(pending) > 0 {
+			out, next = w.result, pending[0]
+		}
+		select {
+		case event := <-w.in:
+			pending = append(pending, event)
+		case out <- next:
+			pending = pending[1:]
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *bufferedWatch) send(event watch.Event) {
+	select {
+	case w.in <- event:
+	case <-w.stop:
+	}
+}
+
+func (w *bufferedWatch) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *bufferedWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *bufferedWatch) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// WriteReport writes a table of the phases of a run, and its memory use.
+func (r *Result) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "PHASE\tRECONCILES\tDURATION\tRECONCILES/S\tQUEUE P50\tQUEUE P90\tQUEUE P99\tSYNC P50\tSYNC P99\n")
+	for _, p := range r.Phases {
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%.0f\t%v\t%v\t%v\t%v\t%v\n",
+			p.Name, p.Reconciles, p.Duration.Round(time.Millisecond), p.ReconcilesPerSecond(),
+			p.QueueLatency.P50, p.QueueLatency.P90, p.QueueLatency.P99, p.SyncDuration.P50, p.SyncDuration.P99)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d foos, %d workers: %d allocations, %d MiB allocated, %d MiB heap in use\n",
+		r.Config.Foos, r.Config.Workers, r.Allocs, r.AllocBytes>>20, r.HeapInuse>>20)
+	return err
+}
+
+// queueRecorder records the metrics of the queue of a controller.
+type queueRecorder struct {
+	mu           sync.Mutex
+	depth        int
+	adds         int
+	latencies    []float64
+	workDuration []float64
+}
+
+// phase calls start to give the workers something to do, waits until done
+// returns true and the workqueue is idle, and reports what the workers did in
+// the meantime. The phase is timed from before start is called, so that none
+// of the work it causes is missed.
+func (q *queueRecorder) phase(name string, timeout time.Duration, start func() error, done func() bool) (Phase, error) {
+	// Only the work of this phase is reported.
+	q.mu.Lock()
+	q.adds -= len(q.workDuration)
+	q.latencies, q.workDuration = nil, nil
+	q.mu.Unlock()
+
+	started := time.Now()
+	if err := start(); err != nil {
+		return Phase{}, err
+	}
+	// The controller is only idle once it has stayed so for two polls, as
+	// informers notify the controller after updating their caches.
+	idle := 0
+	for idle < 2 {
+		if time.Since(started) > timeout {
+			return Phase{}, fmt.Errorf("%s phase did not finish within %v", name, timeout)
+		}
+		time.Sleep(pollInterval)
+		q.mu.Lock()
+		quiet := q.depth == 0 && q.adds == len(q.workDuration)
+		q.mu.Unlock()
+		if quiet && done() {
+			idle++
+		} else {
+			idle = 0
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Phase{
+		Name:         name,
+		Reconciles:   len(q.workDuration),
+		Duration:     time.Since(started),
+		QueueLatency: percentilesOf(q.latencies),
+		SyncDuration: percentilesOf(q.workDuration),
+	}, nil
+}
+
+// The queueRecorder records the metrics of the queue through the controller's
+// MetricsProvider, whose other metrics it drops.
+
+func (q *queueRecorder) NewSyncErrorsMetric(string) controller.CounterMetric { return noopMetric{} }
+func (q *queueRecorder) NewStalledMetric() controller.CounterMetric          { return noopMetric{} }
+
+func (q *queueRecorder) NewQueueDepthMetric(string, string) controller.GaugeMetric {
+	return depthMetric{q}
+}
+
+func (q *queueRecorder) NewQueueAddsMetric(string, string) controller.CounterMetric {
+	return addsMetric{q}
+}
+
+func (q *queueRecorder) NewQueueLatencyMetric(string) controller.HistogramMetric {
+	return observations{q, func(q *queueRecorder) *[]float64 { return &q.latencies }}
+}
+
+func (q *queueRecorder) NewWorkDurationMetric(string) controller.HistogramMetric {
+	return observations{q, func(q *queueRecorder) *[]float64 { return &q.workDuration }}
+}
+
+type depthMetric struct{ q *queueRecorder }
+
+func (m depthMetric) Inc() { m.add(1) }
+func (m depthMetric) Dec() { m.add(-1) }
+
+func (m depthMetric) add(delta int) {
+	m.q.mu.Lock()
+	defer m.q.mu.Unlock()
+	m.q.depth += delta
+}
+
+type addsMetric struct{ q *queueRecorder }
+
+func (m addsMetric) Inc() {
+	m.q.mu.Lock()
+	defer m.q.mu.Unlock()
+	m.q.adds++
+}
+
+type observations struct {
+	q      *queueRecorder
+	values func(*queueRecorder) *[]float64
+}
+
+func (m observations) Observe(v float64) {
+	m.q.mu.Lock()
+	defer m.q.mu.Unlock()
+	values := m.values(m.q)
+	*values = append(*values, v)
+}
+
+type noopMetric struct{}
+
+func (noopMetric) Inc() {}
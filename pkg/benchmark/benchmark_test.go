@@ -0,0 +1,78 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	result, err := Run(Config{Foos: 20, Workers: 2, Scale: 5, Timeout: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Phases) != 2 {
+		t.Fatalf("expected sync and scale phases, got %+v", result.Phases)
+	}
+	// Every Foo is synced once to write its status, and once more when the
+	// status update is observed.
+	if sync := result.Phases[0]; sync.Reconciles < 20 {
+		t.Errorf("expected every foo to be reconciled, got %d reconciles", sync.Reconciles)
+	}
+	if scale := result.Phases[1]; scale.Reconciles < 5 {
+		t.Errorf("expected the scaled foos to be reconciled, got %d reconciles", scale.Reconciles)
+	}
+
+	var out bytes.Buffer
+	if err := result.WriteReport(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"sync", "scale", "20 foos, 2 workers"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+// BenchmarkController reports, besides the time and memory of each run, the
+// throughput and queue latency of the controller syncing every Foo after it
+// starts.
+func BenchmarkController(b *testing.B) {
+	for _, foos := range []int{100, 1000} {
+		for _, workers := range []int{2, 8} {
+			b.Run(fmt.Sprintf("foos=%d/workers=%d", foos, workers), func(b *testing.B) {
+				b.ReportAllocs()
+				var reconcilesPerSecond, p99 float64
+				for n := 0; n < b.N; n++ {
+					result, err := Run(Config{Foos: foos, Workers: workers})
+					if err != nil {
+						b.Fatal(err)
+					}
+					sync := result.Phases[0]
+					reconcilesPerSecond += sync.ReconcilesPerSecond()
+					p99 += float64(sync.QueueLatency.P99.Microseconds())
+				}
+				b.ReportMetric(reconcilesPerSecond/float64(b.N), "reconciles/s")
+				b.ReportMetric(p99/float64(b.N), "queue-p99-µs")
+			})
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// SuccessAdopted is used as part of the Event 'reason' when a Foo adopts
+	// an existing Deployment
+	SuccessAdopted = "Adopted"
+	// ErrAdoptionFailed is used as part of the Event 'reason' when a Foo is
+	// allowed to adopt an existing Deployment but cannot
+	ErrAdoptionFailed = "ErrAdoptionFailed"
+
+	// MessageAdopted is the message used for an Event fired when a Foo adopts
+	// an existing Deployment
+	MessageAdopted = "Adopted existing Deployment %q"
+	// MessageSelectorMismatch is the message used for an Event fired when an
+	// existing Deployment cannot be adopted because of its selector
+	MessageSelectorMismatch = "Deployment %q cannot be adopted: its selector %q does not match %q"
+)
+
+// claimDeployment checks that a Deployment found under one of the names of
+// the Foo belongs to it. A Deployment without a controller is adopted if the
+// adoption policy of the Foo allows it and its selector matches the one in
+// desired, since the selector of a Deployment cannot be changed afterwards.
+// Any other Deployment is reported as a conflict.
+func (p *planner) claimDeployment(deployment, desired *appsv1.Deployment) (*appsv1.Deployment, error) {
+	foo := p.foo
+	if metav1.IsControlledBy(deployment, foo) {
+		return deployment, nil
+	}
+	if metav1.GetControllerOf(deployment) != nil || foo.Spec.AdoptionPolicy != samplev1alpha1.AdoptionPolicyAdopt || foo.DeletionTimestamp != nil {
+		return nil, terminalError(ErrResourceExists, fmt.Errorf(MessageResourceExists, deployment.Name))
+	}
+
+	if !apiequality.Semantic.DeepEqual(deployment.Spec.Selector, desired.Spec.Selector) {
+		return nil, terminalError(ErrAdoptionFailed, fmt.Errorf(MessageSelectorMismatch, deployment.Name,
+			metav1.FormatLabelSelector(deployment.Spec.Selector), labels.FormatLabels(desired.Spec.Selector.MatchLabels)))
+	}
+
+	ref := *metav1.NewControllerRef(foo, samplev1alpha1.SchemeGroupVersion.WithKind("Foo"))
+	patch, err := ownerRefPatch(deployment.UID, ref)
+	if err != nil {
+		return nil, err
+	}
+	p.addAction(Action{
+		Type:   ActionPatch,
+		Object: deployment,
+		Patch:  patch,
+		Event:  &Event{Type: corev1.EventTypeNormal, Reason: SuccessAdopted, Message: fmt.Sprintf(MessageAdopted, deployment.Name)},
+	})
+	adopted := deployment.DeepCopy()
+	adopted.OwnerReferences = append(adopted.OwnerReferences, ref)
+	p.deployments[adopted.Name] = adopted
+	return adopted, nil
+}
+
+// releaseOwnedObjects removes the controller reference of the Foo from every
+// Deployment and Service it controls. It is used when the Foo is deleted with
+// the Orphan propagation policy, so that adopted workloads keep running
+// without an owner rather than waiting on the garbage collector. They are
+// annotated as released, so that the sweeper does not take them for leaked.
+func (p *planner) releaseOwnedObjects() error {
+	patch, err := releasePatch(p.foo)
+	if err != nil {
+		return err
+	}
+	for _, d := range p.observed.Deployments {
+		if metav1.IsControlledBy(d, p.foo) {
+			p.addAction(Action{Type: ActionPatch, Object: d, Patch: patch})
+		}
+	}
+	for _, s := range p.observed.Services {
+		if metav1.IsControlledBy(s, p.foo) {
+			p.addAction(Action{Type: ActionPatch, Object: s, Patch: patch})
+		}
+	}
+	return nil
+}
+
+// orphanRequested reports whether a Foo is being deleted with the Orphan
+// propagation policy.
+func orphanRequested(foo *samplev1alpha1.Foo) bool {
+	if foo.DeletionTimestamp == nil {
+		return false
+	}
+	for _, f := range foo.Finalizers {
+		if f == metav1.FinalizerOrphanDependents {
+			return true
+		}
+	}
+	return false
+}
+
+type objectForOwnerRefPatch struct {
+	Metadata objectMetaForOwnerRefPatch `json:"metadata"`
+}
+
+type objectMetaForOwnerRefPatch struct {
+	OwnerReferences []interface{} `json:"ownerReferences"`
+	// Annotations removes the released annotation of objects adopted again.
+	Annotations map[string]interface{} `json:"annotations"`
+	// UID makes the patch fail if the object was replaced since it was read.
+	UID types.UID `json:"uid"`
+}
+
+// ownerRefPatch returns a strategic merge patch adding ref to the owner
+// references of the object with the given UID.
+func ownerRefPatch(uid types.UID, ref metav1.OwnerReference) ([]byte, error) {
+	return json.Marshal(&objectForOwnerRefPatch{
+		Metadata: objectMetaForOwnerRefPatch{
+			OwnerReferences: []interface{}{ref},
+			Annotations:     map[string]interface{}{releasedAnnotation: nil},
+			UID:             uid,
+		},
+	})
+}
+
+// releasePatch returns a strategic merge patch removing the owner reference
+// to the Foo, and recording that the Foo released the object.
+func releasePatch(foo *samplev1alpha1.Foo) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []map[string]interface{}{
+				{"$patch": "delete", "uid": foo.UID},
+			},
+			"annotations": map[string]interface{}{
+				releasedAnnotation: foo.Name,
+			},
+		},
+	})
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// newOrphanDeployment returns the Deployment the Foo would create, without
+// an owner.
+func newOrphanDeployment(foo *samplecontroller.Foo) *apps.Deployment {
+	d := newDeployment(foo)
+	d.UID = "deployment-uid"
+	d.OwnerReferences = nil
+	return d
+}
+
+func TestAdoptDeployment(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	foo.UID = "foo-uid"
+	foo.Spec.AdoptionPolicy = samplecontroller.AdoptionPolicyAdopt
+	r := newRolloutFixture(t, foo, newOrphanDeployment(foo))
+
+	r.sync(foo)
+	d := r.deployment("test-deployment")
+	if !metav1.IsControlledBy(d, foo) {
+		t.Fatalf("expected deployment to be adopted, got owners %v", d.OwnerReferences)
+	}
+	r.expectReplicas("test-deployment", 2, defaultImage)
+}
+
+func TestAdoptDeploymentSelectorMismatch(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	foo.Spec.AdoptionPolicy = samplecontroller.AdoptionPolicyAdopt
+	d := newOrphanDeployment(foo)
+	d.Spec.Selector.MatchLabels = map[string]string{"app": "other"}
+	r := newRolloutFixture(t, foo, d)
+
+	if _, err := r.c.syncHandler(getKey(foo, t)); err == nil {
+		t.Fatalf("expected an error adopting a deployment with a different selector")
+	}
+	if owner := metav1.GetControllerOf(r.deployment("test-deployment")); owner != nil {
+		t.Errorf("expected deployment to be left alone, got controller %v", owner)
+	}
+}
+
+func TestAdoptDeploymentNever(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo, newOrphanDeployment(foo))
+
+	if _, err := r.c.syncHandler(getKey(foo, t)); err == nil {
+		t.Fatalf("expected an error for a deployment not controlled by the foo")
+	}
+	if owner := metav1.GetControllerOf(r.deployment("test-deployment")); owner != nil {
+		t.Errorf("expected deployment to be left alone, got controller %v", owner)
+	}
+}
+
+func TestOrphanOnDelete(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	foo.UID = "foo-uid"
+	now := metav1.Now()
+	foo.DeletionTimestamp = &now
+	foo.Finalizers = []string{metav1.FinalizerOrphanDependents}
+	d := newDeployment(foo)
+	d.UID = "deployment-uid"
+	r := newRolloutFixture(t, foo, d)
+
+	r.sync(foo)
+	if refs := r.deployment("test-deployment").OwnerReferences; len(refs) != 0 {
+		t.Errorf("expected deployment to be released, got owners %v", refs)
+	}
+	if name := r.deployment("test-deployment").Annotations[releasedAnnotation]; name != "test" {
+		t.Errorf("expected deployment to be annotated as released by test, got %q", name)
+	}
+}
+
+func TestOrphanDeploymentQueuesFoo(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	other := newFoo("other", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	r.i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Add(other)
+
+	r.c.handleObject(newOrphanDeployment(foo))
+	if got := r.c.workqueue.Len(); got != 1 {
+		t.Fatalf("expected 1 foo to be queued, got %d", got)
+	}
+	if key, _ := r.c.workqueue.Get(); key != getKey(foo, t) {
+		t.Errorf("expected %s to be queued, got %v", getKey(foo, t), key)
+	}
+}
+
+func TestDeploymentControlledElsewhereQueuesNothing(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+
+	d := newOrphanDeployment(foo)
+	d.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(&apps.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "rs"}}, apps.SchemeGroupVersion.WithKind("ReplicaSet"))}
+	r.c.handleObject(d)
+	if got := r.c.workqueue.Len(); got != 0 {
+		t.Errorf("expected no foo to be queued, got %d", got)
+	}
+}
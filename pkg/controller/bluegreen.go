@@ -0,0 +1,262 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// BlueGreenPromoted is used as part of the Event 'reason' when the
+	// Service of a blue/green Foo is switched to the preview color
+	BlueGreenPromoted = "BlueGreenPromoted"
+
+	// MessageBlueGreenPromoted is the message used for an Event fired when
+	// the Service of a blue/green Foo is switched to the preview color
+	MessageBlueGreenPromoted = "Service switched from %s to %s"
+)
+
+// colorLabel records the color of a blue/green Deployment on its pods, and is
+// what the managed Service selects on.
+const colorLabel = "samplecontroller.k8s.io/color"
+
+// planBlueGreen converges a Foo using the blue/green strategy. Two full
+// Deployments, one per color, are managed along with a Service selecting the
+// pods of the active color. When the pod template of the Foo changes, the
+// other color is brought up as a preview with the new template. Once it is
+// available and promoted, either explicitly or after the auto-promotion
+// delay, the Service is switched to it and the old color is scaled down. It
+// returns the resulting status of the Foo.
+func (p *planner) planBlueGreen() (*samplev1alpha1.FooStatus, syncResult, error) {
+	foo := p.foo
+	strategy := foo.Spec.Strategy.BlueGreen
+	total := p.desiredReplicaCount()
+
+	service := p.service(blueGreenServiceName(foo))
+	if service != nil && !metav1.IsControlledBy(service, foo) {
+		return nil, syncResult{}, terminalError(ErrResourceExists, fmt.Errorf(MessageResourceExists, service.Name))
+	}
+
+	// The Service selector is the source of truth for which color is
+	// active, since it is what actually routes traffic. The status is only
+	// consulted if the Service has not been created yet.
+	status := foo.Status.BlueGreen.DeepCopy()
+	if status == nil {
+		status = &samplev1alpha1.BlueGreenStatus{ActiveColor: samplev1alpha1.ColorBlue}
+	}
+	if service != nil {
+		if color := samplev1alpha1.Color(service.Spec.Selector[colorLabel]); color == samplev1alpha1.ColorBlue || color == samplev1alpha1.ColorGreen {
+			status.ActiveColor = color
+		}
+	}
+	previewColor := otherColor(status.ActiveColor)
+
+	desired := newColorDeployment(foo, status.ActiveColor, total)
+	active := p.deployment(desired.Name)
+	// The first pod template of a Foo goes straight to the active color;
+	// there is nothing to preview it against.
+	if active == nil {
+		active = p.createDeployment(desired)
+	}
+	active, err := p.claimDeployment(active, desired)
+	if err != nil {
+		return nil, syncResult{}, err
+	}
+
+	service = p.planBlueGreenService(service, status.ActiveColor)
+
+	if templateHashOf(active) == templateHashOf(desired) {
+		// No rollout in progress. A preview left behind by a reverted
+		// template change is no longer needed, and neither are the
+		// Deployments of the strategy the Foo used before, once the active
+		// color has taken over from them.
+		active = p.scaleDeployment(active, total)
+		p.scaleColorDeployment(previewColor, 0)
+		if deploymentComplete(active) {
+			p.deleteUnusedDeployments(colorDeploymentName(foo, samplev1alpha1.ColorBlue), colorDeploymentName(foo, samplev1alpha1.ColorGreen))
+		}
+		status.PreviewColor = ""
+		status.PreviewAvailableTime = nil
+		return p.blueGreenFooStatus(active, status, active), rolloutResult(active), nil
+	}
+
+	preview, err := p.planColorDeployment(previewColor, total)
+	if err != nil {
+		return nil, syncResult{}, err
+	}
+	if status.PreviewColor != previewColor {
+		status.PreviewAvailableTime = nil
+	}
+	status.PreviewColor = previewColor
+
+	if !deploymentComplete(preview) || templateHashOf(preview) != templateHashOf(desired) {
+		// The rollout of the preview Deployment is polled until it is
+		// available.
+		status.PreviewAvailableTime = nil
+		return p.blueGreenFooStatus(active, status, active, preview), rolloutResult(preview), nil
+	}
+	if status.PreviewAvailableTime == nil {
+		now := metav1.NewTime(p.now)
+		status.PreviewAvailableTime = &now
+	}
+
+	var result syncResult
+	promote := strategy.Promote
+	if delay := strategy.AutoPromotionDelay; !promote && delay != nil {
+		if remaining := delay.Duration - p.now.Sub(status.PreviewAvailableTime.Time); remaining > 0 {
+			result = requeueAfter(remaining)
+		} else {
+			promote = true
+		}
+	}
+	if !promote {
+		return p.blueGreenFooStatus(active, status, active), result, nil
+	}
+
+	p.planBlueGreenService(service, previewColor)
+	p.eventf(corev1.EventTypeNormal, BlueGreenPromoted, MessageBlueGreenPromoted, status.ActiveColor, previewColor)
+	p.scaleDeployment(active, 0)
+	status.ActiveColor = previewColor
+	status.PreviewColor = ""
+	status.PreviewAvailableTime = nil
+	return p.blueGreenFooStatus(preview, status, preview), rolloutResult(preview), nil
+}
+
+// blueGreenFooStatus returns the status of a blue/green Foo, with the rollout
+// conditions of the given Deployments.
+func (p *planner) blueGreenFooStatus(active *appsv1.Deployment, blueGreen *samplev1alpha1.BlueGreenStatus, deployments ...*appsv1.Deployment) *samplev1alpha1.FooStatus {
+	status := newFooStatus(p.foo, active.Status.AvailableReplicas)
+	status.BlueGreen = blueGreen
+	p.setRolloutConditions(status, deployments...)
+	return status
+}
+
+// planBlueGreenService creates or updates the Service of a blue/green Foo so
+// that it selects the pods of the given color.
+func (p *planner) planBlueGreenService(service *corev1.Service, color samplev1alpha1.Color) *corev1.Service {
+	desired := newBlueGreenService(p.foo, color)
+	if service == nil {
+		return p.createService(desired)
+	}
+	if reflect.DeepEqual(service.Spec.Selector, desired.Spec.Selector) {
+		return service
+	}
+	// NEVER modify objects from the store. Only the selector is owned by
+	// the controller; fields such as the cluster IP are left as they are.
+	serviceCopy := service.DeepCopy()
+	serviceCopy.Spec.Selector = desired.Spec.Selector
+	return p.updateService(serviceCopy)
+}
+
+// planColorDeployment creates or updates the Deployment of the given color so
+// it runs the desired pod template with the given number of replicas.
+func (p *planner) planColorDeployment(color samplev1alpha1.Color, replicas int32) (*appsv1.Deployment, error) {
+	desired := newColorDeployment(p.foo, color, replicas)
+	deployment := p.deployment(desired.Name)
+	if deployment == nil {
+		return p.createDeployment(desired), nil
+	}
+	deployment, err := p.claimDeployment(deployment, desired)
+	if err != nil {
+		return nil, err
+	}
+	if templateHashOf(deployment) != templateHashOf(desired) || deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != replicas {
+		return p.updateDeployment(deployment, desired), nil
+	}
+	return deployment, nil
+}
+
+// scaleColorDeployment scales the Deployment of the given color, if it exists
+// and is controlled by the Foo.
+func (p *planner) scaleColorDeployment(color samplev1alpha1.Color, replicas int32) {
+	deployment := p.deployment(colorDeploymentName(p.foo, color))
+	if deployment == nil || !metav1.IsControlledBy(deployment, p.foo) {
+		return
+	}
+	p.scaleDeployment(deployment, replicas)
+}
+
+func otherColor(color samplev1alpha1.Color) samplev1alpha1.Color {
+	if color == samplev1alpha1.ColorBlue {
+		return samplev1alpha1.ColorGreen
+	}
+	return samplev1alpha1.ColorBlue
+}
+
+func colorDeploymentName(foo *samplev1alpha1.Foo, color samplev1alpha1.Color) string {
+	return fmt.Sprintf("%s-%s", foo.Spec.DeploymentName, color)
+}
+
+func blueGreenServiceName(foo *samplev1alpha1.Foo) string {
+	if name := foo.Spec.Strategy.BlueGreen.ServiceName; name != "" {
+		return name
+	}
+	return foo.Spec.DeploymentName
+}
+
+// newColorDeployment creates the Deployment of the given color for a
+// blue/green Foo. It runs the same pod template as newDeployment, with an
+// extra color label the Service selects on.
+func newColorDeployment(foo *samplev1alpha1.Foo, color samplev1alpha1.Color, replicas int32) *appsv1.Deployment {
+	deployment := newDeployment(foo)
+	deployment.Name = colorDeploymentName(foo, color)
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.Selector.MatchLabels = map[string]string{colorLabel: string(color)}
+	deployment.Spec.Template.Labels = map[string]string{colorLabel: string(color)}
+	for k, v := range newDeployment(foo).Spec.Template.Labels {
+		deployment.Spec.Selector.MatchLabels[k] = v
+		deployment.Spec.Template.Labels[k] = v
+	}
+	return deployment
+}
+
+// newBlueGreenService creates the Service for a blue/green Foo, selecting the
+// pods of the given color. It also sets the appropriate OwnerReferences on
+// the resource so handleObject can discover the Foo resource that 'owns' it.
+func newBlueGreenService(foo *samplev1alpha1.Foo, color samplev1alpha1.Color) *corev1.Service {
+	selector := map[string]string{colorLabel: string(color)}
+	for k, v := range newDeployment(foo).Spec.Template.Labels {
+		selector[k] = v
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      blueGreenServiceName(foo),
+			Namespace: foo.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(foo, samplev1alpha1.SchemeGroupVersion.WithKind("Foo")),
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       80,
+					TargetPort: intstr.FromInt(80),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func newBlueGreenFoo(name string, replicas int32) *samplecontroller.Foo {
+	foo := newFoo(name, int32Ptr(replicas))
+	foo.Spec.Strategy = &samplecontroller.FooStrategy{
+		BlueGreen: &samplecontroller.BlueGreenStrategy{},
+	}
+	return foo
+}
+
+func (r *rolloutFixture) expectServiceColor(name string, color samplecontroller.Color) {
+	r.t.Helper()
+	svc, err := r.kubeclient.CoreV1().Services(metav1.NamespaceDefault).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		r.t.Fatalf("error getting service %s: %v", name, err)
+	}
+	if got := samplecontroller.Color(svc.Spec.Selector[colorLabel]); got != color {
+		r.t.Errorf("service %s: expected selector color %s, got %s", name, color, got)
+	}
+}
+
+func (r *rolloutFixture) expectBlueGreenStatus(name string, active, preview samplecontroller.Color) {
+	r.t.Helper()
+	status := r.foo(name).Status.BlueGreen
+	if status == nil {
+		r.t.Fatalf("expected blue/green status on foo %s", name)
+	}
+	if status.ActiveColor != active || status.PreviewColor != preview {
+		r.t.Errorf("expected active %q preview %q, got active %q preview %q", active, preview, status.ActiveColor, status.PreviewColor)
+	}
+}
+
+func TestBlueGreenExplicitPromotion(t *testing.T) {
+	foo := newBlueGreenFoo("test", 3)
+	r := newRolloutFixture(t, foo)
+
+	// The first template goes straight to blue.
+	r.sync(foo)
+	r.expectReplicas("test-deployment-blue", 3, defaultImage)
+	r.expectServiceColor("test-deployment", samplecontroller.ColorBlue)
+	r.expectBlueGreenStatus("test", samplecontroller.ColorBlue, "")
+	r.rollOut("test-deployment-blue")
+
+	// A changed template is previewed on green while blue keeps serving.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+	r.sync(foo)
+	r.expectReplicas("test-deployment-blue", 3, defaultImage)
+	r.expectReplicas("test-deployment-green", 3, "nginx:1.21")
+	r.expectServiceColor("test-deployment", samplecontroller.ColorBlue)
+	r.expectBlueGreenStatus("test", samplecontroller.ColorBlue, samplecontroller.ColorGreen)
+
+	// Being available is not enough without a promotion.
+	r.rollOut("test-deployment-green")
+	r.clock.Step(time.Hour)
+	r.sync(foo)
+	r.expectServiceColor("test-deployment", samplecontroller.ColorBlue)
+	if r.foo("test").Status.BlueGreen.PreviewAvailableTime == nil {
+		t.Errorf("expected preview available time to be recorded")
+	}
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.BlueGreen.Promote = true })
+	r.sync(foo)
+	r.expectServiceColor("test-deployment", samplecontroller.ColorGreen)
+	r.expectReplicas("test-deployment-blue", 0, defaultImage)
+	r.expectBlueGreenStatus("test", samplecontroller.ColorGreen, "")
+
+	// Once switched, green is the active color.
+	r.sync(foo)
+	r.expectServiceColor("test-deployment", samplecontroller.ColorGreen)
+	r.expectReplicas("test-deployment-green", 3, "nginx:1.21")
+	r.expectReplicas("test-deployment-blue", 0, defaultImage)
+	r.expectBlueGreenStatus("test", samplecontroller.ColorGreen, "")
+}
+
+func TestBlueGreenAutoPromotion(t *testing.T) {
+	foo := newBlueGreenFoo("test", 2)
+	foo.Spec.Strategy.BlueGreen.AutoPromotionDelay = &metav1.Duration{Duration: 10 * time.Minute}
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+	r.rollOut("test-deployment-blue")
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+	// The preview is polled while it rolls out, then the Foo is queued
+	// again when the delay runs out.
+	if got := r.sync(foo); got != rolloutPollInterval {
+		t.Errorf("expected foo to be queued again in %v, got %v", rolloutPollInterval, got)
+	}
+	r.rollOut("test-deployment-green")
+	if got := r.sync(foo); got != 10*time.Minute {
+		t.Errorf("expected foo to be queued again in 10m, got %v", got)
+	}
+	r.expectServiceColor("test-deployment", samplecontroller.ColorBlue)
+
+	r.clock.Step(5 * time.Minute)
+	if got := r.sync(foo); got != 5*time.Minute {
+		t.Errorf("expected foo to be queued again in 5m, got %v", got)
+	}
+	r.expectServiceColor("test-deployment", samplecontroller.ColorBlue)
+
+	r.clock.Step(5 * time.Minute)
+	r.sync(foo)
+	r.expectServiceColor("test-deployment", samplecontroller.ColorGreen)
+	r.expectReplicas("test-deployment-blue", 0, defaultImage)
+	r.expectBlueGreenStatus("test", samplecontroller.ColorGreen, "")
+}
+
+func TestBlueGreenServiceNotControlledByUs(t *testing.T) {
+	foo := newBlueGreenFoo("test", 1)
+	svc := newBlueGreenService(foo, samplecontroller.ColorBlue)
+	svc.OwnerReferences = nil
+
+	f := newFixture(t)
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.serviceLister = append(f.serviceLister, svc)
+	f.kubeobjects = append(f.kubeobjects, svc)
+
+	f.expectUpdateFooStatusAction(failedFoo(foo, ErrResourceExists, fmt.Sprintf(MessageResourceExists, svc.Name)))
+	f.runExpectError(getKey(foo, t))
+}
+
+func TestBlueGreenSwitchFromDefault(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	foo.UID = "foo-uid"
+	canary := newCanaryDeployment(foo, 1)
+	r := newRolloutFixture(t, foo, newDeployment(foo), canary)
+	r.rollOut("test-deployment")
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) {
+		foo.Spec.Strategy = &samplecontroller.FooStrategy{BlueGreen: &samplecontroller.BlueGreenStrategy{}}
+	})
+	r.sync(foo)
+	r.expectReplicas("test-deployment-blue", 2, defaultImage)
+	r.expectServiceColor("test-deployment", samplecontroller.ColorBlue)
+	if r.deployment("test-deployment") == nil {
+		t.Fatalf("deployment of the default strategy removed before blue finished rolling out")
+	}
+
+	r.rollOut("test-deployment-blue")
+	r.sync(foo)
+	for _, name := range []string{"test-deployment", "test-deployment-canary"} {
+		if r.deployment(name) != nil {
+			t.Errorf("expected deployment %s of the previous strategy to be removed", name)
+		}
+	}
+	r.expectReplicas("test-deployment-blue", 2, defaultImage)
+}
+
+func TestBlueGreenSwitchToDefault(t *testing.T) {
+	foo := newBlueGreenFoo("test", 2)
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+	r.rollOut("test-deployment-blue")
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+	r.sync(foo)
+	r.expectReplicas("test-deployment-green", 2, "nginx:1.21")
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy = nil })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, "nginx:1.21")
+	if r.deployment("test-deployment-blue") == nil {
+		t.Fatalf("blue deployment removed before the default strategy finished rolling out")
+	}
+
+	r.rollOut("test-deployment")
+	r.sync(foo)
+	for _, name := range []string{"test-deployment-blue", "test-deployment-green"} {
+		if r.deployment(name) != nil {
+			t.Errorf("expected deployment %s of the previous strategy to be removed", name)
+		}
+	}
+	if _, err := r.kubeclient.CoreV1().Services(metav1.NamespaceDefault).Get(context.TODO(), "test-deployment", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the service of the previous strategy to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// CanaryStepAdvanced is used as part of the Event 'reason' when a canary
+	// rollout moves on to its next step
+	CanaryStepAdvanced = "CanaryStepAdvanced"
+	// CanaryPromoted is used as part of the Event 'reason' when a canary is
+	// promoted to stable
+	CanaryPromoted = "CanaryPromoted"
+	// CanaryAborted is used as part of the Event 'reason' when a canary
+	// rollout is aborted
+	CanaryAborted = "CanaryAborted"
+
+	// MessageCanaryStepAdvanced is the message used for an Event fired when a
+	// canary rollout moves on to its next step
+	MessageCanaryStepAdvanced = "Canary advanced to step %d"
+	// MessageCanaryPromoted is the message used for an Event fired when a
+	// canary is promoted to stable
+	MessageCanaryPromoted = "Canary promoted to stable"
+	// MessageCanaryAborted is the message used for an Event fired when a
+	// canary rollout is aborted
+	MessageCanaryAborted = "Canary aborted, all replicas returned to stable"
+)
+
+const (
+	// trackLabel distinguishes the pods of the canary Deployment from those
+	// of the stable Deployment.
+	trackLabel = "samplecontroller.k8s.io/track"
+	// trackCanary is the value of trackLabel on canary pods.
+	trackCanary = "canary"
+)
+
+// planCanary converges a Foo using the canary strategy. The Deployment named
+// in the spec always runs the stable pod template. When the pod template of
+// the Foo changes, a second canary Deployment runs the new template and
+// replicas are shifted to it step by step until the canary is promoted, at
+// which point the stable Deployment is updated and the canary removed. It
+// returns the resulting status of the Foo.
+func (p *planner) planCanary() (*samplev1alpha1.FooStatus, syncResult, error) {
+	foo := p.foo
+	strategy := foo.Spec.Strategy.Canary
+	if err := validateCanaryStrategy(strategy); err != nil {
+		return nil, syncResult{}, terminalError(ErrInvalidSpec, err)
+	}
+
+	total := p.desiredReplicaCount()
+	desired := newDeployment(foo)
+	desired.Spec.Replicas = &total
+
+	stable := p.deployment(foo.Spec.DeploymentName)
+	// Without a stable Deployment there is nothing to shift replicas away
+	// from, so the first pod template is rolled out directly.
+	if stable == nil {
+		stable = p.createDeployment(desired)
+	}
+
+	stable, err := p.claimDeployment(stable, desired)
+	if err != nil {
+		return nil, syncResult{}, err
+	}
+
+	// Promote is meant for the rollout in progress when it was set. Once that
+	// rollout has been promoted, a Promote left set must not skip the steps
+	// of the next one.
+	promotedHash := ""
+	if strategy.Promote {
+		promotedHash = foo.Status.PromotedTemplateHash
+	}
+	promote := strategy.Promote && (promotedHash == "" || promotedHash == templateHashOf(desired))
+
+	// The stable Deployment already runs the desired template, so no rollout
+	// is in progress. A canary left over from a promotion, and the objects of
+	// a blue/green strategy the Foo used before, are only removed once the
+	// stable Deployment has finished rolling out, so that capacity does not
+	// drop in between.
+	if templateHashOf(stable) == templateHashOf(desired) {
+		stable = p.scaleDeployment(stable, total)
+		if deploymentComplete(stable) {
+			p.deleteUnusedDeployments(stable.Name)
+			p.deleteBlueGreenServices()
+		}
+		status := newFooStatus(foo, stable.Status.AvailableReplicas)
+		status.PromotedTemplateHash = promotedHash
+		p.setRolloutConditions(status, stable)
+		return status, rolloutResult(stable), nil
+	}
+
+	now := metav1.NewTime(p.now)
+	canaryStatus := foo.Status.Canary.DeepCopy()
+	if canaryStatus == nil || canaryStatus.TemplateHash != templateHashOf(desired) ||
+		(canaryStatus.Phase == samplev1alpha1.CanaryPhaseAborted && !strategy.Abort) {
+		canaryStatus = &samplev1alpha1.CanaryStatus{
+			TemplateHash:  templateHashOf(desired),
+			StepStartTime: &now,
+			Phase:         samplev1alpha1.CanaryPhaseProgressing,
+		}
+	}
+
+	if strategy.Abort {
+		stable = p.scaleDeployment(stable, total)
+		p.deleteCanaryDeployment()
+		if canaryStatus.Phase != samplev1alpha1.CanaryPhaseAborted {
+			p.event(corev1.EventTypeWarning, CanaryAborted, MessageCanaryAborted)
+		}
+		canaryStatus.Phase = samplev1alpha1.CanaryPhaseAborted
+		canaryStatus.StableReplicas = total
+		canaryStatus.CanaryReplicas = 0
+		status := newFooStatus(foo, stable.Status.AvailableReplicas)
+		status.Canary = canaryStatus
+		status.PromotedTemplateHash = promotedHash
+		p.setRolloutConditions(status, stable)
+		return status, rolloutResult(stable), nil
+	}
+
+	// Promoting clears the step state, so that the next rollout starts from
+	// the first step again.
+	if promote || int(canaryStatus.CurrentStepIndex) >= len(strategy.Steps) {
+		stable = p.updateDeployment(stable, desired)
+		p.event(corev1.EventTypeNormal, CanaryPromoted, MessageCanaryPromoted)
+		status := newFooStatus(foo, stable.Status.AvailableReplicas)
+		if strategy.Promote {
+			status.PromotedTemplateHash = templateHashOf(desired)
+		}
+		p.setRolloutConditions(status, stable)
+		return status, rolloutResult(stable), nil
+	}
+
+	step := strategy.Steps[canaryStatus.CurrentStepIndex]
+	canaryReplicas := canaryReplicaCount(total, step.Weight)
+	canary, err := p.planCanaryDeployment(canaryReplicas)
+	if err != nil {
+		return nil, syncResult{}, err
+	}
+	stable = p.scaleDeployment(stable, total-canaryReplicas)
+	canaryStatus.StableReplicas = total - canaryReplicas
+	canaryStatus.CanaryReplicas = canaryReplicas
+
+	// A step only counts as reached once the canary replicas are available.
+	// Until then, the rollout of the canary Deployment is polled.
+	canaryStatus.Phase = samplev1alpha1.CanaryPhaseProgressing
+	result := rolloutResult(stable, canary)
+	if canary.Status.AvailableReplicas >= canaryReplicas {
+		switch {
+		case step.Pause == nil:
+			canaryStatus.Phase = samplev1alpha1.CanaryPhasePaused
+		case p.now.Sub(canaryStatus.StepStartTime.Time) >= step.Pause.Duration:
+			// Writing the new step to the status queues the Foo again
+			// through its informer, which then applies the step.
+			canaryStatus.CurrentStepIndex++
+			canaryStatus.StepStartTime = &now
+			p.eventf(corev1.EventTypeNormal, CanaryStepAdvanced, MessageCanaryStepAdvanced, canaryStatus.CurrentStepIndex)
+		default:
+			result = result.merge(requeueAfter(step.Pause.Duration - p.now.Sub(canaryStatus.StepStartTime.Time)))
+		}
+	}
+
+	status := newFooStatus(foo, stable.Status.AvailableReplicas+canary.Status.AvailableReplicas)
+	status.Canary = canaryStatus
+	status.PromotedTemplateHash = promotedHash
+	p.setRolloutConditions(status, stable, canary)
+	return status, result, nil
+}
+
+// planCanaryDeployment creates or updates the canary Deployment of the Foo
+// so it runs the desired pod template with the given number of replicas.
+func (p *planner) planCanaryDeployment(replicas int32) (*appsv1.Deployment, error) {
+	desired := newCanaryDeployment(p.foo, replicas)
+	canary := p.deployment(desired.Name)
+	if canary == nil {
+		return p.createDeployment(desired), nil
+	}
+
+	canary, err := p.claimDeployment(canary, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	if templateHashOf(canary) != templateHashOf(desired) || canary.Spec.Replicas == nil || *canary.Spec.Replicas != replicas {
+		return p.updateDeployment(canary, desired), nil
+	}
+	return canary, nil
+}
+
+// deleteCanaryDeployment deletes the canary Deployment of the Foo, if there
+// is one controlled by the Foo.
+func (p *planner) deleteCanaryDeployment() {
+	canary := p.deployment(canaryDeploymentName(p.foo))
+	if canary != nil && metav1.IsControlledBy(canary, p.foo) {
+		p.deleteDeployment(canary)
+	}
+}
+
+// validateCanaryStrategy checks the parts of a canary strategy the CRD schema
+// cannot express.
+func validateCanaryStrategy(strategy *samplev1alpha1.CanaryStrategy) error {
+	if len(strategy.Steps) == 0 {
+		return fmt.Errorf("canary strategy must have at least one step")
+	}
+	for i, step := range strategy.Steps {
+		if step.Weight < 0 || step.Weight > 100 {
+			return fmt.Errorf("canary step %d: weight must be between 0 and 100, got %d", i, step.Weight)
+		}
+		if step.Pause != nil && step.Pause.Duration < 0 {
+			return fmt.Errorf("canary step %d: pause must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// canaryReplicaCount returns how many of total replicas run the canary at the
+// given weight. Any non-zero weight gets at least one replica so the canary
+// is exercised even for small Foos.
+func canaryReplicaCount(total, weight int32) int32 {
+	if weight <= 0 || total <= 0 {
+		return 0
+	}
+	replicas := (total*weight + 99) / 100
+	if replicas > total {
+		replicas = total
+	}
+	return replicas
+}
+
+// deploymentComplete reports whether a Deployment has finished rolling out
+// its current spec.
+func deploymentComplete(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+func canaryDeploymentName(foo *samplev1alpha1.Foo) string {
+	return foo.Spec.DeploymentName + "-canary"
+}
+
+// newCanaryDeployment creates the canary Deployment for a Foo. It runs the
+// same pod template as newDeployment, with an extra track label so that its
+// selector does not match the pods of the stable Deployment.
+func newCanaryDeployment(foo *samplev1alpha1.Foo, replicas int32) *appsv1.Deployment {
+	deployment := newDeployment(foo)
+	deployment.Name = canaryDeploymentName(foo)
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.Selector.MatchLabels = map[string]string{trackLabel: trackCanary}
+	deployment.Spec.Template.Labels = map[string]string{trackLabel: trackCanary}
+	for k, v := range newDeployment(foo).Spec.Template.Labels {
+		deployment.Spec.Selector.MatchLabels[k] = v
+		deployment.Spec.Template.Labels[k] = v
+	}
+	return deployment
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func newCanaryFoo(name string, replicas int32, steps ...samplecontroller.CanaryStep) *samplecontroller.Foo {
+	foo := newFoo(name, int32Ptr(replicas))
+	foo.Spec.Strategy = &samplecontroller.FooStrategy{
+		Canary: &samplecontroller.CanaryStrategy{Steps: steps},
+	}
+	return foo
+}
+
+func TestCanaryProgression(t *testing.T) {
+	foo := newCanaryFoo("test", 4,
+		samplecontroller.CanaryStep{Weight: 25, Pause: &metav1.Duration{Duration: time.Minute}},
+		samplecontroller.CanaryStep{Weight: 50},
+	)
+	stable := newDeployment(foo)
+	r := newRolloutFixture(t, foo, stable)
+	r.rollOut("test-deployment")
+
+	// Without a template change there is nothing to roll out.
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 4, defaultImage)
+	if r.deployment("test-deployment-canary") != nil {
+		t.Fatalf("unexpected canary deployment")
+	}
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+
+	// The first step moves one of four replicas to the canary.
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 3, defaultImage)
+	r.expectReplicas("test-deployment-canary", 1, "nginx:1.21")
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhaseProgressing)
+
+	// The pause only runs out once the canary is available and a minute
+	// has passed.
+	r.rollOut("test-deployment-canary")
+	r.sync(foo)
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhaseProgressing)
+	r.clock.Step(time.Minute)
+	r.sync(foo)
+	r.expectCanaryStatus("test", 1, samplecontroller.CanaryPhaseProgressing)
+
+	// The second step has no pause, so the rollout waits for promotion.
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, defaultImage)
+	r.expectReplicas("test-deployment-canary", 2, "nginx:1.21")
+	r.rollOut("test-deployment-canary")
+	r.sync(foo)
+	r.expectCanaryStatus("test", 1, samplecontroller.CanaryPhasePaused)
+	r.clock.Step(time.Hour)
+	r.sync(foo)
+	r.expectCanaryStatus("test", 1, samplecontroller.CanaryPhasePaused)
+
+	// Promotion updates the stable Deployment and keeps the canary until the
+	// stable Deployment has rolled out.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.Canary.Promote = true })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 4, "nginx:1.21")
+	if r.foo("test").Status.Canary != nil {
+		t.Errorf("expected canary status to be cleared after promotion")
+	}
+	r.sync(foo)
+	if r.deployment("test-deployment-canary") == nil {
+		t.Fatalf("canary deployment removed before stable finished rolling out")
+	}
+	r.rollOut("test-deployment")
+	r.sync(foo)
+	if r.deployment("test-deployment-canary") != nil {
+		t.Errorf("expected canary deployment to be removed")
+	}
+	r.expectReplicas("test-deployment", 4, "nginx:1.21")
+}
+
+func TestCanaryPromotedAfterLastStep(t *testing.T) {
+	foo := newCanaryFoo("test", 2,
+		samplecontroller.CanaryStep{Weight: 50, Pause: &metav1.Duration{Duration: time.Minute}},
+	)
+	r := newRolloutFixture(t, foo, newDeployment(foo))
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+
+	r.sync(foo)
+	r.rollOut("test-deployment-canary")
+	r.clock.Step(time.Minute)
+	r.sync(foo)
+	r.expectCanaryStatus("test", 1, samplecontroller.CanaryPhaseProgressing)
+
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, "nginx:1.21")
+	if r.foo("test").Status.Canary != nil {
+		t.Errorf("expected canary status to be cleared after promotion")
+	}
+}
+
+func TestCanaryRolloutAfterPromotion(t *testing.T) {
+	foo := newCanaryFoo("test", 4, samplecontroller.CanaryStep{Weight: 50})
+	r := newRolloutFixture(t, foo, newDeployment(foo))
+	r.rollOut("test-deployment")
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+	r.sync(foo)
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.Canary.Promote = true })
+	r.sync(foo)
+	r.rollOut("test-deployment")
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 4, "nginx:1.21")
+
+	// Promote was meant for the rollout it promoted, so the next pod template
+	// goes through the steps again while it is left set.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.22" })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, "nginx:1.21")
+	r.expectReplicas("test-deployment-canary", 2, "nginx:1.22")
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhaseProgressing)
+	r.rollOut("test-deployment-canary")
+	r.sync(foo)
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhasePaused)
+
+	// Setting Promote again after clearing it promotes the new rollout.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.Canary.Promote = false })
+	r.sync(foo)
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhasePaused)
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.Canary.Promote = true })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 4, "nginx:1.22")
+	if r.foo("test").Status.Canary != nil {
+		t.Errorf("expected canary status to be cleared after promotion")
+	}
+}
+
+func TestCanaryAbort(t *testing.T) {
+	foo := newCanaryFoo("test", 4,
+		samplecontroller.CanaryStep{Weight: 50},
+	)
+	r := newRolloutFixture(t, foo, newDeployment(foo))
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, defaultImage)
+	r.expectReplicas("test-deployment-canary", 2, "nginx:1.21")
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.Canary.Abort = true })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 4, defaultImage)
+	if r.deployment("test-deployment-canary") != nil {
+		t.Errorf("expected canary deployment to be removed")
+	}
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhaseAborted)
+
+	// Clearing abort starts the rollout again from the first step.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Strategy.Canary.Abort = false })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, defaultImage)
+	r.expectReplicas("test-deployment-canary", 2, "nginx:1.21")
+	r.expectCanaryStatus("test", 0, samplecontroller.CanaryPhaseProgressing)
+}
+
+func TestCanaryReplicaCount(t *testing.T) {
+	tests := []struct {
+		total, weight, expected int32
+	}{
+		{total: 4, weight: 0, expected: 0},
+		{total: 4, weight: 25, expected: 1},
+		{total: 4, weight: 30, expected: 2},
+		{total: 1, weight: 10, expected: 1},
+		{total: 10, weight: 100, expected: 10},
+		{total: 0, weight: 50, expected: 0},
+	}
+	for _, test := range tests {
+		if got := canaryReplicaCount(test.total, test.weight); got != test.expected {
+			t.Errorf("canaryReplicaCount(%d, %d) = %d, expected %d", test.total, test.weight, got, test.expected)
+		}
+	}
+}
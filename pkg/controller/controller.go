@@ -0,0 +1,800 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controller implements the controller for Foo resources. It can be
+// embedded in any binary with NewController; the sample-controller command
+// only sets it up from flags.
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/rand"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/klogr"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+	samplescheme "k8s.io/sample-controller/pkg/generated/clientset/versioned/scheme"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions/samplecontroller/v1alpha1"
+	listers "k8s.io/sample-controller/pkg/generated/listers/samplecontroller/v1alpha1"
+)
+
+const controllerAgentName = "sample-controller"
+
+const (
+	// defaultImage is the container image used when a Foo does not set one.
+	defaultImage = samplev1alpha1.DefaultImage
+	// templateHashAnnotation records on each Deployment the hash of the pod
+	// template it was built from, so template changes can be detected
+	// without comparing objects defaulted by the apiserver.
+	templateHashAnnotation = "samplecontroller.k8s.io/template-hash"
+	// releasedAnnotation records on the objects a Foo released when it was
+	// deleted with the Orphan propagation policy the name of that Foo.
+	releasedAnnotation = "samplecontroller.k8s.io/released-by"
+)
+
+const (
+	// SuccessSynced is used as part of the Event 'reason' when a Foo is synced
+	// for the first time, or again after an error
+	SuccessSynced = "Synced"
+	// SuccessCreated is used as part of the Event 'reason' when a Foo creates
+	// one of its objects
+	SuccessCreated = "Created"
+	// SuccessScaled is used as part of the Event 'reason' when a Foo changes
+	// the replicas of one of its Deployments
+	SuccessScaled = "Scaled"
+	// SuccessUpdated is used as part of the Event 'reason' when a Foo changes
+	// the pod template of one of its Deployments
+	SuccessUpdated = "Updated"
+	// ErrResourceExists is used as part of the Event 'reason' when a Foo fails
+	// to sync due to a Deployment of the same name already existing.
+	ErrResourceExists = "ErrResourceExists"
+	// ErrSyncFailed is used as part of the Event 'reason' when a Foo fails to
+	// sync for any other reason
+	ErrSyncFailed = "SyncFailed"
+	// ErrInvalidSpec is used as part of the Event 'reason' when a Foo cannot
+	// be synced because its spec is invalid
+	ErrInvalidSpec = "InvalidSpec"
+	// RetriesExhausted is used as part of the Event 'reason' when the
+	// controller stops retrying a Foo that keeps failing to sync
+	RetriesExhausted = "RetriesExhausted"
+
+	// MessageResourceExists is the message used for Events when a resource
+	// fails to sync due to a Deployment already existing
+	MessageResourceExists = "Resource %q already exists and is not managed by Foo"
+	// MessageResourceSynced is the message used for an Event fired when a Foo
+	// is synced successfully
+	MessageResourceSynced = "Foo synced successfully"
+	// MessageResourceCreated is the message used for an Event fired when a
+	// Foo creates one of its objects
+	MessageResourceCreated = "Created %s %q"
+	// MessageDeploymentScaled is the message used for an Event fired when a
+	// Foo changes the replicas of one of its Deployments
+	MessageDeploymentScaled = "Scaled Deployment %q from %d to %d replicas"
+	// MessageDeploymentUpdated is the message used for an Event fired when a
+	// Foo changes the pod template of one of its Deployments
+	MessageDeploymentUpdated = "Updated the pod template of Deployment %q"
+	// MessageRetriesExhausted is the message used for an Event fired when the
+	// controller stops retrying a Foo
+	MessageRetriesExhausted = "Giving up after %d retries: %v"
+)
+
+// DefaultMaxRetries is how many times a Foo failing with transient errors is
+// retried before it is marked Stalled, unless Options.MaxRetries says
+// otherwise. With the default rate limiter the last retries are about ten
+// minutes apart.
+const DefaultMaxRetries = 17
+
+// Options configures a Controller. The clientsets and the Deployment, Service
+// and Foo informers are required; everything else has a default.
+type Options struct {
+	// KubeClientset is a standard kubernetes clientset.
+	KubeClientset kubernetes.Interface
+	// SampleClientset is a clientset for our own API group.
+	SampleClientset clientset.Interface
+
+	DeploymentInformer appsinformers.DeploymentInformer
+	ServiceInformer    coreinformers.ServiceInformer
+	FooInformer        informers.FooInformer
+	// PodInformer makes the controller summarize the pods of each Foo in its
+	// status when set. It should be restricted to PodLabelSelector, so that
+	// the controller does not cache every pod in the cluster.
+	PodInformer coreinformers.PodInformer
+	// OwnedInformers watch other kinds of objects Foos may control, such as
+	// ConfigMaps users hand over to a Foo. Only their ownership matters: a
+	// change to one queues the Foo that controls it, as for Deployments and
+	// Services. NewMetadataInformer returns informers that cache nothing
+	// else. They must be started by the caller, like the other informers.
+	OwnedInformers []cache.SharedIndexInformer
+
+	// Recorder records the Events of the controller as core/v1 Events.
+	// When neither it nor EventsRecorder is set, Events are sent to the API
+	// server through KubeClientset.
+	Recorder record.EventRecorder
+	// EventsRecorder records the Events of the controller through the
+	// events.k8s.io/v1 API, with the action of their reason in
+	// EventReasons, and the Deployment or Service written as their related
+	// object. It takes precedence over Recorder.
+	EventsRecorder events.EventRecorder
+	// UseEventsAPI makes the controller send its Events through the
+	// events.k8s.io/v1 API when no recorder is set, where repeated Events
+	// are aggregated in series.
+	UseEventsAPI bool
+	// EventCorrelator caps the Events recorded about each Foo when set.
+	EventCorrelator *EventCorrelatorOptions
+	// Clock is used for time-based decisions such as schedules and canary
+	// step pauses. It defaults to the real clock.
+	Clock clock.Clock
+	// Logger is used for everything the controller logs. It defaults to a
+	// logger writing to klog.
+	Logger logr.Logger
+	// MaxRetries is how many times a Foo failing with transient errors is
+	// retried before it is marked Stalled. It defaults to DefaultMaxRetries.
+	MaxRetries int
+	// MetricsProvider creates the metrics of the controller. It defaults to
+	// the provider set with SetMetricsProvider.
+	MetricsProvider MetricsProvider
+	// Sweep makes the controller sweep the Deployments leaked by Foos that
+	// no longer exist when set.
+	Sweep *SweepOptions
+}
+
+// Controller is the controller implementation for Foo resources
+type Controller struct {
+	// kubeclientset is a standard kubernetes clientset
+	kubeclientset kubernetes.Interface
+	// sampleclientset is a clientset for our own API group
+	sampleclientset clientset.Interface
+
+	deploymentsLister appslisters.DeploymentLister
+	deploymentsSynced cache.InformerSynced
+	servicesLister    corelisters.ServiceLister
+	servicesSynced    cache.InformerSynced
+	foosLister        listers.FooLister
+	foosSynced        cache.InformerSynced
+	// podsLister and podsSynced are only set when pod summaries are
+	// enabled, see Options.PodInformer.
+	podsLister corelisters.PodLister
+	podsSynced cache.InformerSynced
+	// ownedSynced holds whether each of Options.OwnedInformers has synced.
+	ownedSynced []cache.InformerSynced
+	// deploymentIndex and serviceIndex are the indexers of the Deployment
+	// and Service informers, which index objects by controllerIndex.
+	deploymentIndex cache.Indexer
+	serviceIndex    cache.Indexer
+
+	// workqueue is a rate limited work queue. This is used to queue work to be
+	// processed instead of performing it as soon as a change happens. This
+	// means we can ensure we only process a fixed amount of resources at a
+	// time, and makes it easy to ensure we are never processing the same item
+	// simultaneously in two different workers. It is a fairQueue, so that
+	// namespaces take turns and changes users make go first.
+	workqueue workqueue.RateLimitingInterface
+	// recorder is an event recorder for recording Event resources to the
+	// Kubernetes API.
+	recorder eventRecorder
+	// startRecording starts sending Events to the API server, when the
+	// controller created the broadcaster of its recorder itself.
+	startRecording func(stopCh <-chan struct{})
+	// correlator caps the Events recorded about each Foo. It is nil when
+	// Events are not capped.
+	correlator *eventCorrelator
+	// clock is used for time-based decisions such as canary step pauses.
+	clock  clock.Clock
+	logger logr.Logger
+	// maxRetries is how many times a Foo failing with transient errors is
+	// retried before it is marked Stalled.
+	maxRetries int
+	metrics    *syncMetrics
+	// expectations holds back Foos until the informers have observed the
+	// writes of their last sync.
+	expectations *expectations
+	// sweeper is only set when sweeping leaked Deployments is enabled, see
+	// Options.Sweep.
+	sweeper *sweeper
+	// started is when the controller was created. Foos created before then
+	// are synced in the background, see addPriority.
+	started time.Time
+}
+
+// NewController returns a new sample controller. The informers it is given
+// must be started by the caller, before or after Run is called.
+func NewController(opts Options) (*Controller, error) {
+	switch {
+	case opts.KubeClientset == nil:
+		return nil, fmt.Errorf("a kubernetes clientset is required")
+	case opts.SampleClientset == nil:
+		return nil, fmt.Errorf("a sample clientset is required")
+	case opts.DeploymentInformer == nil || opts.ServiceInformer == nil || opts.FooInformer == nil:
+		return nil, fmt.Errorf("deployment, service and foo informers are required")
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = klogr.New()
+	}
+	logger = logger.WithName(controllerAgentName)
+
+	var recorder eventRecorder
+	var startRecording func(<-chan struct{})
+	switch {
+	case opts.EventsRecorder != nil:
+		recorder = eventsAPIRecorder{opts.EventsRecorder}
+	case opts.Recorder != nil:
+		recorder = legacyRecorder{opts.Recorder}
+	case opts.UseEventsAPI:
+		utilruntime.Must(samplescheme.AddToScheme(scheme.Scheme))
+		logger.V(4).Info("Creating events.k8s.io/v1 event broadcaster")
+		eventBroadcaster := events.NewBroadcaster(&events.EventSinkImpl{Interface: opts.KubeClientset.EventsV1()})
+		// The broadcaster only records to its sink once started, which
+		// needs the stop channel given to Run.
+		startRecording = eventBroadcaster.StartRecordingToSink
+		recorder = eventsAPIRecorder{eventBroadcaster.NewRecorder(scheme.Scheme, controllerAgentName)}
+	default:
+		// Create event broadcaster
+		// Add sample-controller types to the default Kubernetes Scheme so Events can be
+		// logged for sample-controller types.
+		utilruntime.Must(samplescheme.AddToScheme(scheme.Scheme))
+		logger.V(4).Info("Creating event broadcaster")
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartStructuredLogging(0)
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: opts.KubeClientset.CoreV1().Events("")})
+		recorder = legacyRecorder{eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})}
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	maxRetries := opts.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	metricsProvider := opts.MetricsProvider
+	if metricsProvider == nil {
+		metricsProvider = globalMetricsProvider
+	}
+
+	deploymentInformer, serviceInformer, fooInformer := opts.DeploymentInformer, opts.ServiceInformer, opts.FooInformer
+	// Deployments that no Foo controls are matched to the Foos that want
+	// them through the indexes of the Foo informer.
+	if err := listers.AddFooIndexers(fooInformer.Informer()); err != nil {
+		return nil, fmt.Errorf("adding foo indexers: %v", err)
+	}
+	// The objects a Foo controls are looked up by its UID when it is synced.
+	for _, informer := range []cache.SharedIndexInformer{deploymentInformer.Informer(), serviceInformer.Informer()} {
+		if err := addControllerIndex(informer); err != nil {
+			return nil, fmt.Errorf("adding controller index: %v", err)
+		}
+	}
+	controller := &Controller{
+		kubeclientset:     opts.KubeClientset,
+		sampleclientset:   opts.SampleClientset,
+		deploymentsLister: deploymentInformer.Lister(),
+		deploymentsSynced: deploymentInformer.Informer().HasSynced,
+		deploymentIndex:   deploymentInformer.Informer().GetIndexer(),
+		servicesLister:    serviceInformer.Lister(),
+		servicesSynced:    serviceInformer.Informer().HasSynced,
+		serviceIndex:      serviceInformer.Informer().GetIndexer(),
+		foosLister:        fooInformer.Lister(),
+		foosSynced:        fooInformer.Informer().HasSynced,
+		workqueue:         newFairQueue(workqueue.DefaultControllerRateLimiter(), clk, metricsProvider),
+		recorder:          recorder,
+		startRecording:    startRecording,
+		clock:             clk,
+		logger:            logger,
+		maxRetries:        maxRetries,
+		metrics:           newSyncMetrics(metricsProvider),
+		expectations:      newExpectations(),
+		started:           clk.Now(),
+	}
+
+	logger.Info("Setting up event handlers")
+	// Set up an event handler for when Foo resources change. Foos users
+	// create or change the spec of go ahead of resyncs and of the updates
+	// the controller makes to their status.
+	fooInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			controller.enqueueFooWithPriority(obj, controller.addPriority(obj.(*samplev1alpha1.Foo)))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueFooWithPriority(new, updatePriority(old.(*samplev1alpha1.Foo), new.(*samplev1alpha1.Foo)))
+		},
+	})
+	// Set up an event handler for when Deployment resources change. This
+	// handler will lookup the owner of the given Deployment, and if it is
+	// owned by a Foo resource then the handler will enqueue that Foo resource for
+	// processing. This way, we don't need to implement custom logic for
+	// handling Deployment resources. More info on this pattern:
+	// https://github.com/kubernetes/community/blob/8cafef897a22026d42f5e5bb3f104febe7e29830/contributors/devel/controllers.md
+	deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newDepl := new.(*appsv1.Deployment)
+			oldDepl := old.(*appsv1.Deployment)
+			if newDepl.ResourceVersion == oldDepl.ResourceVersion {
+				// Periodic resync will send update events for all known Deployments.
+				// Two different versions of the same Deployment will always have different RVs.
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+	// Services are only managed for Foos using the blue/green strategy, and
+	// are handled the same way as Deployments.
+	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newSvc := new.(*corev1.Service)
+			oldSvc := old.(*corev1.Service)
+			if newSvc.ResourceVersion == oldSvc.ResourceVersion {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+	// Other objects Foos control are handled the same way too.
+	for _, informer := range opts.OwnedInformers {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handleObject,
+			UpdateFunc: func(old, new interface{}) {
+				newObj, newErr := meta.Accessor(new)
+				oldObj, oldErr := meta.Accessor(old)
+				if newErr == nil && oldErr == nil && newObj.GetResourceVersion() == oldObj.GetResourceVersion() {
+					return
+				}
+				controller.handleObject(new)
+			},
+			DeleteFunc: controller.handleObject,
+		})
+		controller.ownedSynced = append(controller.ownedSynced, informer.HasSynced)
+	}
+	if opts.PodInformer != nil {
+		controller.enablePodSummary(opts.PodInformer)
+	}
+	if opts.Sweep != nil {
+		controller.sweeper = newSweeper(*opts.Sweep, metricsProvider)
+	}
+	if opts.EventCorrelator != nil {
+		controller.correlator = newEventCorrelator(*opts.EventCorrelator, clk)
+	}
+
+	return controller, nil
+}
+
+// Run will set up the event handlers for types we are interested in, as well
+// as syncing informer caches and starting workers. It will block until stopCh
+// is closed, at which point it will shutdown the workqueue and wait for
+// workers to finish processing their current work items.
+func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	// Start the informer factories to begin populating the informer caches
+	c.logger.Info("Starting Foo controller")
+	if c.startRecording != nil {
+		c.startRecording(stopCh)
+	}
+
+	// Wait for the caches to be synced before starting workers
+	c.logger.Info("Waiting for informer caches to sync")
+	cacheSyncs := []cache.InformerSynced{c.deploymentsSynced, c.servicesSynced, c.foosSynced}
+	if c.podsSynced != nil {
+		cacheSyncs = append(cacheSyncs, c.podsSynced)
+	}
+	cacheSyncs = append(cacheSyncs, c.ownedSynced...)
+	if ok := cache.WaitForCacheSync(stopCh, cacheSyncs...); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	c.logger.Info("Starting workers", "count", workers)
+	// Launch two workers to process Foo resources
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	if c.sweeper != nil {
+		c.logger.Info("Starting sweeper", "interval", c.sweeper.opts.Interval, "gracePeriod", c.sweeper.opts.GracePeriod, "reportOnly", c.sweeper.opts.ReportOnly)
+		go wait.Until(c.sweepLeakedDeployments, c.sweeper.opts.Interval, stopCh)
+	}
+
+	c.logger.Info("Started workers")
+	<-stopCh
+	c.logger.Info("Shutting down workers")
+
+	return nil
+}
+
+// runWorker is a long-running function that will continually call the
+// processNextWorkItem function in order to read and process a message on the
+// workqueue.
+func (c *Controller) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem will read a single work item off the workqueue and
+// attempt to process it, by calling the syncHandler.
+func (c *Controller) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	// We wrap this block in a func so we can defer c.workqueue.Done.
+	err := func(obj interface{}) error {
+		// We call Done here so the workqueue knows we have finished
+		// processing this item. We also must remember to call Forget if we
+		// do not want this work item being re-queued. For example, we do
+		// not call Forget if a transient error occurs, instead the item is
+		// put back on the workqueue and attempted again after a back-off
+		// period.
+		defer c.workqueue.Done(obj)
+		var key string
+		var ok bool
+		// We expect strings to come off the workqueue. These are of the
+		// form namespace/name. We do this as the delayed nature of the
+		// workqueue means the items in the informer cache may actually be
+		// more up to date that when the item was initially put onto the
+		// workqueue.
+		if key, ok = obj.(string); !ok {
+			// As the item in the workqueue is actually invalid, we call
+			// Forget here else we'd go into a loop of attempting to
+			// process a work item that is invalid.
+			c.workqueue.Forget(obj)
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			return nil
+		}
+		// Run the syncHandler, passing it the namespace/name string of the
+		// Foo resource to be synced.
+		result, err := c.syncHandler(key)
+		if err != nil {
+			return c.handleSyncError(key, err)
+		}
+		// Finally, if no error occurs we Forget this item so it does not
+		// get queued again until another change happens, or until the
+		// syncHandler asked to check back on it.
+		c.workqueue.Forget(obj)
+		if result.requeueAfter > 0 {
+			c.workqueue.AddAfter(key, result.requeueAfter)
+		}
+		c.logger.Info("Successfully synced", "foo", key)
+		return nil
+	}(obj)
+
+	if err != nil {
+		utilruntime.HandleError(err)
+		return true
+	}
+
+	return true
+}
+
+// handleSyncError decides whether and when a Foo that failed to sync is
+// retried, depending on the class of the error. It returns the error to log.
+func (c *Controller) handleSyncError(key string, err error) error {
+	class, after := classifyError(err)
+	c.metrics.syncErrors[class].Inc()
+	switch class {
+	case errorClassTerminal:
+		// The Foo has already been marked Stalled. It is queued again when
+		// it, or an object it owns, changes.
+		c.workqueue.Forget(key)
+		return fmt.Errorf("error syncing '%s': %s, not requeuing", key, err.Error())
+	case errorClassRequeueAfter:
+		c.workqueue.Forget(key)
+		c.workqueue.AddAfter(key, after)
+		return fmt.Errorf("error syncing '%s': %s, requeuing in %v", key, err.Error(), after)
+	}
+	if c.workqueue.NumRequeues(key) < c.maxRetries {
+		// Put the item back on the workqueue to handle any transient errors.
+		c.workqueue.AddRateLimited(key)
+		return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+	}
+	c.workqueue.Forget(key)
+	if stallErr := c.markStalled(key, err); stallErr != nil {
+		utilruntime.HandleError(fmt.Errorf("error marking foo '%s' stalled: %v", key, stallErr))
+	}
+	return fmt.Errorf("error syncing '%s': %s, giving up after %d retries", key, err.Error(), c.maxRetries)
+}
+
+// markStalled records in the Stalled condition of a Foo that the controller
+// has stopped retrying it, and the last error it failed with.
+func (c *Controller) markStalled(key string, err error) error {
+	namespace, name, splitErr := cache.SplitMetaNamespaceKey(key)
+	if splitErr != nil {
+		return splitErr
+	}
+	foo, getErr := c.foosLister.Foos(namespace).Get(name)
+	if errors.IsNotFound(getErr) {
+		return nil
+	}
+	if getErr != nil {
+		return getErr
+	}
+	p := newPlanner(foo, nil, c.clock.Now())
+	status := foo.Status.DeepCopy()
+	p.setCondition(status, samplev1alpha1.FooConditionStalled, metav1.ConditionTrue, RetriesExhausted, err.Error())
+	p.setStatus(status)
+	p.eventf(corev1.EventTypeWarning, RetriesExhausted, MessageRetriesExhausted, c.maxRetries, err)
+	_, execErr := c.execute(foo, p.plan)
+	return execErr
+}
+
+// syncHandler compares the actual state with the desired, and attempts to
+// converge the two by planning the changes with PlanSync and executing the
+// plan. It then updates the Status block of the Foo resource with the current
+// status of the resource, and returns when the Foo should be synced again.
+func (c *Controller) syncHandler(key string) (syncResult, error) {
+	// Convert the namespace/name string into a distinct namespace and name
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return syncResult{}, nil
+	}
+
+	// Get the Foo resource with this namespace/name
+	foo, err := c.foosLister.Foos(namespace).Get(name)
+	if err != nil {
+		// The Foo resource may no longer exist, in which case we stop
+		// processing.
+		if errors.IsNotFound(err) {
+			c.expectations.delete(key)
+			if c.correlator != nil {
+				c.correlator.forget(key)
+			}
+			utilruntime.HandleError(fmt.Errorf("foo '%s' in work queue no longer exists", key))
+			return syncResult{}, nil
+		}
+
+		return syncResult{}, err
+	}
+
+	// Until the informers have observed the writes of the last sync, the
+	// Foo would be planned from stale objects. Observing them queues the
+	// Foo again.
+	wait, err := c.expectations.pending(key, c.clock.Now(), c.cachedResourceVersion)
+	if err != nil {
+		return syncResult{}, err
+	}
+	if wait > 0 {
+		c.logger.V(4).Info("Waiting for the writes of the last sync to be observed", "foo", key)
+		return requeueAfter(wait), nil
+	}
+
+	observed, err := c.observe(foo)
+	if err != nil {
+		return syncResult{}, err
+	}
+	return c.execute(foo, PlanSync(foo, observed, c.clock.Now()))
+}
+
+// newFooStatus returns a copy of the status of a Foo, with the fields set by
+// the rollout strategies reset.
+func newFooStatus(foo *samplev1alpha1.Foo, availableReplicas int32) *samplev1alpha1.FooStatus {
+	status := foo.Status.DeepCopy()
+	status.AvailableReplicas = availableReplicas
+	status.Canary = nil
+	status.PromotedTemplateHash = ""
+	status.BlueGreen = nil
+	return status
+}
+
+func (c *Controller) updateFooStatus(foo *samplev1alpha1.Foo, status *samplev1alpha1.FooStatus) error {
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	// You can use DeepCopy() to make a deep copy of original object and modify this copy
+	// Or create a copy manually for better performance
+	fooCopy := foo.DeepCopy()
+	fooCopy.Status = *status
+	// UpdateStatus will not allow changes to the Spec of the resource,
+	// which is ideal for ensuring nothing other than resource status has been updated.
+	// It needs the status subresource of the CRD. Without it, every status
+	// write would bump the generation of the Foo, and with it the observed
+	// generation of its conditions, so that the status never settles.
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().Foos(foo.Namespace).UpdateStatus(context.TODO(), fooCopy, metav1.UpdateOptions{})
+	return err
+}
+
+// addPriority returns the priority of a Foo the informer adds. Foos created
+// before the controller started come from its initial list, and would all go
+// ahead of the Foos users create meanwhile. Creation times only have a
+// precision of a second, so Foos created in the second the controller started
+// count as new.
+func (c *Controller) addPriority(foo *samplev1alpha1.Foo) priority {
+	if foo.CreationTimestamp.Time.Before(c.started.Truncate(time.Second)) {
+		return priorityBackground
+	}
+	return priorityUser
+}
+
+// updatePriority returns the priority of an update of a Foo: only changes to
+// its spec are made by users.
+func updatePriority(old, new *samplev1alpha1.Foo) priority {
+	if apiequality.Semantic.DeepEqual(old.Spec, new.Spec) {
+		return priorityBackground
+	}
+	return priorityUser
+}
+
+// enqueueFoo takes a Foo resource and converts it into a namespace/name
+// string which is then put onto the work queue. This method should *not* be
+// passed resources of any type other than Foo.
+func (c *Controller) enqueueFoo(obj interface{}) {
+	c.enqueueFooWithPriority(obj, priorityBackground)
+}
+
+// enqueueFooWithPriority is enqueueFoo for a queue that syncs some Foos
+// first. Other queues ignore the priority.
+func (c *Controller) enqueueFooWithPriority(obj interface{}, p priority) {
+	var key string
+	var err error
+	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if queue, ok := c.workqueue.(prioritizedQueue); ok {
+		queue.addWithPriority(key, p)
+		return
+	}
+	c.workqueue.Add(key)
+}
+
+// handleObject will take any resource implementing metav1.Object and attempt
+// to find the Foo resource that 'owns' it. It does this by looking at the
+// objects metadata.ownerReferences field for an appropriate OwnerReference.
+// It then enqueues that Foo resource to be processed. A Deployment without
+// any controller enqueues the Foos that want its name instead, as they may
+// adopt it or report the conflict. Any other object is skipped.
+func (c *Controller) handleObject(obj interface{}) {
+	var object metav1.Object
+	var ok bool
+	if object, ok = obj.(metav1.Object); !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		object, ok = tombstone.Obj.(metav1.Object)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+		c.logger.V(4).Info("Recovered deleted object from tombstone", "object", klog.KObj(object))
+	}
+	c.logger.V(4).Info("Processing object", "object", klog.KObj(object))
+	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
+		// If this object is not owned by a Foo, we should not do anything more
+		// with it.
+		if ownerRef.Kind != "Foo" {
+			return
+		}
+
+		foo, err := c.foosLister.Foos(object.GetNamespace()).Get(ownerRef.Name)
+		if err != nil {
+			c.logger.V(4).Info("Ignoring orphaned object", "object", klog.KObj(object), "foo", ownerRef.Name)
+			return
+		}
+
+		c.enqueueFoo(foo)
+		return
+	}
+	if _, ok := object.(*appsv1.Deployment); !ok {
+		return
+	}
+	foos, err := c.foosLister.Foos(object.GetNamespace()).ByDeploymentName(object.GetName())
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("error listing foos for deployment %s/%s: %v", object.GetNamespace(), object.GetName(), err))
+		return
+	}
+	for _, foo := range foos {
+		c.enqueueFoo(foo)
+	}
+}
+
+// newDeployment creates a new Deployment for a Foo resource. It also sets
+// the appropriate OwnerReferences on the resource so handleObject can discover
+// the Foo resource that 'owns' it.
+func newDeployment(foo *samplev1alpha1.Foo) *appsv1.Deployment {
+	labels := map[string]string{
+		"app":        "nginx",
+		"controller": foo.Name,
+	}
+	image := foo.Spec.Image
+	if image == "" {
+		image = defaultImage
+	}
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "nginx",
+					Image: image,
+				},
+			},
+		},
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      foo.Spec.DeploymentName,
+			Namespace: foo.Namespace,
+			Annotations: map[string]string{
+				templateHashAnnotation: computeTemplateHash(&template),
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(foo, samplev1alpha1.SchemeGroupVersion.WithKind("Foo")),
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: foo.Spec.Replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: template,
+		},
+	}
+}
+
+// computeTemplateHash returns a short, stable hash of a pod template. It is
+// recorded on Deployments so a changed template can be detected without
+// comparing against objects that have been defaulted by the apiserver.
+func computeTemplateHash(template *corev1.PodTemplateSpec) string {
+	hasher := fnv.New32a()
+	// Marshalling a PodTemplateSpec cannot fail; it holds no channels,
+	// functions or unsupported map keys.
+	data, _ := json.Marshal(template)
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// templateHashOf returns the template hash recorded on a Deployment. A
+// Deployment without the annotation was created before hashes were recorded,
+// in which case its own template is hashed.
+func templateHashOf(deployment *appsv1.Deployment) string {
+	if hash, ok := deployment.Annotations[templateHashAnnotation]; ok {
+		return hash
+	}
+	return computeTemplateHash(&deployment.Spec.Template)
+}
@@ -0,0 +1,753 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/diff"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+)
+
+var (
+	alwaysReady        = func() bool { return true }
+	noResyncPeriodFunc = func() time.Duration { return 0 }
+
+	// fixtureTime is the time on the clock of every test controller, so that
+	// the condition timestamps it records can be compared.
+	fixtureTime = time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+)
+
+type fixture struct {
+	t *testing.T
+
+	client     *fake.Clientset
+	kubeclient *k8sfake.Clientset
+	// Objects to put in the store.
+	fooLister        []*samplecontroller.Foo
+	deploymentLister []*apps.Deployment
+	serviceLister    []*corev1.Service
+	// Actions expected to happen on the client.
+	kubeactions []core.Action
+	actions     []core.Action
+	// Objects from here preloaded into NewSimpleFake.
+	kubeobjects []runtime.Object
+	objects     []runtime.Object
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{}
+	f.t = t
+	f.objects = []runtime.Object{}
+	f.kubeobjects = []runtime.Object{}
+	return f
+}
+
+func newFoo(name string, replicas *int32) *samplecontroller.Foo {
+	return &samplecontroller.Foo{
+		TypeMeta: metav1.TypeMeta{APIVersion: samplecontroller.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: samplecontroller.FooSpec{
+			DeploymentName: fmt.Sprintf("%s-deployment", name),
+			Replicas:       replicas,
+		},
+	}
+}
+
+func (f *fixture) newController() (*Controller, informers.SharedInformerFactory, kubeinformers.SharedInformerFactory) {
+	f.client = fake.NewSimpleClientset(f.objects...)
+	f.kubeclient = k8sfake.NewSimpleClientset(f.kubeobjects...)
+
+	i := informers.NewSharedInformerFactory(f.client, noResyncPeriodFunc())
+	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, noResyncPeriodFunc())
+
+	c, err := NewController(Options{
+		KubeClientset:      f.kubeclient,
+		SampleClientset:    f.client,
+		DeploymentInformer: k8sI.Apps().V1().Deployments(),
+		ServiceInformer:    k8sI.Core().V1().Services(),
+		FooInformer:        i.Samplecontroller().V1alpha1().Foos(),
+		Recorder:           &record.FakeRecorder{},
+		Clock:              clock.NewFakeClock(fixtureTime),
+	})
+	if err != nil {
+		f.t.Fatalf("error creating controller: %v", err)
+	}
+
+	c.foosSynced = alwaysReady
+	c.deploymentsSynced = alwaysReady
+	c.servicesSynced = alwaysReady
+
+	for _, f := range f.fooLister {
+		i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Add(f)
+	}
+
+	for _, d := range f.deploymentLister {
+		k8sI.Apps().V1().Deployments().Informer().GetIndexer().Add(d)
+	}
+
+	for _, s := range f.serviceLister {
+		k8sI.Core().V1().Services().Informer().GetIndexer().Add(s)
+	}
+
+	return c, i, k8sI
+}
+
+func TestNewControllerOptions(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	kubeclient := k8sfake.NewSimpleClientset()
+	i := informers.NewSharedInformerFactory(client, noResyncPeriodFunc())
+	k8sI := kubeinformers.NewSharedInformerFactory(kubeclient, noResyncPeriodFunc())
+	opts := Options{
+		KubeClientset:      kubeclient,
+		SampleClientset:    client,
+		DeploymentInformer: k8sI.Apps().V1().Deployments(),
+		ServiceInformer:    k8sI.Core().V1().Services(),
+		Recorder:           &record.FakeRecorder{},
+	}
+	if _, err := NewController(opts); err == nil {
+		t.Errorf("expected an error without a foo informer")
+	}
+
+	opts.FooInformer = i.Samplecontroller().V1alpha1().Foos()
+	c, err := NewController(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.maxRetries != DefaultMaxRetries || c.clock == nil || c.logger == nil || c.podsLister != nil {
+		t.Errorf("expected defaults for the options left unset, got maxRetries %d, clock %v, logger %v", c.maxRetries, c.clock, c.logger)
+	}
+
+	opts.PodInformer = k8sI.Core().V1().Pods()
+	opts.MaxRetries = 3
+	c, err = NewController(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.maxRetries != 3 || c.podsLister == nil || c.podsSynced == nil {
+		t.Errorf("expected the retry limit and pod informer to be used")
+	}
+
+	opts.Recorder = nil
+	opts.UseEventsAPI = true
+	opts.EventCorrelator = &EventCorrelatorOptions{}
+	c, err = NewController(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := c.recorder.(eventsAPIRecorder); !ok || c.startRecording == nil {
+		t.Errorf("expected events to be recorded through the events.k8s.io/v1 API, got %T", c.recorder)
+	}
+	if c.correlator == nil || c.correlator.opts.BurstSize != DefaultEventBurst || c.correlator.opts.QPS != DefaultEventQPS {
+		t.Errorf("expected a correlator with the default burst and QPS, got %+v", c.correlator)
+	}
+}
+
+func (f *fixture) run(fooName string) {
+	f.runController(fooName, true, false)
+}
+
+func (f *fixture) runExpectError(fooName string) {
+	f.runController(fooName, true, true)
+}
+
+func (f *fixture) runController(fooName string, startInformers bool, expectError bool) {
+	c, i, k8sI := f.newController()
+	if startInformers {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		i.Start(stopCh)
+		k8sI.Start(stopCh)
+	}
+
+	_, err := c.syncHandler(fooName)
+	if !expectError && err != nil {
+		f.t.Errorf("error syncing foo: %v", err)
+	} else if expectError && err == nil {
+		f.t.Error("expected error syncing foo, got nil")
+	}
+
+	actions := filterInformerActions(f.client.Actions())
+	for i, action := range actions {
+		if len(f.actions) < i+1 {
+			f.t.Errorf("%d unexpected actions: %+v", len(actions)-len(f.actions), actions[i:])
+			break
+		}
+
+		expectedAction := f.actions[i]
+		checkAction(expectedAction, action, f.t)
+	}
+
+	if len(f.actions) > len(actions) {
+		f.t.Errorf("%d additional expected actions:%+v", len(f.actions)-len(actions), f.actions[len(actions):])
+	}
+
+	k8sActions := filterInformerActions(f.kubeclient.Actions())
+	for i, action := range k8sActions {
+		if len(f.kubeactions) < i+1 {
+			f.t.Errorf("%d unexpected actions: %+v", len(k8sActions)-len(f.kubeactions), k8sActions[i:])
+			break
+		}
+
+		expectedAction := f.kubeactions[i]
+		checkAction(expectedAction, action, f.t)
+	}
+
+	if len(f.kubeactions) > len(k8sActions) {
+		f.t.Errorf("%d additional expected actions:%+v", len(f.kubeactions)-len(k8sActions), f.kubeactions[len(k8sActions):])
+	}
+}
+
+// checkAction verifies that expected and actual actions are equal and both have
+// same attached resources
+func checkAction(expected, actual core.Action, t *testing.T) {
+	if !(expected.Matches(actual.GetVerb(), actual.GetResource().Resource) && actual.GetSubresource() == expected.GetSubresource()) {
+		t.Errorf("Expected\n\t%#v\ngot\n\t%#v", expected, actual)
+		return
+	}
+
+	if reflect.TypeOf(actual) != reflect.TypeOf(expected) {
+		t.Errorf("Action has wrong type. Expected: %t. Got: %t", expected, actual)
+		return
+	}
+
+	switch a := actual.(type) {
+	case core.CreateActionImpl:
+		e, _ := expected.(core.CreateActionImpl)
+		expObject := e.GetObject()
+		object := a.GetObject()
+
+		if !reflect.DeepEqual(expObject, object) {
+			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(expObject, object))
+		}
+	case core.UpdateActionImpl:
+		e, _ := expected.(core.UpdateActionImpl)
+		expObject := e.GetObject()
+		object := a.GetObject()
+
+		if !reflect.DeepEqual(expObject, object) {
+			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(expObject, object))
+		}
+	case core.PatchActionImpl:
+		e, _ := expected.(core.PatchActionImpl)
+		expPatch := e.GetPatch()
+		patch := a.GetPatch()
+
+		if !reflect.DeepEqual(expPatch, patch) {
+			t.Errorf("Action %s %s has wrong patch\nDiff:\n %s",
+				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(expPatch, patch))
+		}
+	default:
+		t.Errorf("Uncaptured Action %s %s, you should explicitly add a case to capture it",
+			actual.GetVerb(), actual.GetResource().Resource)
+	}
+}
+
+// filterInformerActions filters list and watch actions for testing resources.
+// Since list and watch don't change resource state we can filter it to lower
+// nose level in our tests.
+func filterInformerActions(actions []core.Action) []core.Action {
+	ret := []core.Action{}
+	for _, action := range actions {
+		if len(action.GetNamespace()) == 0 &&
+			(action.Matches("list", "foos") ||
+				action.Matches("watch", "foos") ||
+				action.Matches("list", "deployments") ||
+				action.Matches("watch", "deployments") ||
+				action.Matches("list", "services") ||
+				action.Matches("watch", "services")) {
+			continue
+		}
+		ret = append(ret, action)
+	}
+
+	return ret
+}
+
+func (f *fixture) expectCreateDeploymentAction(d *apps.Deployment) {
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
+}
+
+func (f *fixture) expectUpdateDeploymentAction(d *apps.Deployment) {
+	f.kubeactions = append(f.kubeactions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
+}
+
+func (f *fixture) expectUpdateFooStatusAction(foo *samplecontroller.Foo) {
+	action := core.NewUpdateSubresourceAction(schema.GroupVersionResource{Resource: "foos"}, "status", foo.Namespace, foo)
+	f.actions = append(f.actions, action)
+}
+
+// syncedFoo returns a copy of the Foo with the status a successful sync
+// records for it.
+func syncedFoo(foo *samplecontroller.Foo) *samplecontroller.Foo {
+	foo = foo.DeepCopy()
+	foo.Status.DeploymentName = foo.Spec.DeploymentName
+	setSyncedCondition(foo, metav1.ConditionTrue, SuccessSynced, MessageResourceSynced)
+	return foo
+}
+
+// failedFoo returns a copy of the Foo with the status a sync failing with a
+// terminal error with the given reason and message records for it.
+func failedFoo(foo *samplecontroller.Foo, reason, message string) *samplecontroller.Foo {
+	foo = foo.DeepCopy()
+	setSyncedCondition(foo, metav1.ConditionFalse, reason, message)
+	setTestCondition(foo, samplecontroller.FooConditionStalled, metav1.ConditionTrue, reason, message)
+	return foo
+}
+
+func setSyncedCondition(foo *samplecontroller.Foo, status metav1.ConditionStatus, reason, message string) {
+	setTestCondition(foo, samplecontroller.FooConditionSynced, status, reason, message)
+}
+
+func setTestCondition(foo *samplecontroller.Foo, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&foo.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		LastTransitionTime: metav1.NewTime(fixtureTime),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func getKey(foo *samplecontroller.Foo, t *testing.T) string {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(foo)
+	if err != nil {
+		t.Errorf("Unexpected error getting key for foo %v: %v", foo.Name, err)
+		return ""
+	}
+	return key
+}
+
+func TestCreatesDeployment(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+
+	expDeployment := newDeployment(foo)
+	f.expectCreateDeploymentAction(expDeployment)
+	f.expectUpdateFooStatusAction(syncedFoo(foo))
+
+	f.run(getKey(foo, t))
+}
+
+func TestDoNothing(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	d := newDeployment(foo)
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateFooStatusAction(syncedFoo(foo))
+	f.run(getKey(foo, t))
+}
+
+func TestUpdateDeployment(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	d := newDeployment(foo)
+
+	// Update replicas
+	foo.Spec.Replicas = int32Ptr(2)
+	expDeployment := newDeployment(foo)
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateFooStatusAction(syncedFoo(foo))
+	f.expectUpdateDeploymentAction(expDeployment)
+	f.run(getKey(foo, t))
+}
+
+func TestPaused(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	d := newDeployment(foo)
+
+	foo.Spec.Replicas = int32Ptr(2)
+	foo.Spec.Paused = true
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.run(getKey(foo, t))
+}
+
+func TestNotControlledByUs(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	d := newDeployment(foo)
+
+	d.ObjectMeta.OwnerReferences = []metav1.OwnerReference{}
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateFooStatusAction(failedFoo(foo, ErrResourceExists, fmt.Sprintf(MessageResourceExists, d.Name)))
+	f.runExpectError(getKey(foo, t))
+}
+
+func TestStatusUnchanged(t *testing.T) {
+	f := newFixture(t)
+	foo := syncedFoo(newFoo("test", int32Ptr(1)))
+	d := newDeployment(foo)
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	// Nothing has changed, so nothing is written.
+	f.run(getKey(foo, t))
+}
+
+func TestObserve(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	foo.UID = "foo-uid"
+	managed := newDeployment(foo)
+	// A Deployment left under a former name is found through its controller.
+	renamed := newDeployment(foo)
+	renamed.Name = "old-deployment"
+	unrelated := newDeployment(foo)
+	unrelated.Name = "unrelated"
+	unrelated.OwnerReferences = nil
+	f.deploymentLister = append(f.deploymentLister, managed, renamed, unrelated)
+	c, _, _ := f.newController()
+
+	observed, err := c.observe(foo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, d := range observed.Deployments {
+		got = append(got, d.Name)
+	}
+	if want := []string{"test-deployment", "old-deployment"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected deployments %v to be observed, got %v", want, got)
+	}
+}
+
+func TestEventsOnTransitions(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	recorder := record.NewFakeRecorder(10)
+	r.c.recorder = legacyRecorder{recorder}
+
+	expectEvents := func(expected ...string) {
+		t.Helper()
+		for _, e := range expected {
+			select {
+			case event := <-recorder.Events:
+				if !strings.HasPrefix(event, e) {
+					t.Errorf("expected event %q, got %q", e, event)
+				}
+			default:
+				t.Errorf("expected event %q, got none", e)
+			}
+		}
+		select {
+		case event := <-recorder.Events:
+			t.Errorf("unexpected event %q", event)
+		default:
+		}
+	}
+
+	r.sync(foo)
+	expectEvents("Normal Created", "Normal Synced")
+
+	// Syncing again without a change records nothing.
+	r.sync(foo)
+	expectEvents()
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Replicas = int32Ptr(3) })
+	r.sync(foo)
+	expectEvents("Normal Scaled")
+
+	// Drift is repaired, and reported as such.
+	d := r.deployment("test-deployment")
+	d.Spec.Template.Spec.Containers[0].Image = "nginx:drifted"
+	delete(d.Annotations, templateHashAnnotation)
+	if _, err := r.kubeclient.AppsV1().Deployments(d.Namespace).Update(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r.refresh()
+	r.sync(foo)
+	expectEvents("Normal Updated")
+	r.expectReplicas("test-deployment", 3, defaultImage)
+
+	// An error is reported once when it is raised, and once when it clears.
+	d = r.deployment("test-deployment")
+	d.OwnerReferences = nil
+	if _, err := r.kubeclient.AppsV1().Deployments(d.Namespace).Update(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r.refresh()
+	for i := 0; i < 2; i++ {
+		if _, err := r.c.syncHandler(getKey(foo, t)); err == nil {
+			t.Fatalf("expected error syncing foo")
+		}
+		r.refresh()
+	}
+	expectEvents("Warning ErrResourceExists")
+
+	d = r.deployment("test-deployment")
+	d.OwnerReferences = newDeployment(foo).OwnerReferences
+	if _, err := r.kubeclient.AppsV1().Deployments(d.Namespace).Update(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r.refresh()
+	r.sync(foo)
+	expectEvents("Normal Synced")
+}
+
+// rolloutFixture drives a Controller through several syncs. Between syncs it
+// copies the state of the fake clientsets into the informer stores, standing
+// in for running informers, so each sync sees the result of the last one.
+type rolloutFixture struct {
+	*fixture
+
+	c     *Controller
+	i     informers.SharedInformerFactory
+	k8sI  kubeinformers.SharedInformerFactory
+	clock *clock.FakeClock
+}
+
+func newRolloutFixture(t *testing.T, foo *samplecontroller.Foo, deployments ...*apps.Deployment) *rolloutFixture {
+	f := newFixture(t)
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	for _, d := range deployments {
+		f.deploymentLister = append(f.deploymentLister, d)
+		f.kubeobjects = append(f.kubeobjects, d)
+	}
+
+	r := &rolloutFixture{fixture: f, clock: clock.NewFakeClock(fixtureTime)}
+	r.c, r.i, r.k8sI = f.newController()
+	r.c.clock = r.clock
+	return r
+}
+
+// sync runs syncHandler for the Foo and refreshes the informer stores. It
+// returns when syncHandler asked for the Foo to be synced again.
+func (r *rolloutFixture) sync(foo *samplecontroller.Foo) time.Duration {
+	r.t.Helper()
+	result, err := r.c.syncHandler(getKey(foo, r.t))
+	if err != nil {
+		r.t.Fatalf("error syncing foo: %v", err)
+	}
+	r.refresh()
+	return result.requeueAfter
+}
+
+func (r *rolloutFixture) refresh() {
+	r.t.Helper()
+	foos, err := r.client.SamplecontrollerV1alpha1().Foos(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		r.t.Fatalf("error listing foos: %v", err)
+	}
+	var fooObjs []interface{}
+	for i := range foos.Items {
+		fooObjs = append(fooObjs, &foos.Items[i])
+	}
+	r.i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Replace(fooObjs, "")
+
+	deployments, err := r.kubeclient.AppsV1().Deployments(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		r.t.Fatalf("error listing deployments: %v", err)
+	}
+	var deploymentObjs []interface{}
+	for i := range deployments.Items {
+		deploymentObjs = append(deploymentObjs, &deployments.Items[i])
+	}
+	r.k8sI.Apps().V1().Deployments().Informer().GetIndexer().Replace(deploymentObjs, "")
+
+	services, err := r.kubeclient.CoreV1().Services(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		r.t.Fatalf("error listing services: %v", err)
+	}
+	var serviceObjs []interface{}
+	for i := range services.Items {
+		serviceObjs = append(serviceObjs, &services.Items[i])
+	}
+	r.k8sI.Core().V1().Services().Informer().GetIndexer().Replace(serviceObjs, "")
+}
+
+// updateFoo applies mutate to the current state of the Foo.
+func (r *rolloutFixture) updateFoo(name string, mutate func(*samplecontroller.Foo)) *samplecontroller.Foo {
+	r.t.Helper()
+	foo := r.fixture.updateFoo(name, mutate)
+	r.refresh()
+	return foo
+}
+
+// rollOut marks the named Deployment as having finished rolling out its spec,
+// as the Deployment controller would.
+func (r *rolloutFixture) rollOut(name string) {
+	r.t.Helper()
+	r.fixture.rollOut(name)
+	r.refresh()
+}
+
+// foo returns the current state of the named Foo.
+func (f *fixture) foo(name string) *samplecontroller.Foo {
+	f.t.Helper()
+	foo, err := f.client.SamplecontrollerV1alpha1().Foos(metav1.NamespaceDefault).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatalf("error getting foo %s: %v", name, err)
+	}
+	return foo
+}
+
+// updateFoo applies mutate to the current state of the Foo in the clientset.
+func (f *fixture) updateFoo(name string, mutate func(*samplecontroller.Foo)) *samplecontroller.Foo {
+	f.t.Helper()
+	foo := f.foo(name)
+	mutate(foo)
+	foo, err := f.client.SamplecontrollerV1alpha1().Foos(metav1.NamespaceDefault).Update(context.TODO(), foo, metav1.UpdateOptions{})
+	if err != nil {
+		f.t.Fatalf("error updating foo %s: %v", name, err)
+	}
+	return foo
+}
+
+// deployment returns the current state of the named Deployment, or nil if it
+// does not exist.
+func (f *fixture) deployment(name string) *apps.Deployment {
+	f.t.Helper()
+	d, err := f.kubeclient.AppsV1().Deployments(metav1.NamespaceDefault).Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		f.t.Fatalf("error getting deployment %s: %v", name, err)
+	}
+	return d
+}
+
+// rollOut marks the named Deployment in the clientset as having finished
+// rolling out its spec, as the Deployment controller would.
+func (f *fixture) rollOut(name string) {
+	f.t.Helper()
+	d := f.deployment(name)
+	d.Status.ObservedGeneration = d.Generation
+	d.Status.Replicas = *d.Spec.Replicas
+	d.Status.UpdatedReplicas = *d.Spec.Replicas
+	d.Status.ReadyReplicas = *d.Spec.Replicas
+	d.Status.AvailableReplicas = *d.Spec.Replicas
+	if _, err := f.kubeclient.AppsV1().Deployments(metav1.NamespaceDefault).UpdateStatus(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		f.t.Fatalf("error updating deployment %s: %v", name, err)
+	}
+}
+
+func (f *fixture) expectReplicas(name string, replicas int32, image string) {
+	f.t.Helper()
+	d := f.deployment(name)
+	if d == nil {
+		f.t.Fatalf("expected deployment %s to exist", name)
+	}
+	if *d.Spec.Replicas != replicas {
+		f.t.Errorf("deployment %s: expected %d replicas, got %d", name, replicas, *d.Spec.Replicas)
+	}
+	if got := d.Spec.Template.Spec.Containers[0].Image; got != image {
+		f.t.Errorf("deployment %s: expected image %s, got %s", name, image, got)
+	}
+}
+
+func (f *fixture) expectCanaryStatus(name string, step int32, phase samplecontroller.CanaryPhase) {
+	f.t.Helper()
+	status := f.foo(name).Status.Canary
+	if status == nil {
+		f.t.Fatalf("expected canary status on foo %s", name)
+	}
+	if status.CurrentStepIndex != step || status.Phase != phase {
+		f.t.Errorf("expected canary at step %d %s, got step %d %s", step, phase, status.CurrentStepIndex, status.Phase)
+	}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func TestProcessNextWorkItemRequeuesAfter(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	queue := &recordingQueue{RateLimitingInterface: r.c.workqueue, after: map[interface{}]time.Duration{}}
+	r.c.workqueue = queue
+	key := getKey(foo, t)
+
+	// The new Deployment has not rolled out, so the worker checks back on it.
+	r.c.workqueue.Add(key)
+	r.c.processNextWorkItem()
+	if got := queue.after[key]; got != rolloutPollInterval {
+		t.Errorf("expected foo to be queued again in %v, got %v", rolloutPollInterval, got)
+	}
+
+	r.refresh()
+	r.rollOut("test-deployment")
+	delete(queue.after, key)
+	r.c.workqueue.Add(key)
+	r.c.processNextWorkItem()
+	if got, ok := queue.after[key]; ok {
+		t.Errorf("expected foo not to be queued again, got %v", got)
+	}
+}
+
+// recordingQueue records the items added to the queue with a delay.
+type recordingQueue struct {
+	workqueue.RateLimitingInterface
+	after map[interface{}]time.Duration
+}
+
+func (q *recordingQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.after[item] = duration
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// errorClass decides how the worker handles an error returned by
+// syncHandler.
+type errorClass string
+
+const (
+	// errorClassTransient errors are retried with the rate limiter of the
+	// workqueue, until the retry budget of the controller runs out.
+	errorClassTransient errorClass = "transient"
+	// errorClassTerminal errors are not retried. The Foo is only synced
+	// again once it, or one of the objects it owns, changes.
+	errorClassTerminal errorClass = "terminal"
+	// errorClassRequeueAfter errors are those the API server asks the client
+	// to retry after a delay, such as TooManyRequests. They are retried after
+	// that delay, without counting against the retry budget.
+	errorClassRequeueAfter errorClass = "requeue_after"
+)
+
+// errorClasses lists every errorClass, so that metrics can be created for
+// each of them up front.
+var errorClasses = []errorClass{errorClassTransient, errorClassTerminal, errorClassRequeueAfter}
+
+// syncError is an error syncing a Foo, along with how it should be retried
+// and the Event reason it is reported under.
+type syncError struct {
+	class  errorClass
+	reason string
+	err    error
+}
+
+func (e *syncError) Error() string {
+	return e.err.Error()
+}
+
+func (e *syncError) Unwrap() error {
+	return e.err
+}
+
+// terminalError returns an error that retrying cannot fix, such as an invalid
+// spec or a conflict with an object the Foo does not own.
+func terminalError(reason string, err error) error {
+	return &syncError{class: errorClassTerminal, reason: reason, err: err}
+}
+
+// classifyError returns the class of an error returned by syncHandler, and for
+// errorClassRequeueAfter the delay before retrying. Errors that were not
+// classified when they were raised are classified from their API status, and
+// are otherwise transient.
+func classifyError(err error) (errorClass, time.Duration) {
+	var se *syncError
+	if errors.As(err, &se) {
+		return se.class, 0
+	}
+	if delay, ok := apierrors.SuggestsClientDelay(err); ok && delay > 0 {
+		return errorClassRequeueAfter, time.Duration(delay) * time.Second
+	}
+	if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+		return errorClassTerminal, 0
+	}
+	return errorClassTransient, 0
+}
+
+// errorReason returns the Event reason an error syncing a Foo is reported
+// under.
+func errorReason(err error) string {
+	var se *syncError
+	if errors.As(err, &se) && se.reason != "" {
+		return se.reason
+	}
+	return ErrSyncFailed
+}
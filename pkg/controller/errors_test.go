@@ -0,0 +1,189 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+type fakeCounter struct {
+	count int
+}
+
+func (c *fakeCounter) Inc() { c.count++ }
+
+type fakeMetricsProvider struct {
+	syncErrors map[string]*fakeCounter
+	stalled    fakeCounter
+}
+
+func (p *fakeMetricsProvider) NewSyncErrorsMetric(class string) CounterMetric {
+	if p.syncErrors == nil {
+		p.syncErrors = map[string]*fakeCounter{}
+	}
+	p.syncErrors[class] = &fakeCounter{}
+	return p.syncErrors[class]
+}
+
+func (p *fakeMetricsProvider) NewStalledMetric() CounterMetric {
+	return &p.stalled
+}
+
+func TestClassifyError(t *testing.T) {
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		name  string
+		err   error
+		class errorClass
+		after time.Duration
+	}{
+		{name: "unclassified", err: fmt.Errorf("boom"), class: errorClassTransient},
+		{name: "conflict", err: apierrors.NewConflict(gr, "test", fmt.Errorf("boom")), class: errorClassTransient},
+		{name: "terminal", err: terminalError(ErrInvalidSpec, fmt.Errorf("boom")), class: errorClassTerminal},
+		{name: "wrapped terminal", err: fmt.Errorf("wrapped: %w", terminalError(ErrInvalidSpec, fmt.Errorf("boom"))), class: errorClassTerminal},
+		{name: "invalid", err: apierrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "test", nil), class: errorClassTerminal},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 5), class: errorClassRequeueAfter, after: 5 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, after := classifyError(test.err)
+			if class != test.class || after != test.after {
+				t.Errorf("expected %s after %v, got %s after %v", test.class, test.after, class, after)
+			}
+		})
+	}
+}
+
+func newErrorTestController(t *testing.T, foo *samplecontroller.Foo) (*fixture, *Controller, *fakeMetricsProvider) {
+	f := newFixture(t)
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+	c, _, _ := f.newController()
+	// Retries are immediate, so the queue can be drained synchronously.
+	c.workqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(0, 0))
+	metrics := &fakeMetricsProvider{}
+	c.metrics = newSyncMetrics(metrics)
+	return f, c, metrics
+}
+
+func TestTerminalErrorNotRetried(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	_, c, metrics := newErrorTestController(t, foo)
+	key := getKey(foo, t)
+
+	err := c.syncFailed(foo, terminalError(ErrResourceExists, fmt.Errorf("boom")))
+	c.handleSyncError(key, err)
+	if c.workqueue.Len() != 0 || c.workqueue.NumRequeues(key) != 0 {
+		t.Errorf("expected terminal error not to be retried")
+	}
+	if metrics.syncErrors["terminal"].count != 1 || metrics.stalled.count != 1 {
+		t.Errorf("expected one terminal error and one stalled Foo to be counted")
+	}
+}
+
+func TestStalledCountedOnce(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	f, c, metrics := newErrorTestController(t, foo)
+	key := getKey(foo, t)
+
+	// The Foo fails the same way every time it is synced again, such as
+	// when an object it owns changes.
+	for i := 0; i < 3; i++ {
+		current, err := f.client.SamplecontrollerV1alpha1().Foos(foo.Namespace).Get(context.TODO(), foo.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.handleSyncError(key, c.syncFailed(current, terminalError(ErrResourceExists, fmt.Errorf("boom"))))
+	}
+	if metrics.syncErrors["terminal"].count != 3 || metrics.stalled.count != 1 {
+		t.Errorf("expected 3 terminal errors and one stalled Foo to be counted, got %d and %d",
+			metrics.syncErrors["terminal"].count, metrics.stalled.count)
+	}
+}
+
+func TestRequeueAfterError(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	_, c, metrics := newErrorTestController(t, foo)
+	key := getKey(foo, t)
+
+	c.handleSyncError(key, apierrors.NewTooManyRequests("slow down", 1))
+	if c.workqueue.NumRequeues(key) != 0 {
+		t.Errorf("expected requeue-after error not to count against the retry budget")
+	}
+	item, _ := c.workqueue.Get()
+	if item != key {
+		t.Errorf("expected %q to be requeued, got %v", key, item)
+	}
+	if metrics.syncErrors["requeue_after"].count != 1 {
+		t.Errorf("expected one requeue-after error to be counted")
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	f, c, metrics := newErrorTestController(t, foo)
+	c.maxRetries = 3
+	key := getKey(foo, t)
+
+	for i := 0; i < c.maxRetries; i++ {
+		c.handleSyncError(key, fmt.Errorf("boom %d", i))
+		item, _ := c.workqueue.Get()
+		if item != key {
+			t.Fatalf("retry %d: expected %q to be requeued, got %v", i, key, item)
+		}
+		c.workqueue.Done(item)
+	}
+	c.handleSyncError(key, fmt.Errorf("boom %d", c.maxRetries))
+	if c.workqueue.Len() != 0 || c.workqueue.NumRequeues(key) != 0 {
+		t.Errorf("expected foo not to be retried once its retries are exhausted")
+	}
+	if metrics.syncErrors["transient"].count != c.maxRetries+1 || metrics.stalled.count != 1 {
+		t.Errorf("expected %d transient errors and one stalled Foo to be counted", c.maxRetries+1)
+	}
+
+	foo, err := f.client.SamplecontrollerV1alpha1().Foos(foo.Namespace).Get(context.TODO(), foo.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalled := meta.FindStatusCondition(foo.Status.Conditions, samplecontroller.FooConditionStalled)
+	if stalled == nil || stalled.Status != metav1.ConditionTrue || stalled.Reason != RetriesExhausted || stalled.Message != "boom 3" {
+		t.Errorf("expected foo to be stalled with the last error, got %+v", stalled)
+	}
+}
+
+func TestInvalidSpecReported(t *testing.T) {
+	f := newFixture(t)
+	foo := newFoo("test", int32Ptr(1))
+	foo.Spec.DeploymentName = ""
+
+	f.fooLister = append(f.fooLister, foo)
+	f.objects = append(f.objects, foo)
+
+	f.expectUpdateFooStatusAction(failedFoo(foo, ErrInvalidSpec, "deployment name must be specified"))
+	f.runExpectError(getKey(foo, t))
+}
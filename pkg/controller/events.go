@@ -0,0 +1,185 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// EventReason describes the Events the controller records under one reason.
+type EventReason struct {
+	Reason string
+	// Type is corev1.EventTypeNormal or corev1.EventTypeWarning.
+	Type string
+	// Action is what the controller did, as reported by events.k8s.io/v1
+	// Events.
+	Action string
+}
+
+// EventReasons is the catalogue of the reasons of the Events the controller
+// records. Every Event is about a Foo, except those of the sweeper, which are
+// about the leaked Deployments.
+var EventReasons = []EventReason{
+	{Reason: SuccessSynced, Type: corev1.EventTypeNormal, Action: "Sync"},
+	{Reason: SuccessCreated, Type: corev1.EventTypeNormal, Action: "Create"},
+	{Reason: SuccessScaled, Type: corev1.EventTypeNormal, Action: "Scale"},
+	{Reason: SuccessUpdated, Type: corev1.EventTypeNormal, Action: "Update"},
+	{Reason: SuccessAdopted, Type: corev1.EventTypeNormal, Action: "Adopt"},
+	{Reason: ErrResourceExists, Type: corev1.EventTypeWarning, Action: "Sync"},
+	{Reason: ErrAdoptionFailed, Type: corev1.EventTypeWarning, Action: "Adopt"},
+	{Reason: ErrSyncFailed, Type: corev1.EventTypeWarning, Action: "Sync"},
+	{Reason: ErrInvalidSpec, Type: corev1.EventTypeWarning, Action: "Sync"},
+	{Reason: RetriesExhausted, Type: corev1.EventTypeWarning, Action: "Sync"},
+	{Reason: CanaryStepAdvanced, Type: corev1.EventTypeNormal, Action: "Rollout"},
+	{Reason: CanaryPromoted, Type: corev1.EventTypeNormal, Action: "Promote"},
+	{Reason: CanaryAborted, Type: corev1.EventTypeWarning, Action: "Abort"},
+	{Reason: BlueGreenPromoted, Type: corev1.EventTypeNormal, Action: "Promote"},
+	{Reason: RenameRefused, Type: corev1.EventTypeWarning, Action: "Rename"},
+	{Reason: RenameMigrated, Type: corev1.EventTypeNormal, Action: "Rename"},
+	{Reason: LeakedDeployment, Type: corev1.EventTypeWarning, Action: "Sweep"},
+	{Reason: LeakedDeploymentDeleted, Type: corev1.EventTypeNormal, Action: "Delete"},
+}
+
+// eventActions holds the action of each reason of the catalogue.
+var eventActions = func() map[string]string {
+	actions := map[string]string{}
+	for _, r := range EventReasons {
+		actions[r.Reason] = r.Action
+	}
+	return actions
+}()
+
+// eventAction returns the action of the Events recorded under a reason.
+// Reasons missing from the catalogue are reported as syncs.
+func eventAction(reason string) string {
+	if action, ok := eventActions[reason]; ok {
+		return action
+	}
+	return "Sync"
+}
+
+// eventRecorder records the Events of the controller through either Events
+// API. The related object, when not nil, is the object the Event reports a
+// write to; only events.k8s.io/v1 Events record it.
+type eventRecorder interface {
+	event(regarding, related runtime.Object, eventType, reason, message string)
+}
+
+// legacyRecorder records core/v1 Events.
+type legacyRecorder struct {
+	record.EventRecorder
+}
+
+func (r legacyRecorder) event(regarding, _ runtime.Object, eventType, reason, message string) {
+	r.Event(regarding, eventType, reason, message)
+}
+
+// eventsAPIRecorder records events.k8s.io/v1 Events, with the action of their
+// reason. Repeated Events are aggregated in series by the broadcaster.
+type eventsAPIRecorder struct {
+	events.EventRecorder
+}
+
+func (r eventsAPIRecorder) event(regarding, related runtime.Object, eventType, reason, message string) {
+	r.Eventf(regarding, related, eventType, reason, eventAction(reason), "%s", message)
+}
+
+const (
+	// DefaultEventBurst is how many Events about a Foo the correlator lets
+	// through in a burst unless EventCorrelatorOptions.BurstSize is set. It
+	// matches the spam filter of client-go.
+	DefaultEventBurst = 25
+	// DefaultEventQPS is the rate at which the correlator lets Events about
+	// a Foo through once its burst is spent unless EventCorrelatorOptions.QPS
+	// is set: one every five minutes.
+	DefaultEventQPS = 1. / 300.
+)
+
+// EventCorrelatorOptions cap the Events recorded about each Foo, so that a
+// Foo that keeps changing or failing cannot flood the API server with Events.
+// Events over the cap are dropped.
+type EventCorrelatorOptions struct {
+	// BurstSize is how many Events about a Foo are recorded in a burst. It
+	// defaults to DefaultEventBurst.
+	BurstSize int
+	// QPS is the rate at which Events about a Foo are recorded once the
+	// burst is spent. It defaults to DefaultEventQPS.
+	QPS float32
+}
+
+// eventCorrelator holds a token bucket per Foo, by namespace/name key.
+type eventCorrelator struct {
+	opts  EventCorrelatorOptions
+	clock clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]flowcontrol.RateLimiter
+}
+
+func newEventCorrelator(opts EventCorrelatorOptions, clock clock.Clock) *eventCorrelator {
+	if opts.BurstSize <= 0 {
+		opts.BurstSize = DefaultEventBurst
+	}
+	if opts.QPS <= 0 {
+		opts.QPS = DefaultEventQPS
+	}
+	return &eventCorrelator{
+		opts:    opts,
+		clock:   clock,
+		buckets: map[string]flowcontrol.RateLimiter{},
+	}
+}
+
+// allow takes a token from the bucket of a Foo, and reports whether it had
+// one.
+func (c *eventCorrelator) allow(fooKey string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bucket, ok := c.buckets[fooKey]
+	if !ok {
+		bucket = flowcontrol.NewTokenBucketRateLimiterWithClock(c.opts.QPS, c.opts.BurstSize, c.clock)
+		c.buckets[fooKey] = bucket
+	}
+	return bucket.TryAccept()
+}
+
+// forget drops the bucket of a Foo that was deleted.
+func (c *eventCorrelator) forget(fooKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.buckets, fooKey)
+}
+
+// recordEvent records an Event about a Foo, unless the correlator has capped
+// the Events about it.
+func (c *Controller) recordEvent(foo *samplev1alpha1.Foo, related runtime.Object, e Event) {
+	if c.correlator != nil && !c.correlator.allow(foo.Namespace+"/"+foo.Name) {
+		c.logger.V(4).Info("Dropping event over the cap of the foo", "foo", klog.KObj(foo), "reason", e.Reason)
+		return
+	}
+	c.recorder.event(foo, related, e.Type, e.Reason, e.Message)
+}
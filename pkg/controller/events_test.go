@@ -0,0 +1,115 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// recordedEvent is an events.k8s.io/v1 Event recorded by eventsRecorder.
+type recordedEvent struct {
+	regarding, related runtime.Object
+	eventType, reason  string
+	action, note       string
+}
+
+// eventsRecorder is an events.EventRecorder keeping what it records.
+type eventsRecorder struct {
+	events []recordedEvent
+}
+
+func (r *eventsRecorder) Eventf(regarding, related runtime.Object, eventType, reason, action, note string, args ...interface{}) {
+	r.events = append(r.events, recordedEvent{regarding, related, eventType, reason, action, fmt.Sprintf(note, args...)})
+}
+
+func TestEventReasonsCatalogue(t *testing.T) {
+	seen := map[string]bool{}
+	for _, r := range EventReasons {
+		if seen[r.Reason] {
+			t.Errorf("reason %s is in the catalogue twice", r.Reason)
+		}
+		seen[r.Reason] = true
+		if r.Type != corev1.EventTypeNormal && r.Type != corev1.EventTypeWarning {
+			t.Errorf("reason %s has invalid type %q", r.Reason, r.Type)
+		}
+		if r.Action == "" {
+			t.Errorf("reason %s has no action", r.Reason)
+		}
+	}
+}
+
+func TestEventsAPIRecorder(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	recorder := &eventsRecorder{}
+	r.c.recorder = eventsAPIRecorder{recorder}
+
+	r.sync(foo)
+	if len(recorder.events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", recorder.events)
+	}
+	created, synced := recorder.events[0], recorder.events[1]
+	if created.reason != SuccessCreated || created.action != "Create" || created.regarding != foo {
+		t.Errorf("expected a Create event about the foo, got %+v", created)
+	}
+	if d, ok := created.related.(*apps.Deployment); !ok || d.Name != "test-deployment" {
+		t.Errorf("expected the event to relate to the deployment created, got %v", created.related)
+	}
+	if synced.reason != SuccessSynced || synced.action != "Sync" || synced.related != nil {
+		t.Errorf("expected a Sync event without related object, got %+v", synced)
+	}
+}
+
+func TestEventCorrelatorCapsEventsPerFoo(t *testing.T) {
+	clk := clock.NewFakeClock(fixtureTime)
+	c := newEventCorrelator(EventCorrelatorOptions{BurstSize: 2, QPS: 0.1}, clk)
+
+	var allowed []bool
+	for i := 0; i < 3; i++ {
+		allowed = append(allowed, c.allow("default/a"))
+	}
+	allowed = append(allowed, c.allow("default/b"))
+	clk.Step(10 * time.Second)
+	allowed = append(allowed, c.allow("default/a"), c.allow("default/a"))
+	c.forget("default/a")
+	allowed = append(allowed, c.allow("default/a"))
+
+	expected := []bool{true, true, false, true, true, false, true}
+	if fmt.Sprint(allowed) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, allowed)
+	}
+}
+
+func TestEventCorrelatorDropsEvents(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	recorder := &eventsRecorder{}
+	r.c.recorder = eventsAPIRecorder{recorder}
+	r.c.correlator = newEventCorrelator(EventCorrelatorOptions{BurstSize: 1}, r.clock)
+
+	r.sync(foo)
+	if len(recorder.events) != 1 || recorder.events[0].reason != SuccessCreated {
+		t.Errorf("expected only the first event to be recorded, got %+v", recorder.events)
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// controllerIndex indexes objects by the UID of their controller.
+const controllerIndex = "controllerUID"
+
+func controllerIndexFunc(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	ref := metav1.GetControllerOf(accessor)
+	if ref == nil {
+		return nil, nil
+	}
+	return []string{string(ref.UID)}, nil
+}
+
+// addControllerIndex adds controllerIndex to an informer that does not have
+// it yet. Like any indexer, it must be added before the informer is started.
+func addControllerIndex(informer cache.SharedIndexInformer) error {
+	if _, ok := informer.GetIndexer().GetIndexers()[controllerIndex]; ok {
+		return nil
+	}
+	return informer.AddIndexers(cache.Indexers{controllerIndex: controllerIndexFunc})
+}
+
+// observe reads the objects of a Foo from the informer caches.
+func (c *Controller) observe(foo *samplev1alpha1.Foo) (*Observed, error) {
+	// Besides the objects the Foo controls, those under the names it may
+	// manage are observed, so that conflicts and adoptions are planned.
+	names := sets.NewString(managedDeploymentNames(foo.Spec.DeploymentName)...)
+	if foo.Status.DeploymentName != "" {
+		names.Insert(managedDeploymentNames(foo.Status.DeploymentName)...)
+	}
+	if foo.Spec.Strategy != nil && foo.Spec.Strategy.BlueGreen != nil {
+		names.Insert(blueGreenServiceName(foo))
+	}
+	controlled := func(indexer cache.Indexer) ([]metav1.Object, error) {
+		objs, err := indexer.ByIndex(controllerIndex, string(foo.UID))
+		if err != nil {
+			return nil, err
+		}
+		var owned []metav1.Object
+		for _, obj := range objs {
+			if accessor, err := meta.Accessor(obj); err == nil && !names.Has(accessor.GetName()) &&
+				accessor.GetNamespace() == foo.Namespace && metav1.IsControlledBy(accessor, foo) {
+				owned = append(owned, accessor)
+			}
+		}
+		return owned, nil
+	}
+
+	observed := &Observed{}
+	for _, name := range names.List() {
+		d, err := c.deploymentsLister.Deployments(foo.Namespace).Get(name)
+		switch {
+		case errors.IsNotFound(err):
+		case err != nil:
+			return nil, err
+		default:
+			observed.Deployments = append(observed.Deployments, d)
+		}
+		s, err := c.servicesLister.Services(foo.Namespace).Get(name)
+		switch {
+		case errors.IsNotFound(err):
+		case err != nil:
+			return nil, err
+		default:
+			observed.Services = append(observed.Services, s)
+		}
+	}
+	deployments, err := controlled(c.deploymentIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments {
+		observed.Deployments = append(observed.Deployments, d.(*appsv1.Deployment))
+	}
+	services, err := controlled(c.serviceIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		observed.Services = append(observed.Services, s.(*corev1.Service))
+	}
+	if c.podsLister != nil {
+		observed.SummarizePods = true
+		observed.Pods, err = c.podsLister.Pods(foo.Namespace).List(labels.SelectorFromSet(newDeployment(foo).Spec.Template.Labels))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return observed, nil
+}
+
+// execute applies a plan: its actions in order, then the status of the Foo,
+// then its Events. It returns when the Foo should be synced again, and the
+// error of the plan. A failed action stops the plan and is recorded in the
+// status of the Foo instead.
+func (c *Controller) execute(foo *samplev1alpha1.Foo, plan *Plan) (syncResult, error) {
+	// The resource versions returned by the writes so far, by objectKey.
+	written := map[string]string{}
+	for _, action := range plan.Actions {
+		if err := c.applyAction(foo, action, written); err != nil {
+			return syncResult{}, c.syncFailed(foo, err)
+		}
+	}
+
+	if plan.Status != nil {
+		if err := c.updateFooStatus(foo, plan.Status); err != nil {
+			if plan.Err == nil {
+				return syncResult{}, err
+			}
+			// The error the plan reports matters more than failing to
+			// report it.
+			utilruntime.HandleError(fmt.Errorf("error updating status of foo %s/%s: %v", foo.Namespace, foo.Name, err))
+		} else if becameStalled(foo, plan.Status) {
+			c.metrics.stalled.Inc()
+		}
+	}
+	for _, e := range plan.Events {
+		c.recordEvent(foo, nil, e)
+	}
+	return requeueAfter(plan.RequeueAfter), plan.Err
+}
+
+// becameStalled returns whether a new status marks a Foo Stalled when it was
+// not already, so that a Foo is counted once however often it is synced.
+func becameStalled(foo *samplev1alpha1.Foo, status *samplev1alpha1.FooStatus) bool {
+	return meta.IsStatusConditionTrue(status.Conditions, samplev1alpha1.FooConditionStalled) &&
+		!meta.IsStatusConditionTrue(foo.Status.Conditions, samplev1alpha1.FooConditionStalled)
+}
+
+// syncFailed records an error syncing a Foo in its status and returns it.
+func (c *Controller) syncFailed(foo *samplev1alpha1.Foo, err error) error {
+	p := newPlanner(foo, nil, c.clock.Now())
+	p.fail(err)
+	_, err = c.execute(foo, p.plan)
+	return err
+}
+
+// applyAction makes the write of an action, and records its Event. An object
+// already written by the plan is updated on top of that write, rather than
+// conflicting with it. Objects that are gone need not be patched or deleted.
+func (c *Controller) applyAction(foo *samplev1alpha1.Foo, action Action, written map[string]string) error {
+	key := objectKey(action.Object)
+	obj := action.Object
+	if rv, ok := written[key]; ok && action.Type == ActionUpdate {
+		if accessor, err := meta.Accessor(obj); err == nil && accessor.GetResourceVersion() != "" {
+			// NEVER modify objects from the plan.
+			obj = obj.DeepCopyObject()
+			accessor, _ = meta.Accessor(obj)
+			accessor.SetResourceVersion(rv)
+		}
+	}
+	c.logger.V(4).Info("Applying action", "foo", klog.KObj(foo), "action", action.Type, "object", key)
+
+	var result runtime.Object
+	var err error
+	ctx := context.TODO()
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		client := c.kubeclientset.AppsV1().Deployments(obj.Namespace)
+		switch action.Type {
+		case ActionCreate:
+			result, err = client.Create(ctx, obj, metav1.CreateOptions{})
+		case ActionUpdate:
+			result, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+		case ActionPatch:
+			result, err = client.Patch(ctx, obj.Name, types.StrategicMergePatchType, action.Patch, metav1.PatchOptions{})
+		case ActionDelete:
+			err = client.Delete(ctx, obj.Name, metav1.DeleteOptions{})
+		}
+	case *corev1.Service:
+		client := c.kubeclientset.CoreV1().Services(obj.Namespace)
+		switch action.Type {
+		case ActionCreate:
+			result, err = client.Create(ctx, obj, metav1.CreateOptions{})
+		case ActionUpdate:
+			result, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+		case ActionPatch:
+			result, err = client.Patch(ctx, obj.Name, types.StrategicMergePatchType, action.Patch, metav1.PatchOptions{})
+		case ActionDelete:
+			err = client.Delete(ctx, obj.Name, metav1.DeleteOptions{})
+		}
+	default:
+		return fmt.Errorf("cannot apply %s to %T", action.Type, obj)
+	}
+	fooKey := foo.Namespace + "/" + foo.Name
+	if errors.IsNotFound(err) && (action.Type == ActionPatch || action.Type == ActionDelete) {
+		c.expectations.forgetWrite(fooKey, obj)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if action.Type == ActionDelete {
+		c.expectations.forgetWrite(fooKey, obj)
+	}
+	if result != nil {
+		if accessor, err := meta.Accessor(result); err == nil {
+			written[key] = accessor.GetResourceVersion()
+			// The informers are expected to observe the write, and to hold
+			// something newer than the object it was planned from.
+			var from string
+			if planned, err := meta.Accessor(action.Object); err == nil && action.Type != ActionCreate {
+				from = planned.GetResourceVersion()
+			}
+			c.expectations.expectWrite(fooKey, result, from, accessor.GetResourceVersion(), c.clock.Now())
+		}
+	}
+	if action.Event != nil {
+		// The Event relates to the object as written, which has a UID
+		// unlike the object of a create.
+		related := obj
+		if result != nil {
+			related = result
+		}
+		c.recordEvent(foo, related, *action.Event)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// expectationsTimeout is how long a Foo waits for the informers to observe
+// the writes of its last sync before it is synced anyway. It matches the
+// timeout of the expectations of the ReplicaSet controller.
+const expectationsTimeout = 5 * time.Minute
+
+// expectedWrite is a create, update or patch of an object of a Foo that the
+// informers may not have observed yet.
+type expectedWrite struct {
+	// object is the object as it was written.
+	object runtime.Object
+	// from is the resource version the write was planned from, or empty for
+	// a create.
+	from string
+	// to is the resource version the write returned.
+	to string
+}
+
+// observedBy tells whether the informers have caught up with the write, given
+// the resource version they hold for the object. They have once they hold the
+// version written or a later one; as resource versions are opaque, any
+// version other than the one the write was planned from counts as later.
+func (w expectedWrite) observedBy(resourceVersion string, cached bool) bool {
+	if !cached {
+		return false
+	}
+	return w.from == "" || resourceVersion == w.to || resourceVersion != w.from
+}
+
+// fooExpectations are the writes of a Foo that the informers may not have
+// observed yet, by objectKey.
+type fooExpectations struct {
+	writes map[string]expectedWrite
+	// timestamp is when the last write was made.
+	timestamp time.Time
+}
+
+// expectations tracks the writes the controller has made for each Foo until
+// the informers observe them. Syncing a Foo before then would plan from
+// stale caches and repeat its writes, so that for instance a Deployment that
+// was just created is created again and fails with AlreadyExists.
+type expectations struct {
+	mu   sync.Mutex
+	foos map[string]*fooExpectations
+}
+
+func newExpectations() *expectations {
+	return &expectations{foos: map[string]*fooExpectations{}}
+}
+
+// expectWrite records a write to obj made now for the Foo with the given key. When
+// the object has already been written since the informers last observed
+// it, the write is expected on top of that one.
+func (e *expectations) expectWrite(fooKey string, obj runtime.Object, from, to string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	foo, ok := e.foos[fooKey]
+	if !ok {
+		foo = &fooExpectations{writes: map[string]expectedWrite{}}
+		e.foos[fooKey] = foo
+	}
+	key := objectKey(obj)
+	if previous, ok := foo.writes[key]; ok {
+		from = previous.from
+	}
+	foo.writes[key] = expectedWrite{object: obj, from: from, to: to}
+	foo.timestamp = now
+}
+
+// forgetWrite stops expecting the writes to obj for the Foo with the given
+// key, once the object has been deleted.
+func (e *expectations) forgetWrite(fooKey string, obj runtime.Object) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if foo, ok := e.foos[fooKey]; ok {
+		delete(foo.writes, objectKey(obj))
+	}
+}
+
+// delete forgets the expectations of the Foo with the given key.
+func (e *expectations) delete(fooKey string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.foos, fooKey)
+}
+
+// pending returns how long the Foo with the given key should wait, as of now,
+// for the informers to observe its writes, or zero if it can be synced. cached
+// returns the resource version the informers hold for an object, and whether
+// they hold it at all. Writes that have been observed are forgotten, and so
+// are all of them once they have been expected for expectationsTimeout.
+func (e *expectations) pending(fooKey string, now time.Time, cached func(obj runtime.Object) (string, bool, error)) (time.Duration, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	foo, ok := e.foos[fooKey]
+	if !ok {
+		return 0, nil
+	}
+	for key, write := range foo.writes {
+		resourceVersion, ok, err := cached(write.object)
+		if err != nil {
+			return 0, err
+		}
+		if write.observedBy(resourceVersion, ok) {
+			delete(foo.writes, key)
+		}
+	}
+	waited := now.Sub(foo.timestamp)
+	if len(foo.writes) == 0 || waited >= expectationsTimeout {
+		delete(e.foos, fooKey)
+		return 0, nil
+	}
+	return expectationsTimeout - waited, nil
+}
+
+// cachedResourceVersion returns the resource version the informers hold for
+// a Deployment or Service, and whether they hold it at all.
+func (c *Controller) cachedResourceVersion(obj runtime.Object) (string, bool, error) {
+	var resourceVersion string
+	var err error
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		var d *appsv1.Deployment
+		if d, err = c.deploymentsLister.Deployments(obj.Namespace).Get(obj.Name); err == nil {
+			resourceVersion = d.ResourceVersion
+		}
+	case *corev1.Service:
+		var s *corev1.Service
+		if s, err = c.servicesLister.Services(obj.Namespace).Get(obj.Name); err == nil {
+			resourceVersion = s.ResourceVersion
+		}
+	}
+	if errors.IsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return resourceVersion, true, nil
+}
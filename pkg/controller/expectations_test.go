@@ -0,0 +1,151 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// creates counts the Deployments the controller has tried to create.
+func (r *rolloutFixture) creates() int {
+	n := 0
+	for _, action := range r.kubeclient.Actions() {
+		if action.Matches("create", "deployments") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestExpectationsHoldBackStaleSync(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	key := getKey(foo, t)
+	if _, err := r.c.syncHandler(key); err != nil {
+		t.Fatalf("error syncing foo: %v", err)
+	}
+	if got := r.creates(); got != 1 {
+		t.Fatalf("expected 1 create, got %d", got)
+	}
+
+	// The informers have not observed the new Deployment yet, so syncing
+	// again would create it again.
+	result, err := r.c.syncHandler(key)
+	if err != nil {
+		t.Fatalf("error syncing foo: %v", err)
+	}
+	if got := r.creates(); got != 1 {
+		t.Errorf("expected no create from the stale cache, got %d", got-1)
+	}
+	if result.requeueAfter != expectationsTimeout {
+		t.Errorf("expected foo to be queued again in %v, got %v", expectationsTimeout, result.requeueAfter)
+	}
+
+	r.refresh()
+	r.sync(foo)
+	if got := r.creates(); got != 1 {
+		t.Errorf("expected no create once the deployment is observed, got %d", got-1)
+	}
+	if got := r.foo("test").Status.DeploymentName; got != "test-deployment" {
+		t.Errorf("expected status to track test-deployment, got %q", got)
+	}
+}
+
+func TestExpectationsTimeOut(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	key := getKey(foo, t)
+	if _, err := r.c.syncHandler(key); err != nil {
+		t.Fatalf("error syncing foo: %v", err)
+	}
+
+	r.clock.Step(expectationsTimeout - 1)
+	if result, _ := r.c.syncHandler(key); result.requeueAfter != 1 {
+		t.Errorf("expected foo to be queued again in 1ns, got %v", result.requeueAfter)
+	}
+	r.clock.Step(1)
+	// The Deployment is never observed, so the controller gives up waiting
+	// and tries to create it again.
+	r.c.syncHandler(key)
+	if got := r.creates(); got != 2 {
+		t.Errorf("expected the deployment to be created again, got %d creates", got)
+	}
+}
+
+func TestExpectationsForgetDeletedFoo(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	key := getKey(foo, t)
+	if _, err := r.c.syncHandler(key); err != nil {
+		t.Fatalf("error syncing foo: %v", err)
+	}
+	r.i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Delete(foo)
+	if _, err := r.c.syncHandler(key); err != nil {
+		t.Fatalf("error syncing deleted foo: %v", err)
+	}
+	if _, ok := r.c.expectations.foos[key]; ok {
+		t.Errorf("expected the expectations of the deleted foo to be forgotten")
+	}
+}
+
+func TestExpectedWriteObservedBy(t *testing.T) {
+	tests := []struct {
+		name            string
+		from, to        string
+		resourceVersion string
+		cached          bool
+		expected        bool
+	}{
+		{name: "create not cached", to: "2"},
+		{name: "create cached", to: "2", resourceVersion: "2", cached: true, expected: true},
+		{name: "create cached and changed since", to: "2", resourceVersion: "3", cached: true, expected: true},
+		{name: "update not observed", from: "1", to: "2", resourceVersion: "1", cached: true},
+		{name: "update observed", from: "1", to: "2", resourceVersion: "2", cached: true, expected: true},
+		{name: "update observed and changed since", from: "1", to: "2", resourceVersion: "3", cached: true, expected: true},
+		{name: "updated object deleted", from: "1", to: "2"},
+		{name: "update without resource versions", cached: true, expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := expectedWrite{from: test.from, to: test.to}
+			if got := w.observedBy(test.resourceVersion, test.cached); got != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestExpectationsChainWrites(t *testing.T) {
+	e := newExpectations()
+	d := newDeployment(newFoo("test", int32Ptr(1)))
+	e.expectWrite("default/test", d, "1", "2", fixtureTime)
+	e.expectWrite("default/test", d, "2", "3", fixtureTime)
+
+	// Holding the version the first write was planned from means the
+	// informers have observed neither write.
+	cached := func(version string) func(runtime.Object) (string, bool, error) {
+		return func(runtime.Object) (string, bool, error) { return version, true, nil }
+	}
+	if wait, _ := e.pending("default/test", fixtureTime, cached("1")); wait == 0 {
+		t.Errorf("expected to wait while the informers hold the planned version")
+	}
+	if wait, _ := e.pending("default/test", fixtureTime, cached("3")); wait != 0 {
+		t.Errorf("expected not to wait once the last write is observed, got %v", wait)
+	}
+}
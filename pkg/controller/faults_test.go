@@ -0,0 +1,190 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/faults"
+)
+
+var (
+	faultSeed       = flag.Int64("fault-seed", 1, "seed of the faults injected by TestConvergenceUnderFaults")
+	faultRandomSeed = flag.Bool("fault-random-seed", false, "inject faults from a random seed into TestConvergenceUnderFaults, instead of -fault-seed")
+)
+
+// TestConvergenceUnderFaults changes many Foos at random while requests
+// fail, and checks that every Foo ends up with exactly the Deployment it
+// asks for. A failure is reproduced by passing the seed it logs with
+// -fault-seed, although the order in which requests draw faults also depends
+// on the informers. -fault-random-seed tries another seed on every run.
+func TestConvergenceUnderFaults(t *testing.T) {
+	const (
+		foos            = 10
+		mutationRounds  = 20
+		maxSettleRounds = 200
+	)
+	if testing.Short() {
+		t.Skip("skipping convergence test in short mode")
+	}
+	seed := *faultSeed
+	if *faultRandomSeed {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("fault seed %d", seed)
+	random := rand.New(rand.NewSource(seed))
+
+	var objects []runtime.Object
+	for n := 0; n < foos; n++ {
+		foo := newFoo(fmt.Sprintf("foo-%d", n), int32Ptr(1))
+		foo.Spec.DeploymentRenamePolicy = samplecontroller.DeploymentRenamePolicyMigrate
+		objects = append(objects, foo)
+	}
+	s := newScenario(t, objects...)
+	injector := faults.NewInjector(seed,
+		faults.Fault{Verb: "*", Resource: "*", Latency: time.Millisecond},
+		faults.Fault{Verb: "create", Resource: "*", ErrorRate: 0.2, TimeoutRate: 0.05},
+		faults.Fault{Verb: "update", Resource: "*", ErrorRate: 0.1, TimeoutRate: 0.05, ConflictRate: 0.15},
+		faults.Fault{Verb: "patch", Resource: "*", ErrorRate: 0.1, ConflictRate: 0.1},
+		faults.Fault{Verb: "delete", Resource: "*", ErrorRate: 0.2},
+	)
+	injector.Install(&s.client.Fake, &s.kubeclient.Fake)
+
+	// step lets the controller work under faults, then acts as the
+	// Deployment controller and rolls out whatever it was asked to.
+	step := func() {
+		injector.SetEnabled(true)
+		s.drain()
+		if d, ok := s.queue.next(); ok {
+			s.advance(d)
+		}
+		injector.SetEnabled(false)
+		for _, d := range s.deployments() {
+			if !deploymentComplete(d) {
+				s.rollOut(d.Name)
+			}
+		}
+	}
+
+	for round := 0; round < mutationRounds; round++ {
+		name := fmt.Sprintf("foo-%d", random.Intn(foos))
+		s.updateFoo(name, func(foo *samplecontroller.Foo) {
+			switch random.Intn(3) {
+			case 0:
+				foo.Spec.Replicas = int32Ptr(1 + random.Int31n(4))
+			case 1:
+				foo.Spec.Image = fmt.Sprintf("nginx:1.%d", random.Intn(30))
+			case 2:
+				foo.Spec.DeploymentName = fmt.Sprintf("%s-deployment-%d", foo.Name, round)
+			}
+		})
+		step()
+	}
+
+	for round := 0; !s.converged(); round++ {
+		if round == maxSettleRounds {
+			s.expectConverged()
+			t.Fatalf("foos did not converge after %d rounds", maxSettleRounds)
+		}
+		step()
+	}
+	s.expectConverged()
+	if injector.Total() == 0 {
+		t.Errorf("expected faults to be injected")
+	}
+}
+
+// deployments returns every Deployment in the cluster.
+func (s *scenario) deployments() []*apps.Deployment {
+	s.t.Helper()
+	list, err := s.kubeclient.AppsV1().Deployments(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		s.t.Fatalf("error listing deployments: %v", err)
+	}
+	var deployments []*apps.Deployment
+	for i := range list.Items {
+		deployments = append(deployments, &list.Items[i])
+	}
+	return deployments
+}
+
+// convergenceErrors returns how the cluster differs from what its Foos ask
+// for: each Foo must control exactly one Deployment, under its deployment
+// name and with its spec, and report it as available.
+func (s *scenario) convergenceErrors() []string {
+	s.t.Helper()
+	list, err := s.client.SamplecontrollerV1alpha1().Foos(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		s.t.Fatalf("error listing foos: %v", err)
+	}
+	controlled := map[string][]string{}
+	var errs []string
+	for _, d := range s.deployments() {
+		owner := metav1.GetControllerOf(d)
+		if owner == nil {
+			errs = append(errs, fmt.Sprintf("deployment %s has no controller", d.Name))
+			continue
+		}
+		controlled[owner.Name] = append(controlled[owner.Name], d.Name)
+	}
+	for i := range list.Items {
+		foo := &list.Items[i]
+		if names := controlled[foo.Name]; len(names) != 1 || names[0] != foo.Spec.DeploymentName {
+			errs = append(errs, fmt.Sprintf("foo %s: expected to control deployment %s, controls %v", foo.Name, foo.Spec.DeploymentName, names))
+			continue
+		}
+		d := s.deployment(foo.Spec.DeploymentName)
+		image := foo.Spec.Image
+		if image == "" {
+			image = defaultImage
+		}
+		if *d.Spec.Replicas != *foo.Spec.Replicas || d.Spec.Template.Spec.Containers[0].Image != image {
+			errs = append(errs, fmt.Sprintf("foo %s: expected %d replicas of %s, deployment has %d of %s",
+				foo.Name, *foo.Spec.Replicas, image, *d.Spec.Replicas, d.Spec.Template.Spec.Containers[0].Image))
+		}
+		if foo.Status.AvailableReplicas != *foo.Spec.Replicas || foo.Status.DeploymentName != foo.Spec.DeploymentName {
+			errs = append(errs, fmt.Sprintf("foo %s: status reports %d available replicas of %s", foo.Name, foo.Status.AvailableReplicas, foo.Status.DeploymentName))
+		}
+		if cond := meta.FindStatusCondition(foo.Status.Conditions, samplecontroller.FooConditionSynced); cond == nil || cond.Status != metav1.ConditionTrue {
+			errs = append(errs, fmt.Sprintf("foo %s: expected to be synced, got %+v", foo.Name, cond))
+		}
+	}
+	return errs
+}
+
+func (s *scenario) converged() bool {
+	s.t.Helper()
+	return len(s.convergenceErrors()) == 0
+}
+
+func (s *scenario) expectConverged() {
+	s.t.Helper()
+	for _, err := range s.convergenceErrors() {
+		s.t.Error(err)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"expvar"
+	"sync"
+)
+
+// CounterMetric represents a single numerical value that only ever goes up.
+type CounterMetric interface {
+	Inc()
+}
+
+// GaugeMetric represents a single numerical value that can go up and down.
+type GaugeMetric interface {
+	Inc()
+	Dec()
+}
+
+// HistogramMetric counts the observations of a value in buckets.
+type HistogramMetric interface {
+	Observe(float64)
+}
+
+// MetricsProvider creates the metrics recorded by the controller. Like
+// workqueue.MetricsProvider, it keeps the controller independent of any
+// particular metrics library.
+type MetricsProvider interface {
+	// NewSyncErrorsMetric counts the errors syncing Foos of one class:
+	// transient, terminal or requeue_after.
+	NewSyncErrorsMetric(class string) CounterMetric
+	// NewStalledMetric counts the Foos marked Stalled, once each time their
+	// Stalled condition turns True.
+	NewStalledMetric() CounterMetric
+}
+
+// QueueMetricsProvider creates the metrics of the queue of the controller. A
+// MetricsProvider records them by implementing it as well. The priority band
+// of a Foo is either user, for changes users made to it, or background.
+type QueueMetricsProvider interface {
+	// NewQueueDepthMetric tracks how many Foos of a namespace wait in a
+	// priority band.
+	NewQueueDepthMetric(priority, namespace string) GaugeMetric
+	// NewQueueAddsMetric counts the Foos of a namespace queued in a
+	// priority band.
+	NewQueueAddsMetric(priority, namespace string) CounterMetric
+	// NewQueueLatencyMetric observes how many seconds Foos waited in a
+	// priority band.
+	NewQueueLatencyMetric(priority string) HistogramMetric
+	// NewWorkDurationMetric observes how many seconds syncing a Foo taken
+	// from a priority band took.
+	NewWorkDurationMetric(priority string) HistogramMetric
+}
+
+// SweepMetricsProvider creates the metrics of the sweeper. A MetricsProvider
+// records them by implementing it as well.
+type SweepMetricsProvider interface {
+	// NewLeakedDeploymentsMetric counts the leaked Deployments the sweeper
+	// handled one way: found or deleted.
+	NewLeakedDeploymentsMetric(outcome string) CounterMetric
+}
+
+type noopMetric struct{}
+
+func (noopMetric) Inc()            {}
+func (noopMetric) Dec()            {}
+func (noopMetric) Observe(float64) {}
+
+type noopMetricsProvider struct{}
+
+func (noopMetricsProvider) NewSyncErrorsMetric(string) CounterMetric { return noopMetric{} }
+func (noopMetricsProvider) NewStalledMetric() CounterMetric          { return noopMetric{} }
+
+var (
+	globalMetricsProvider  MetricsProvider = noopMetricsProvider{}
+	setMetricsProviderOnce sync.Once
+)
+
+// SetMetricsProvider sets the metrics provider for all controllers created
+// afterwards. Only the first call has an effect.
+func SetMetricsProvider(provider MetricsProvider) {
+	setMetricsProviderOnce.Do(func() {
+		globalMetricsProvider = provider
+	})
+}
+
+// syncMetrics are the metrics of one controller.
+type syncMetrics struct {
+	syncErrors map[errorClass]CounterMetric
+	stalled    CounterMetric
+}
+
+func newSyncMetrics(provider MetricsProvider) *syncMetrics {
+	m := &syncMetrics{
+		syncErrors: map[errorClass]CounterMetric{},
+		stalled:    provider.NewStalledMetric(),
+	}
+	for _, class := range errorClasses {
+		m.syncErrors[class] = provider.NewSyncErrorsMetric(string(class))
+	}
+	return m
+}
+
+// queueMetrics are the metrics of one fairQueue. The metrics of each
+// namespace are created when it is first queued. They are only used with
+// the lock of the queue held.
+type queueMetrics struct {
+	provider     QueueMetricsProvider
+	depths       map[queueMetricKey]GaugeMetric
+	addCounts    map[queueMetricKey]CounterMetric
+	latencies    [numPriorities]HistogramMetric
+	workDuration [numPriorities]HistogramMetric
+}
+
+type queueMetricKey struct {
+	priority  priority
+	namespace string
+}
+
+func newQueueMetrics(provider MetricsProvider) *queueMetrics {
+	queueProvider, ok := provider.(QueueMetricsProvider)
+	if !ok {
+		queueProvider = noopQueueMetricsProvider{}
+	}
+	m := &queueMetrics{
+		provider:  queueProvider,
+		depths:    map[queueMetricKey]GaugeMetric{},
+		addCounts: map[queueMetricKey]CounterMetric{},
+	}
+	for p := priority(0); p < numPriorities; p++ {
+		m.latencies[p] = queueProvider.NewQueueLatencyMetric(p.String())
+		m.workDuration[p] = queueProvider.NewWorkDurationMetric(p.String())
+	}
+	return m
+}
+
+func (m *queueMetrics) depth(p priority, namespace string) GaugeMetric {
+	key := queueMetricKey{p, namespace}
+	if _, ok := m.depths[key]; !ok {
+		m.depths[key] = m.provider.NewQueueDepthMetric(p.String(), namespace)
+	}
+	return m.depths[key]
+}
+
+func (m *queueMetrics) adds(p priority, namespace string) CounterMetric {
+	key := queueMetricKey{p, namespace}
+	if _, ok := m.addCounts[key]; !ok {
+		m.addCounts[key] = m.provider.NewQueueAddsMetric(p.String(), namespace)
+	}
+	return m.addCounts[key]
+}
+
+func (m *queueMetrics) latency(p priority) HistogramMetric {
+	return m.latencies[p]
+}
+
+func (m *queueMetrics) workDurationOf(p priority) HistogramMetric {
+	return m.workDuration[p]
+}
+
+type noopQueueMetricsProvider struct{}
+
+func (noopQueueMetricsProvider) NewQueueDepthMetric(string, string) GaugeMetric  { return noopMetric{} }
+func (noopQueueMetricsProvider) NewQueueAddsMetric(string, string) CounterMetric { return noopMetric{} }
+func (noopQueueMetricsProvider) NewQueueLatencyMetric(string) HistogramMetric    { return noopMetric{} }
+func (noopQueueMetricsProvider) NewWorkDurationMetric(string) HistogramMetric    { return noopMetric{} }
+
+// sweepMetrics are the metrics of the sweeper of one controller.
+type sweepMetrics struct {
+	found   CounterMetric
+	deleted CounterMetric
+}
+
+func newSweepMetrics(provider MetricsProvider) *sweepMetrics {
+	sweepProvider, ok := provider.(SweepMetricsProvider)
+	if !ok {
+		sweepProvider = noopSweepMetricsProvider{}
+	}
+	return &sweepMetrics{
+		found:   sweepProvider.NewLeakedDeploymentsMetric("found"),
+		deleted: sweepProvider.NewLeakedDeploymentsMetric("deleted"),
+	}
+}
+
+type noopSweepMetricsProvider struct{}
+
+func (noopSweepMetricsProvider) NewLeakedDeploymentsMetric(string) CounterMetric { return noopMetric{} }
+
+// ExpvarMetricsProvider publishes the metrics of the controller with expvar,
+// under /debug/vars.
+type ExpvarMetricsProvider struct {
+	syncErrors   *expvar.Map
+	stalled      *expvar.Int
+	queueDepth   *expvar.Map
+	queueAdds    *expvar.Map
+	queueLatency *expvar.Map
+	workDuration *expvar.Map
+	leaked       *expvar.Map
+}
+
+// NewExpvarMetricsProvider returns an ExpvarMetricsProvider. expvar names are
+// global, so it must be called at most once per process.
+func NewExpvarMetricsProvider() *ExpvarMetricsProvider {
+	return &ExpvarMetricsProvider{
+		syncErrors:   expvar.NewMap("foo_sync_errors_total"),
+		stalled:      expvar.NewInt("foo_stalled_total"),
+		queueDepth:   expvar.NewMap("foo_queue_depth"),
+		queueAdds:    expvar.NewMap("foo_queue_adds_total"),
+		queueLatency: expvar.NewMap("foo_queue_latency_seconds"),
+		workDuration: expvar.NewMap("foo_work_duration_seconds"),
+		leaked:       expvar.NewMap("foo_leaked_deployments_total"),
+	}
+}
+
+type expvarMapCounter struct {
+	m   *expvar.Map
+	key string
+}
+
+func (c expvarMapCounter) Inc() { c.m.Add(c.key, 1) }
+
+type expvarIntCounter struct {
+	i *expvar.Int
+}
+
+func (c expvarIntCounter) Inc() { c.i.Add(1) }
+
+type expvarMapGauge struct {
+	m   *expvar.Map
+	key string
+}
+
+func (g expvarMapGauge) Inc() { g.m.Add(g.key, 1) }
+func (g expvarMapGauge) Dec() { g.m.Add(g.key, -1) }
+
+// expvarSummary publishes the count and sum of the observations of a
+// histogram, as expvar has no buckets.
+type expvarSummary struct {
+	m   *expvar.Map
+	key string
+}
+
+func (s expvarSummary) Observe(v float64) {
+	s.m.Add(s.key+"_count", 1)
+	s.m.AddFloat(s.key+"_sum", v)
+}
+
+func (p *ExpvarMetricsProvider) NewSyncErrorsMetric(class string) CounterMetric {
+	// Publish every class, not only those that have occurred.
+	p.syncErrors.Add(class, 0)
+	return expvarMapCounter{m: p.syncErrors, key: class}
+}
+
+func (p *ExpvarMetricsProvider) NewStalledMetric() CounterMetric {
+	return expvarIntCounter{i: p.stalled}
+}
+
+// The queue metrics of a namespace are keyed by priority/namespace.
+
+func (p *ExpvarMetricsProvider) NewQueueDepthMetric(priority, namespace string) GaugeMetric {
+	return expvarMapGauge{m: p.queueDepth, key: priority + "/" + namespace}
+}
+
+func (p *ExpvarMetricsProvider) NewQueueAddsMetric(priority, namespace string) CounterMetric {
+	return expvarMapCounter{m: p.queueAdds, key: priority + "/" + namespace}
+}
+
+func (p *ExpvarMetricsProvider) NewQueueLatencyMetric(priority string) HistogramMetric {
+	return expvarSummary{m: p.queueLatency, key: priority}
+}
+
+func (p *ExpvarMetricsProvider) NewWorkDurationMetric(priority string) HistogramMetric {
+	return expvarSummary{m: p.workDuration, key: priority}
+}
+
+func (p *ExpvarMetricsProvider) NewLeakedDeploymentsMetric(outcome string) CounterMetric {
+	p.leaked.Add(outcome, 0)
+	return expvarMapCounter{m: p.leaked, key: outcome}
+}
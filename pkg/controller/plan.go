@@ -0,0 +1,492 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// ActionType is the kind of write an Action makes.
+type ActionType string
+
+const (
+	// ActionCreate creates Action.Object.
+	ActionCreate ActionType = "Create"
+	// ActionUpdate replaces the object with Action.Object.
+	ActionUpdate ActionType = "Update"
+	// ActionPatch applies Action.Patch, a strategic merge patch, to
+	// Action.Object.
+	ActionPatch ActionType = "Patch"
+	// ActionDelete deletes Action.Object.
+	ActionDelete ActionType = "Delete"
+)
+
+// Action is a write to a Deployment or Service of a Foo.
+type Action struct {
+	Type ActionType
+	// Object is the object to create or update, or the object to patch or
+	// delete as it was observed.
+	Object runtime.Object
+	// Patch is the strategic merge patch applied by an ActionPatch.
+	Patch []byte
+	// Event is recorded for the Foo once the action has been applied, unless
+	// it is nil.
+	Event *Event
+}
+
+// Event is an Event recorded for a Foo.
+type Event struct {
+	// Type is corev1.EventTypeNormal or corev1.EventTypeWarning.
+	Type    string
+	Reason  string
+	Message string
+}
+
+// Plan is what syncing a Foo changes: the writes to its objects, its new
+// status and the Events reporting them, in the order they are applied.
+type Plan struct {
+	Actions []Action
+	// Status is the new status of the Foo, or nil if it does not change.
+	Status *samplev1alpha1.FooStatus
+	// Events are recorded once the status has been written.
+	Events []Event
+	// RequeueAfter is when the Foo should be synced again, on top of the
+	// changes that queue it anyway. Zero means never.
+	RequeueAfter time.Duration
+	// Err is why the Foo cannot be synced. A plan with an error has no
+	// actions; its status and events report the error.
+	Err error
+}
+
+// Observed is the state of the cluster a Plan is worked out from.
+type Observed struct {
+	// Deployments and Services are the objects of the Foo's namespace that
+	// it controls or may manage by name.
+	Deployments []*appsv1.Deployment
+	Services    []*corev1.Service
+	// Pods are the pods of the Foo. They are only summarized in its status
+	// when SummarizePods is set.
+	Pods          []*corev1.Pod
+	SummarizePods bool
+}
+
+// PlanSync works out how to converge a Foo with the objects observed for it,
+// as of now. It has no side effects: nothing is read from or written to the
+// API, and no Events are recorded.
+func PlanSync(foo *samplev1alpha1.Foo, observed *Observed, now time.Time) *Plan {
+	p := newPlanner(foo, observed, now)
+	p.planSync()
+	return p.plan
+}
+
+// planner works out the plan for a Foo. It keeps track of the objects of the
+// Foo as they will be once the actions planned so far have been applied, so
+// that each step of a strategy sees the effect of the ones before it. The
+// status of those objects is the one last observed.
+type planner struct {
+	foo      *samplev1alpha1.Foo
+	observed *Observed
+	now      time.Time
+	plan     *Plan
+
+	deployments map[string]*appsv1.Deployment
+	services    map[string]*corev1.Service
+	// pending indexes the create or update action planned for an object,
+	// by objectKey, so that later changes to it are folded into one write.
+	pending map[string]int
+}
+
+func newPlanner(foo *samplev1alpha1.Foo, observed *Observed, now time.Time) *planner {
+	if observed == nil {
+		observed = &Observed{}
+	}
+	p := &planner{
+		foo:         foo,
+		observed:    observed,
+		now:         now,
+		plan:        &Plan{},
+		deployments: map[string]*appsv1.Deployment{},
+		services:    map[string]*corev1.Service{},
+		pending:     map[string]int{},
+	}
+	for _, d := range observed.Deployments {
+		p.deployments[d.Name] = d
+	}
+	for _, s := range observed.Services {
+		p.services[s.Name] = s
+	}
+	return p
+}
+
+// planSync compares the actual state with the desired, and plans the writes
+// converging the two along with the resulting status of the Foo.
+func (p *planner) planSync() {
+	foo := p.foo
+	// A Foo being deleted is left to the garbage collector, unless its
+	// dependents are to be orphaned, in which case they are released.
+	if foo.DeletionTimestamp != nil {
+		if orphanRequested(foo) {
+			if err := p.releaseOwnedObjects(); err != nil {
+				p.fail(err)
+			}
+		}
+		return
+	}
+
+	if foo.Spec.Paused {
+		return
+	}
+
+	deploymentName := foo.Spec.DeploymentName
+	if deploymentName == "" {
+		// Retrying will not help until the resource is updated, at which
+		// point it will be queued again.
+		p.fail(terminalError(ErrInvalidSpec, fmt.Errorf("deployment name must be specified")))
+		return
+	}
+
+	// Schedules are evaluated before anything else so that an invalid one is
+	// reported without changing anything, and so that the Foo is queued
+	// again at the next schedule boundary whichever strategy it uses.
+	schedules, err := evaluateSchedules(foo, p.now)
+	if err != nil {
+		p.fail(terminalError(ErrInvalidSpec, err))
+		return
+	}
+	var result syncResult
+	if schedules.next != nil {
+		result = requeueAfter(schedules.next.Sub(p.now))
+	}
+
+	if strategy := foo.Spec.Strategy; strategy != nil && strategy.Canary != nil && strategy.BlueGreen != nil {
+		p.fail(terminalError(ErrInvalidSpec, fmt.Errorf("at most one rollout strategy may be specified")))
+		return
+	}
+
+	// If the deployment name has changed since the Foo was last synced, its
+	// rename policy decides whether the Foo moves over to the new name.
+	previousName := p.previousDeploymentName()
+	renamed := previousName != "" && previousName != deploymentName
+	if renamed && foo.Spec.DeploymentRenamePolicy != samplev1alpha1.DeploymentRenamePolicyMigrate {
+		p.refuseRename(previousName)
+		return
+	}
+
+	var status *samplev1alpha1.FooStatus
+	var strategyResult syncResult
+	switch {
+	case foo.Spec.Strategy != nil && foo.Spec.Strategy.Canary != nil:
+		status, strategyResult, err = p.planCanary()
+	case foo.Spec.Strategy != nil && foo.Spec.Strategy.BlueGreen != nil:
+		status, strategyResult, err = p.planBlueGreen()
+	default:
+		status, strategyResult, err = p.planDeployment(schedules.replicas)
+	}
+	if err != nil {
+		p.fail(err)
+		return
+	}
+	result = result.merge(strategyResult)
+
+	status.DeploymentName = deploymentName
+	if renamed {
+		p.migrateDeployments(previousName, status)
+	}
+	p.setScheduleStatus(status)
+	recovered := p.setSyncedCondition(status, metav1.ConditionTrue, SuccessSynced, MessageResourceSynced)
+	meta.RemoveStatusCondition(&status.Conditions, samplev1alpha1.FooConditionStalled)
+	// The pod summary goes last, as whether it is held back depends on
+	// whether anything else in the status changed.
+	result = result.merge(p.setPodSummary(status))
+
+	p.setStatus(status)
+	if recovered {
+		p.event(corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	}
+	p.plan.RequeueAfter = result.requeueAfter
+}
+
+// fail replaces the plan with one recording an error syncing the Foo in its
+// Synced condition. The warning Event is only recorded when the error is
+// first raised, not every time the Foo is retried. A Foo failing with a
+// terminal error is marked Stalled straight away, since it is not retried.
+func (p *planner) fail(err error) {
+	p.plan = &Plan{Err: err}
+	reason := errorReason(err)
+	status := p.foo.Status.DeepCopy()
+	raised := p.setSyncedCondition(status, metav1.ConditionFalse, reason, err.Error())
+	if class, _ := classifyError(err); class == errorClassTerminal {
+		p.setCondition(status, samplev1alpha1.FooConditionStalled, metav1.ConditionTrue, reason, err.Error())
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, samplev1alpha1.FooConditionStalled)
+	}
+	p.setStatus(status)
+	if raised {
+		p.event(corev1.EventTypeWarning, reason, err.Error())
+	}
+}
+
+// planDeployment converges the single Deployment of a Foo that does not use a
+// rollout strategy, and returns the resulting status of the Foo.
+func (p *planner) planDeployment(replicas *int32) (*samplev1alpha1.FooStatus, syncResult, error) {
+	foo := p.foo
+	desired := newDeployment(foo)
+	desired.Spec.Replicas = replicas
+
+	// Get the deployment with the name specified in Foo.spec. If it doesn't
+	// exist, we'll create it.
+	deployment := p.deployment(foo.Spec.DeploymentName)
+	if deployment == nil {
+		deployment = p.createDeployment(desired)
+	}
+
+	// If the Deployment is not controlled by this Foo resource, and cannot be
+	// adopted by it, the sync fails.
+	deployment, err := p.claimDeployment(deployment, desired)
+	if err != nil {
+		return nil, syncResult{}, err
+	}
+
+	// If this number of the replicas on the Foo resource is specified, either
+	// directly or by a schedule, and the number does not equal the current
+	// desired replicas on the Deployment, or the pod template of the Foo has
+	// changed, we should update the Deployment resource.
+	if (desired.Spec.Replicas != nil && *desired.Spec.Replicas != *deployment.Spec.Replicas) ||
+		templateHashOf(deployment) != templateHashOf(desired) {
+		deployment = p.updateDeployment(deployment, desired)
+	}
+
+	// The objects of a rollout strategy that has since been removed from the
+	// Foo are no longer needed once the Deployment has taken over from them.
+	if deploymentComplete(deployment) {
+		p.deleteUnusedDeployments(deployment.Name)
+		p.deleteBlueGreenServices()
+	}
+
+	status := newFooStatus(foo, deployment.Status.AvailableReplicas)
+	p.setRolloutConditions(status, deployment)
+	return status, rolloutResult(deployment), nil
+}
+
+// deleteUnusedDeployments deletes the Deployments the Foo controls under the
+// names of the rollout strategies it is not using, keeping the used ones.
+func (p *planner) deleteUnusedDeployments(used ...string) {
+	keep := sets.NewString(used...)
+	for _, name := range managedDeploymentNames(p.foo.Spec.DeploymentName) {
+		if keep.Has(name) {
+			continue
+		}
+		if d := p.deployment(name); d != nil && metav1.IsControlledBy(d, p.foo) {
+			p.deleteDeployment(d)
+		}
+	}
+}
+
+// deleteBlueGreenServices deletes the Services the Foo controls, which are
+// only managed for the blue/green strategy.
+func (p *planner) deleteBlueGreenServices() {
+	for _, observed := range p.observed.Services {
+		if s := p.service(observed.Name); s != nil && metav1.IsControlledBy(s, p.foo) {
+			p.deleteService(s)
+		}
+	}
+}
+
+// deployment returns the named Deployment as it will be once the actions
+// planned so far are applied, or nil if there is none.
+func (p *planner) deployment(name string) *appsv1.Deployment {
+	return p.deployments[name]
+}
+
+// service returns the named Service as it will be once the actions planned
+// so far are applied, or nil if there is none.
+func (p *planner) service(name string) *corev1.Service {
+	return p.services[name]
+}
+
+// createDeployment plans the creation of a Deployment.
+func (p *planner) createDeployment(deployment *appsv1.Deployment) *appsv1.Deployment {
+	p.addAction(Action{Type: ActionCreate, Object: deployment, Event: createdEvent("Deployment", deployment.Name)})
+	p.deployments[deployment.Name] = deployment
+	return deployment
+}
+
+// updateDeployment plans replacing a Deployment with desired, with an Event
+// saying whether its pod template or only its replicas changed.
+func (p *planner) updateDeployment(current, desired *appsv1.Deployment) *appsv1.Deployment {
+	// Changes to a Deployment already updated by the plan are reported
+	// against the Deployment as it was observed.
+	original := current
+	for _, d := range p.observed.Deployments {
+		if d.Name == desired.Name {
+			original = d
+		}
+	}
+	p.addAction(Action{Type: ActionUpdate, Object: desired, Event: deploymentChangeEvent(original, desired)})
+	// Updates leave the status of a Deployment alone.
+	updated := desired.DeepCopy()
+	updated.Status = current.Status
+	p.deployments[desired.Name] = updated
+	return updated
+}
+
+// scaleDeployment plans setting the replicas of a Deployment, leaving its pod
+// template untouched.
+func (p *planner) scaleDeployment(deployment *appsv1.Deployment, replicas int32) *appsv1.Deployment {
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == replicas {
+		return deployment
+	}
+	// NEVER modify objects from the store.
+	deploymentCopy := deployment.DeepCopy()
+	deploymentCopy.Spec.Replicas = &replicas
+	return p.updateDeployment(deployment, deploymentCopy)
+}
+
+// deleteDeployment plans the deletion of a Deployment.
+func (p *planner) deleteDeployment(deployment *appsv1.Deployment) {
+	p.addAction(Action{Type: ActionDelete, Object: deployment})
+	delete(p.deployments, deployment.Name)
+}
+
+// createService plans the creation of a Service.
+func (p *planner) createService(service *corev1.Service) *corev1.Service {
+	p.addAction(Action{Type: ActionCreate, Object: service, Event: createdEvent("Service", service.Name)})
+	p.services[service.Name] = service
+	return service
+}
+
+// updateService plans replacing a Service with desired.
+func (p *planner) updateService(desired *corev1.Service) *corev1.Service {
+	p.addAction(Action{Type: ActionUpdate, Object: desired})
+	p.services[desired.Name] = desired
+	return desired
+}
+
+// deleteService plans the deletion of a Service.
+func (p *planner) deleteService(service *corev1.Service) {
+	p.addAction(Action{Type: ActionDelete, Object: service})
+	delete(p.services, service.Name)
+}
+
+// addAction appends an action to the plan. Creating or updating an object
+// that is already created or updated by the plan replaces the object of the
+// earlier action instead, so that every object is written at most once.
+func (p *planner) addAction(action Action) {
+	key := objectKey(action.Object)
+	if action.Type == ActionCreate || action.Type == ActionUpdate {
+		if i, ok := p.pending[key]; ok {
+			p.plan.Actions[i].Object = action.Object
+			if p.plan.Actions[i].Type == ActionUpdate {
+				p.plan.Actions[i].Event = action.Event
+			}
+			return
+		}
+		p.pending[key] = len(p.plan.Actions)
+	} else {
+		delete(p.pending, key)
+	}
+	p.plan.Actions = append(p.plan.Actions, action)
+}
+
+// event adds an Event to the plan.
+func (p *planner) event(eventType, reason, message string) {
+	p.plan.Events = append(p.plan.Events, Event{Type: eventType, Reason: reason, Message: message})
+}
+
+func (p *planner) eventf(eventType, reason, messageFmt string, args ...interface{}) {
+	p.event(eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// setStatus sets the new status of the Foo in the plan, unless it is the
+// status the Foo already has. Most syncs, including every resync, change
+// nothing; skipping the write for those saves a round trip to the apiserver
+// and keeps the Foo from being queued again by its own update.
+func (p *planner) setStatus(status *samplev1alpha1.FooStatus) {
+	if apiequality.Semantic.DeepEqual(p.foo.Status, *status) {
+		p.plan.Status = nil
+		return
+	}
+	p.plan.Status = status
+}
+
+// setCondition sets a condition in the status of the Foo. Its transition time
+// only moves when the status of the condition changes.
+func (p *planner) setCondition(status *samplev1alpha1.FooStatus, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: p.foo.Generation,
+		LastTransitionTime: metav1.NewTime(p.now),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setSyncedCondition sets the Synced condition of the Foo, and reports whether
+// its status or reason changed.
+func (p *planner) setSyncedCondition(status *samplev1alpha1.FooStatus, conditionStatus metav1.ConditionStatus, reason, message string) bool {
+	previous := meta.FindStatusCondition(status.Conditions, samplev1alpha1.FooConditionSynced)
+	changed := previous == nil || previous.Status != conditionStatus || previous.Reason != reason
+	p.setCondition(status, samplev1alpha1.FooConditionSynced, conditionStatus, reason, message)
+	return changed
+}
+
+func createdEvent(kind, name string) *Event {
+	return &Event{Type: corev1.EventTypeNormal, Reason: SuccessCreated, Message: fmt.Sprintf(MessageResourceCreated, kind, name)}
+}
+
+// deploymentChangeEvent returns the Event reporting an update of a Deployment:
+// Updated if its pod template changed, Scaled if only its replicas did, and
+// nil otherwise.
+func deploymentChangeEvent(current, updated *appsv1.Deployment) *Event {
+	if templateHashOf(current) != templateHashOf(updated) {
+		return &Event{Type: corev1.EventTypeNormal, Reason: SuccessUpdated, Message: fmt.Sprintf(MessageDeploymentUpdated, updated.Name)}
+	}
+	from, to := int32(1), int32(1)
+	if current.Spec.Replicas != nil {
+		from = *current.Spec.Replicas
+	}
+	if updated.Spec.Replicas != nil {
+		to = *updated.Spec.Replicas
+	}
+	if from != to {
+		return &Event{Type: corev1.EventTypeNormal, Reason: SuccessScaled, Message: fmt.Sprintf(MessageDeploymentScaled, updated.Name, from, to)}
+	}
+	return nil
+}
+
+// objectKey identifies a Deployment or Service of a Foo within a plan.
+func objectKey(obj runtime.Object) string {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return "Deployment/" + obj.Name
+	case *corev1.Service:
+		return "Service/" + obj.Name
+	}
+	return fmt.Sprintf("%T", obj)
+}
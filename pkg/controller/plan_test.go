@@ -0,0 +1,190 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// plannedAction summarizes an Action for comparison: its type, the object it
+// applies to, and the reason of its Event.
+func plannedAction(a Action) string {
+	s := fmt.Sprintf("%s %s", a.Type, objectKey(a.Object))
+	if a.Event != nil {
+		s += " " + a.Event.Reason
+	}
+	return s
+}
+
+func completeDeployment(d *apps.Deployment) *apps.Deployment {
+	d = d.DeepCopy()
+	d.Status.UpdatedReplicas = *d.Spec.Replicas
+	d.Status.AvailableReplicas = *d.Spec.Replicas
+	return d
+}
+
+func TestPlanSync(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	synced := syncedFoo(foo)
+	synced.Status.AvailableReplicas = 2
+
+	scaled := synced.DeepCopy()
+	scaled.Spec.Replicas = int32Ptr(3)
+
+	adopting := foo.DeepCopy()
+	adopting.Spec.AdoptionPolicy = samplecontroller.AdoptionPolicyAdopt
+	adopting.Spec.Replicas = int32Ptr(3)
+
+	unnamed := foo.DeepCopy()
+	unnamed.Spec.DeploymentName = ""
+
+	paused := scaled.DeepCopy()
+	paused.Spec.Paused = true
+
+	blueGreen := syncedFoo(newBlueGreenFoo("test", 2))
+	blueGreen.Spec.Image = "nginx:2"
+	blueGreen.Spec.Strategy.BlueGreen.Promote = true
+	blueGreen.Status.BlueGreen = &samplecontroller.BlueGreenStatus{ActiveColor: samplecontroller.ColorBlue}
+	blue := newBlueGreenFoo("test", 2)
+	blueDeployment := completeDeployment(newColorDeployment(blue, samplecontroller.ColorBlue, 2))
+
+	tests := []struct {
+		name     string
+		foo      *samplecontroller.Foo
+		observed *Observed
+		actions  []string
+		events   []string
+		status   bool
+		err      string
+	}{
+		{
+			name:     "create",
+			foo:      foo,
+			observed: &Observed{},
+			actions:  []string{"Create Deployment/test-deployment Created"},
+			events:   []string{SuccessSynced},
+			status:   true,
+		},
+		{
+			name:     "in sync",
+			foo:      synced,
+			observed: &Observed{Deployments: []*apps.Deployment{completeDeployment(newDeployment(synced))}},
+		},
+		{
+			name:     "scale",
+			foo:      scaled,
+			observed: &Observed{Deployments: []*apps.Deployment{completeDeployment(newDeployment(synced))}},
+			actions:  []string{"Update Deployment/test-deployment Scaled"},
+		},
+		{
+			name:     "adopt and scale",
+			foo:      adopting,
+			observed: &Observed{Deployments: []*apps.Deployment{newOrphanDeployment(foo)}},
+			actions:  []string{"Patch Deployment/test-deployment Adopted", "Update Deployment/test-deployment Scaled"},
+			events:   []string{SuccessSynced},
+			status:   true,
+		},
+		{
+			name:     "conflict",
+			foo:      foo,
+			observed: &Observed{Deployments: []*apps.Deployment{newOrphanDeployment(foo)}},
+			events:   []string{ErrResourceExists},
+			status:   true,
+			err:      fmt.Sprintf(MessageResourceExists, "test-deployment"),
+		},
+		{
+			name:     "invalid spec",
+			foo:      unnamed,
+			observed: &Observed{},
+			events:   []string{ErrInvalidSpec},
+			status:   true,
+			err:      "deployment name must be specified",
+		},
+		{
+			name:     "paused",
+			foo:      paused,
+			observed: &Observed{Deployments: []*apps.Deployment{newDeployment(synced)}},
+		},
+		{
+			// The Service is switched to the preview color in one write,
+			// even though it is first brought in line with the active one.
+			name: "blue/green promotion",
+			foo:  blueGreen,
+			observed: &Observed{
+				Deployments: []*apps.Deployment{blueDeployment, completeDeployment(newColorDeployment(blueGreen, samplecontroller.ColorGreen, 2))},
+				Services:    []*corev1.Service{newBlueGreenService(blueGreen, samplecontroller.ColorBlue)},
+			},
+			actions: []string{"Update Service/test-deployment", "Update Deployment/test-deployment-blue Scaled"},
+			events:  []string{BlueGreenPromoted},
+			status:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := PlanSync(test.foo, test.observed, fixtureTime)
+
+			var actions []string
+			for _, a := range plan.Actions {
+				actions = append(actions, plannedAction(a))
+			}
+			if !reflect.DeepEqual(actions, test.actions) {
+				t.Errorf("expected actions %q, got %q", test.actions, actions)
+			}
+			var events []string
+			for _, e := range plan.Events {
+				events = append(events, e.Reason)
+			}
+			if !reflect.DeepEqual(events, test.events) {
+				t.Errorf("expected events %q, got %q", test.events, events)
+			}
+			if got := plan.Status != nil; got != test.status {
+				t.Errorf("expected a status change %v, got %+v", test.status, plan.Status)
+			}
+			if (plan.Err == nil) != (test.err == "") || (plan.Err != nil && plan.Err.Error() != test.err) {
+				t.Errorf("expected error %q, got %v", test.err, plan.Err)
+			}
+		})
+	}
+}
+
+func TestPlanSyncPure(t *testing.T) {
+	foo := newCanaryFoo("test", 4, samplecontroller.CanaryStep{Weight: 25})
+	foo.Spec.Image = "nginx:2"
+	stable := newFoo("test", int32Ptr(4))
+	stable.Spec.Strategy = foo.Spec.Strategy
+	observed := &Observed{Deployments: []*apps.Deployment{completeDeployment(newDeployment(stable))}}
+	fooCopy, observedDeployment := foo.DeepCopy(), observed.Deployments[0].DeepCopy()
+
+	first := PlanSync(foo, observed, fixtureTime)
+	second := PlanSync(foo, observed, fixtureTime)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same plan for the same input, got\n%+v\nand\n%+v", first, second)
+	}
+	if !reflect.DeepEqual(foo, fooCopy) || !reflect.DeepEqual(observed.Deployments[0], observedDeployment) {
+		t.Errorf("expected the Foo and observed objects to be left unchanged")
+	}
+	if len(first.Actions) != 2 {
+		t.Errorf("expected the canary to be created and the stable Deployment scaled down, got %d actions", len(first.Actions))
+	}
+}
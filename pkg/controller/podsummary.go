@@ -0,0 +1,181 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// PodLabelSelector selects the pods of every Foo. Pod informers should be
+	// restricted to it, so that the controller does not cache every pod in
+	// the cluster.
+	PodLabelSelector = "app=nginx,controller"
+	// podSummaryInterval is the minimum time between two status writes of a
+	// Foo caused only by changes to its pods.
+	podSummaryInterval = 15 * time.Second
+	// maxRecentTerminations is how many container terminations are kept in
+	// the pod summary of a Foo.
+	maxRecentTerminations = 5
+)
+
+// enablePodSummary makes the controller summarize the pods of each Foo in
+// its status. The informer is expected to be restricted to PodLabelSelector.
+func (c *Controller) enablePodSummary(podInformer coreinformers.PodInformer) {
+	c.podsLister = podInformer.Lister()
+	c.podsSynced = podInformer.Informer().HasSynced
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.handlePod,
+		UpdateFunc: func(old, new interface{}) {
+			newPod := new.(*corev1.Pod)
+			oldPod := old.(*corev1.Pod)
+			if newPod.ResourceVersion == oldPod.ResourceVersion {
+				return
+			}
+			c.handlePod(new)
+		},
+		DeleteFunc: c.handlePod,
+	})
+}
+
+// handlePod enqueues the Foo a pod belongs to. Pods are owned by ReplicaSets
+// rather than Foos, so they are matched through the labels of the pod
+// template instead of their owner references.
+func (c *Controller) handlePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		pod, ok = tombstone.Obj.(*corev1.Pod)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+	}
+	name, ok := pod.Labels["controller"]
+	if !ok {
+		return
+	}
+	foo, err := c.foosLister.Foos(pod.Namespace).Get(name)
+	if err != nil {
+		c.logger.V(4).Info("Ignoring pod of unknown foo", "pod", klog.KObj(pod), "foo", name)
+		return
+	}
+	c.enqueueFoo(foo)
+}
+
+// setPodSummary sets the pod summary in the status of the Foo. When nothing
+// but the pods changed since the status was last written, the new summary is
+// held back until podSummaryInterval has passed, and the returned result
+// queues the Foo again for then.
+func (p *planner) setPodSummary(status *samplev1alpha1.FooStatus) syncResult {
+	if !p.observed.SummarizePods {
+		status.Pods = nil
+		return syncResult{}
+	}
+	summary := summarizePods(p.observed.Pods)
+
+	previous := p.foo.Status.Pods
+	status.Pods = previous
+	if previous != nil {
+		summary.LastUpdateTime = previous.LastUpdateTime
+		if apiequality.Semantic.DeepEqual(previous, summary) {
+			return syncResult{}
+		}
+		// The status is written anyway when anything else changed, in which
+		// case the summary might as well be brought up to date.
+		if apiequality.Semantic.DeepEqual(*status, p.foo.Status) {
+			if remaining := podSummaryInterval - p.now.Sub(previous.LastUpdateTime.Time); remaining > 0 {
+				return requeueAfter(remaining)
+			}
+		}
+	}
+	summary.LastUpdateTime = metav1.NewTime(p.now)
+	status.Pods = summary
+	return syncResult{}
+}
+
+// summarizePods counts pods by phase, readiness and restarts, and collects
+// their most recent container terminations.
+func summarizePods(pods []*corev1.Pod) *samplev1alpha1.PodSummary {
+	summary := &samplev1alpha1.PodSummary{}
+	for _, pod := range pods {
+		switch pod.Status.Phase {
+		case corev1.PodPending:
+			summary.Pending++
+		case corev1.PodRunning:
+			summary.Running++
+		case corev1.PodSucceeded:
+			summary.Succeeded++
+		case corev1.PodFailed:
+			summary.Failed++
+		default:
+			summary.Unknown++
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				summary.Ready++
+			}
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			summary.Restarts += cs.RestartCount
+			for _, terminated := range []*corev1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+				if terminated == nil {
+					continue
+				}
+				summary.RecentTerminations = append(summary.RecentTerminations, samplev1alpha1.ContainerTermination{
+					Pod:        pod.Name,
+					Container:  cs.Name,
+					Reason:     terminated.Reason,
+					ExitCode:   terminated.ExitCode,
+					FinishedAt: terminated.FinishedAt,
+				})
+			}
+		}
+	}
+	// Pods are listed in no particular order, so ties are broken by name to
+	// keep the summary stable between syncs.
+	sort.Slice(summary.RecentTerminations, func(i, j int) bool {
+		a, b := summary.RecentTerminations[i], summary.RecentTerminations[j]
+		if !a.FinishedAt.Equal(&b.FinishedAt) {
+			return b.FinishedAt.Before(&a.FinishedAt)
+		}
+		if a.Pod != b.Pod {
+			return a.Pod < b.Pod
+		}
+		return a.Container < b.Container
+	})
+	if len(summary.RecentTerminations) > maxRecentTerminations {
+		summary.RecentTerminations = summary.RecentTerminations[:maxRecentTerminations]
+	}
+	return summary
+}
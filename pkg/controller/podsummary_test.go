@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func newPod(foo *samplecontroller.Foo, name string, phase corev1.PodPhase, restarts int32) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: foo.Namespace,
+			Labels:    newDeployment(foo).Spec.Template.Labels,
+		},
+		Status: corev1.PodStatus{
+			Phase: phase,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "nginx", RestartCount: restarts},
+			},
+		},
+	}
+}
+
+func terminated(reason string, exitCode int32, finishedAt time.Time) corev1.ContainerState {
+	return corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode, FinishedAt: metav1.NewTime(finishedAt)},
+	}
+}
+
+func TestSummarizePods(t *testing.T) {
+	foo := newFoo("test", int32Ptr(3))
+	running := newPod(foo, "running", corev1.PodRunning, 0)
+	running.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	crashing := newPod(foo, "crashing", corev1.PodRunning, 4)
+	crashing.Status.ContainerStatuses[0].LastTerminationState = terminated("OOMKilled", 137, fixtureTime)
+	failed := newPod(foo, "failed", corev1.PodFailed, 0)
+	failed.Status.ContainerStatuses[0].State = terminated("Error", 1, fixtureTime.Add(-time.Minute))
+	pending := newPod(foo, "pending", corev1.PodPending, 0)
+
+	summary := summarizePods([]*corev1.Pod{running, crashing, failed, pending})
+	expected := &samplecontroller.PodSummary{
+		Pending:  1,
+		Running:  2,
+		Failed:   1,
+		Ready:    1,
+		Restarts: 4,
+		RecentTerminations: []samplecontroller.ContainerTermination{
+			{Pod: "crashing", Container: "nginx", Reason: "OOMKilled", ExitCode: 137, FinishedAt: metav1.NewTime(fixtureTime)},
+			{Pod: "failed", Container: "nginx", Reason: "Error", ExitCode: 1, FinishedAt: metav1.NewTime(fixtureTime.Add(-time.Minute))},
+		},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected summary\n%+v\ngot\n%+v", expected, summary)
+	}
+}
+
+func TestSummarizePodsKeepsRecentTerminations(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	var pods []*corev1.Pod
+	for i := 0; i < maxRecentTerminations+2; i++ {
+		pod := newPod(foo, fmt.Sprintf("pod-%d", i), corev1.PodRunning, 1)
+		pod.Status.ContainerStatuses[0].LastTerminationState = terminated("Error", 1, fixtureTime.Add(time.Duration(i)*time.Minute))
+		pods = append(pods, pod)
+	}
+	summary := summarizePods(pods)
+	if len(summary.RecentTerminations) != maxRecentTerminations {
+		t.Fatalf("expected %d terminations, got %d", maxRecentTerminations, len(summary.RecentTerminations))
+	}
+	if got := summary.RecentTerminations[0].Pod; got != fmt.Sprintf("pod-%d", maxRecentTerminations+1) {
+		t.Errorf("expected the newest termination first, got %s", got)
+	}
+}
+
+func TestPodSummaryRateLimited(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	pods := r.k8sI.Core().V1().Pods()
+	r.c.enablePodSummary(pods)
+	pod := newPod(foo, "test-pod", corev1.PodRunning, 0)
+	pods.Informer().GetIndexer().Add(pod)
+
+	r.sync(foo)
+	r.rollOut("test-deployment")
+	r.sync(foo)
+	if got := r.foo("test").Status.Pods; got == nil || got.Running != 1 || !got.LastUpdateTime.Time.Equal(fixtureTime) {
+		t.Fatalf("expected a summary of one running pod, got %+v", got)
+	}
+
+	// A restart alone is held back until the interval has passed.
+	pod = pod.DeepCopy()
+	pod.Status.ContainerStatuses[0].RestartCount = 1
+	pods.Informer().GetIndexer().Update(pod)
+	r.clock.Step(5 * time.Second)
+	if got := r.sync(foo); got != podSummaryInterval-5*time.Second {
+		t.Errorf("expected foo to be queued again in %v, got %v", podSummaryInterval-5*time.Second, got)
+	}
+	if got := r.foo("test").Status.Pods.Restarts; got != 0 {
+		t.Errorf("expected the restart to be held back, got %d restarts", got)
+	}
+
+	r.clock.Step(podSummaryInterval)
+	r.sync(foo)
+	if got := r.foo("test").Status.Pods; got.Restarts != 1 || !got.LastUpdateTime.Time.Equal(r.clock.Now()) {
+		t.Errorf("expected the restart to be written, got %+v", got)
+	}
+
+	// Changes to the rest of the status bring the summary along.
+	pod = pod.DeepCopy()
+	pod.Status.ContainerStatuses[0].RestartCount = 2
+	pods.Informer().GetIndexer().Update(pod)
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Replicas = int32Ptr(2) })
+	r.sync(foo)
+	r.rollOut("test-deployment")
+	r.sync(foo)
+	if got := r.foo("test").Status.Pods.Restarts; got != 2 {
+		t.Errorf("expected the restart to be written with the rest of the status, got %d restarts", got)
+	}
+}
@@ -0,0 +1,426 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// priority is the band of the queue a Foo waits in.
+type priority int
+
+const (
+	// priorityBackground is for syncs no user asked for: resyncs, changes
+	// to the objects of a Foo, polls and retries.
+	priorityBackground priority = iota
+	// priorityUser is for changes users make to Foos, which are synced
+	// ahead of background work.
+	priorityUser
+
+	numPriorities = 2
+)
+
+func (p priority) String() string {
+	if p == priorityUser {
+		return "user"
+	}
+	return "background"
+}
+
+// userBurst is how many Foos are taken from the user band in a row while
+// background Foos wait, so that a stream of user changes cannot starve them.
+const userBurst = 4
+
+// prioritizedQueue is implemented by queues that sync some Foos first.
+type prioritizedQueue interface {
+	addWithPriority(item interface{}, p priority)
+}
+
+// fairQueue is a rate limiting workqueue that shares the workers fairly
+// between namespaces, so that a namespace with thousands of Foos does not hold
+// up the others. Within each priority band, namespaces take turns. Like the
+// workqueues of client-go, it holds each item once, and an item added while
+// it is being processed is queued again once it is done.
+type fairQueue struct {
+	rateLimiter workqueue.RateLimiter
+	clock       clock.Clock
+	metrics     *queueMetrics
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	bands [numPriorities]*band
+	// queued holds the items waiting in a band.
+	queued map[interface{}]*queuedItem
+	// processing holds the items handed out by Get that are not done yet.
+	processing map[interface{}]*queuedItem
+	// dirty holds the priority of the items added while being processed.
+	dirty map[interface{}]priority
+	// userStreak counts the items taken from the user band in a row while
+	// background items waited.
+	userStreak   int
+	shuttingDown bool
+
+	// waiting holds the items added with a delay, soonest first.
+	waiting waitingItems
+	// wake tells waitLoop that an item may be due sooner.
+	wake   chan struct{}
+	stopCh chan struct{}
+}
+
+var _ workqueue.RateLimitingInterface = &fairQueue{}
+
+type queuedItem struct {
+	item      interface{}
+	priority  priority
+	namespace string
+	// since is when the item was queued, or taken off the queue once it is
+	// being processed.
+	since   time.Time
+	element *list.Element
+}
+
+// band holds the items of one priority, in a list per namespace.
+type band struct {
+	namespaces map[string]*list.List
+	// ring is the order in which the namespaces with items take turns, and
+	// next is the index of the one whose turn it is.
+	ring []string
+	next int
+	len  int
+}
+
+func newFairQueue(rateLimiter workqueue.RateLimiter, clock clock.Clock, provider MetricsProvider) *fairQueue {
+	q := &fairQueue{
+		rateLimiter: rateLimiter,
+		clock:       clock,
+		metrics:     newQueueMetrics(provider),
+		queued:      map[interface{}]*queuedItem{},
+		processing:  map[interface{}]*queuedItem{},
+		dirty:       map[interface{}]priority{},
+		wake:        make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for i := range q.bands {
+		q.bands[i] = &band{namespaces: map[string]*list.List{}}
+	}
+	go q.waitLoop()
+	return q
+}
+
+// namespaceOf returns the namespace of a namespace/name key. Items that are
+// not keys share the empty namespace.
+func namespaceOf(item interface{}) string {
+	key, ok := item.(string)
+	if !ok {
+		return ""
+	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return ""
+	}
+	return namespace
+}
+
+// Add queues an item in the background band.
+func (q *fairQueue) Add(item interface{}) {
+	q.addWithPriority(item, priorityBackground)
+}
+
+// addWithPriority queues an item in the band of p, or moves it up to that
+// band if it is queued in a lower one.
+func (q *fairQueue) addWithPriority(item interface{}, p priority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.addLocked(item, p)
+}
+
+func (q *fairQueue) addLocked(item interface{}, p priority) {
+	if q.shuttingDown {
+		return
+	}
+	if _, ok := q.processing[item]; ok {
+		if previous, ok := q.dirty[item]; !ok || previous < p {
+			q.dirty[item] = p
+		}
+		return
+	}
+	if queued, ok := q.queued[item]; ok {
+		if queued.priority >= p {
+			return
+		}
+		// The item is not added again, and its latency counts from when
+		// it was first queued.
+		q.remove(queued)
+		queued.priority = p
+		q.push(queued)
+		return
+	}
+	queued := &queuedItem{item: item, priority: p, namespace: namespaceOf(item), since: q.clock.Now()}
+	q.metrics.adds(p, queued.namespace).Inc()
+	q.push(queued)
+	q.cond.Signal()
+}
+
+func (q *fairQueue) push(queued *queuedItem) {
+	b := q.bands[queued.priority]
+	items, ok := b.namespaces[queued.namespace]
+	if !ok {
+		items = list.New()
+		b.namespaces[queued.namespace] = items
+		// A namespace new to the band takes its turn after those already
+		// waiting.
+		b.ring = append(b.ring, queued.namespace)
+	}
+	queued.element = items.PushBack(queued)
+	b.len++
+	q.queued[queued.item] = queued
+	q.metrics.depth(queued.priority, queued.namespace).Inc()
+}
+
+func (q *fairQueue) remove(queued *queuedItem) {
+	b := q.bands[queued.priority]
+	items := b.namespaces[queued.namespace]
+	items.Remove(queued.element)
+	b.len--
+	delete(q.queued, queued.item)
+	q.metrics.depth(queued.priority, queued.namespace).Dec()
+	if items.Len() > 0 {
+		return
+	}
+	delete(b.namespaces, queued.namespace)
+	for i, namespace := range b.ring {
+		if namespace != queued.namespace {
+			continue
+		}
+		b.ring = append(b.ring[:i], b.ring[i+1:]...)
+		if i < b.next {
+			b.next--
+		}
+		break
+	}
+	if b.next >= len(b.ring) {
+		b.next = 0
+	}
+}
+
+// pop takes the first item of the namespace whose turn it is in a band.
+func (q *fairQueue) pop(b *band) *queuedItem {
+	namespace := b.ring[b.next]
+	queued := b.namespaces[namespace].Front().Value.(*queuedItem)
+	remaining := b.namespaces[namespace].Len() - 1
+	q.remove(queued)
+	if remaining > 0 {
+		// Removing the last item of a namespace already moved the turn on.
+		b.next = (b.next + 1) % len(b.ring)
+	}
+	return queued
+}
+
+// Get blocks until an item can be processed and returns it, taking items
+// from the user band first, but at most userBurst in a row while background
+// items wait.
+func (q *fairQueue) Get() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	user, background := q.bands[priorityUser], q.bands[priorityBackground]
+	for user.len+background.len == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if user.len+background.len == 0 {
+		return nil, true
+	}
+
+	var queued *queuedItem
+	switch {
+	case user.len > 0 && background.len == 0:
+		q.userStreak = 0
+		queued = q.pop(user)
+	case user.len > 0 && q.userStreak < userBurst:
+		q.userStreak++
+		queued = q.pop(user)
+	default:
+		q.userStreak = 0
+		queued = q.pop(background)
+	}
+	now := q.clock.Now()
+	q.metrics.latency(queued.priority).Observe(now.Sub(queued.since).Seconds())
+	queued.since = now
+	q.processing[queued.item] = queued
+	return queued.item, false
+}
+
+// Done marks an item as processed, and queues it again if it was added while
+// it was being processed.
+func (q *fairQueue) Done(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queued, ok := q.processing[item]; ok {
+		q.metrics.workDurationOf(queued.priority).Observe(q.clock.Since(queued.since).Seconds())
+		delete(q.processing, item)
+	}
+	if p, ok := q.dirty[item]; ok {
+		delete(q.dirty, item)
+		q.addLocked(item, p)
+	}
+}
+
+// Len returns how many items are queued, not counting those being processed
+// or waiting for a delay.
+func (q *fairQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queued)
+}
+
+// ShutDown makes Get return once the queue is empty, and drops the items
+// added from then on.
+func (q *fairQueue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	q.shuttingDown = true
+	close(q.stopCh)
+	q.cond.Broadcast()
+}
+
+func (q *fairQueue) ShuttingDown() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.shuttingDown
+}
+
+// AddAfter queues an item in the background band once the delay has passed.
+// An item already waiting is queued when the sooner of its delays passes.
+func (q *fairQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	if duration <= 0 {
+		q.addLocked(item, priorityBackground)
+		return
+	}
+	readyAt := q.clock.Now().Add(duration)
+	if w, ok := q.waiting.index[item]; ok {
+		if readyAt.Before(w.readyAt) {
+			w.readyAt = readyAt
+			heap.Fix(&q.waiting, w.index)
+		}
+	} else {
+		heap.Push(&q.waiting, &waitingItem{item: item, readyAt: readyAt})
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// waitLoop queues the items added with a delay once it has passed.
+func (q *fairQueue) waitLoop() {
+	for {
+		q.mu.Lock()
+		now := q.clock.Now()
+		for q.waiting.Len() > 0 && !q.waiting.items[0].readyAt.After(now) {
+			w := heap.Pop(&q.waiting).(*waitingItem)
+			q.addLocked(w.item, priorityBackground)
+		}
+		var timer clock.Timer
+		var next <-chan time.Time
+		if q.waiting.Len() > 0 {
+			timer = q.clock.NewTimer(q.waiting.items[0].readyAt.Sub(now))
+			next = timer.C()
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.stopCh:
+		case <-next:
+		case <-q.wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-q.stopCh:
+			return
+		default:
+		}
+	}
+}
+
+func (q *fairQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *fairQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *fairQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+// waitingItem is an item added with a delay.
+type waitingItem struct {
+	item    interface{}
+	readyAt time.Time
+	index   int
+}
+
+// waitingItems is a heap of the items added with a delay, soonest first,
+// indexed by item.
+type waitingItems struct {
+	items []*waitingItem
+	index map[interface{}]*waitingItem
+}
+
+func (w *waitingItems) Len() int           { return len(w.items) }
+func (w *waitingItems) Less(i, j int) bool { return w.items[i].readyAt.Before(w.items[j].readyAt) }
+
+func (w *waitingItems) Swap(i, j int) {
+	w.items[i], w.items[j] = w.items[j], w.items[i]
+	w.items[i].index = i
+	w.items[j].index = j
+}
+
+func (w *waitingItems) Push(x interface{}) {
+	item := x.(*waitingItem)
+	item.index = len(w.items)
+	w.items = append(w.items, item)
+	if w.index == nil {
+		w.index = map[interface{}]*waitingItem{}
+	}
+	w.index[item.item] = item
+}
+
+func (w *waitingItems) Pop() interface{} {
+	item := w.items[len(w.items)-1]
+	w.items = w.items[:len(w.items)-1]
+	delete(w.index, item.item)
+	return item
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+type fakeGauge struct {
+	value int
+}
+
+func (g *fakeGauge) Inc() { g.value++ }
+func (g *fakeGauge) Dec() { g.value-- }
+
+type fakeHistogram struct {
+	observations []float64
+}
+
+func (h *fakeHistogram) Observe(v float64) { h.observations = append(h.observations, v) }
+
+// fakeQueueMetricsProvider records the queue metrics by priority/namespace,
+// or priority alone.
+type fakeQueueMetricsProvider struct {
+	fakeMetricsProvider
+	depth     map[string]*fakeGauge
+	adds      map[string]*fakeCounter
+	latencies map[string]*fakeHistogram
+}
+
+func newFakeQueueMetricsProvider() *fakeQueueMetricsProvider {
+	return &fakeQueueMetricsProvider{
+		depth:     map[string]*fakeGauge{},
+		adds:      map[string]*fakeCounter{},
+		latencies: map[string]*fakeHistogram{},
+	}
+}
+
+func (p *fakeQueueMetricsProvider) NewQueueDepthMetric(priority, namespace string) GaugeMetric {
+	p.depth[priority+"/"+namespace] = &fakeGauge{}
+	return p.depth[priority+"/"+namespace]
+}
+
+func (p *fakeQueueMetricsProvider) NewQueueAddsMetric(priority, namespace string) CounterMetric {
+	p.adds[priority+"/"+namespace] = &fakeCounter{}
+	return p.adds[priority+"/"+namespace]
+}
+
+func (p *fakeQueueMetricsProvider) NewQueueLatencyMetric(priority string) HistogramMetric {
+	p.latencies[priority] = &fakeHistogram{}
+	return p.latencies[priority]
+}
+
+func (p *fakeQueueMetricsProvider) NewWorkDurationMetric(string) HistogramMetric {
+	return &fakeHistogram{}
+}
+
+func newTestFairQueue(t *testing.T, provider MetricsProvider) (*fairQueue, *clock.FakeClock) {
+	clk := clock.NewFakeClock(fixtureTime)
+	q := newFairQueue(workqueue.DefaultControllerRateLimiter(), clk, provider)
+	t.Cleanup(q.ShutDown)
+	return q, clk
+}
+
+// getAll takes n items off the queue, marking each done.
+func getAll(t *testing.T, q *fairQueue, n int) []interface{} {
+	t.Helper()
+	var items []interface{}
+	for i := 0; i < n; i++ {
+		item, shutdown := q.Get()
+		if shutdown {
+			t.Fatalf("unexpected shutdown")
+		}
+		q.Done(item)
+		items = append(items, item)
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected the queue to be empty, got %d items", q.Len())
+	}
+	return items
+}
+
+func TestFairQueueNamespacesTakeTurns(t *testing.T) {
+	q, _ := newTestFairQueue(t, nil)
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1", "c/1", "b/2"} {
+		q.Add(key)
+	}
+	q.Add("a/1")
+
+	expected := []interface{}{"a/1", "b/1", "c/1", "a/2", "b/2", "a/3"}
+	if got := getAll(t, q, len(expected)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestFairQueueUserChangesGoFirst(t *testing.T) {
+	q, _ := newTestFairQueue(t, nil)
+	for _, key := range []string{"a/bg1", "a/bg2"} {
+		q.Add(key)
+	}
+	for _, key := range []string{"a/u1", "b/u1", "a/u2", "b/u2", "a/u3", "b/u3"} {
+		q.addWithPriority(key, priorityUser)
+	}
+
+	// At most userBurst user changes are taken while background work waits.
+	expected := []interface{}{"a/u1", "b/u1", "a/u2", "b/u2", "a/bg1", "a/u3", "b/u3", "a/bg2"}
+	if got := getAll(t, q, len(expected)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestFairQueuePromotesQueuedItems(t *testing.T) {
+	provider := newFakeQueueMetricsProvider()
+	q, clk := newTestFairQueue(t, provider)
+	q.Add("a/1")
+	q.Add("a/2")
+	clk.Step(time.Second)
+	q.addWithPriority("a/2", priorityUser)
+	// Adding with a lower priority leaves the item where it is.
+	q.Add("a/2")
+
+	expected := []interface{}{"a/2", "a/1"}
+	if got := getAll(t, q, len(expected)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := provider.adds["background/a"].count; got != 2 {
+		t.Errorf("expected 2 background adds, got %d", got)
+	}
+	if got := provider.adds["user/a"]; got != nil {
+		t.Errorf("expected no user adds for a promotion, got %d", got.count)
+	}
+	if got := provider.latencies["user"].observations; !reflect.DeepEqual(got, []float64{1}) {
+		t.Errorf("expected the promoted item to have waited since it was first added, got %v", got)
+	}
+	for key, depth := range provider.depth {
+		if depth.value != 0 {
+			t.Errorf("expected depth %s to be 0, got %d", key, depth.value)
+		}
+	}
+}
+
+func TestFairQueueRequeuesItemsAddedWhileProcessing(t *testing.T) {
+	q, _ := newTestFairQueue(t, nil)
+	q.Add("a/1")
+	item, _ := q.Get()
+	q.Add("a/1")
+	q.addWithPriority("a/1", priorityUser)
+	if q.Len() != 0 {
+		t.Fatalf("expected an item being processed not to be queued again yet")
+	}
+	q.Add("a/bg")
+	q.Done(item)
+	if q.Len() != 2 {
+		t.Fatalf("expected the item to be queued again once done, got %d items", q.Len())
+	}
+	if item, _ := q.Get(); item != "a/1" {
+		t.Errorf("expected the item to keep its user priority, got %v first", item)
+	}
+}
+
+func TestFairQueueAddAfter(t *testing.T) {
+	q, clk := newTestFairQueue(t, nil)
+	q.AddAfter("a/1", time.Minute)
+	q.AddAfter("a/1", time.Second)
+	q.AddAfter("a/2", time.Hour)
+	if q.Len() != 0 {
+		t.Fatalf("expected delayed items not to be queued yet")
+	}
+
+	clk.Step(time.Second)
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return q.Len() == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the item to be queued after its soonest delay")
+	}
+	clk.Step(time.Minute)
+	if got := getAll(t, q, 1); got[0] != "a/1" {
+		t.Errorf("expected a/1, got %v", got[0])
+	}
+	if q.waiting.Len() != 1 {
+		t.Errorf("expected a/2 to still be waiting, got %d waiting", q.waiting.Len())
+	}
+}
+
+func TestFairQueueShutDown(t *testing.T) {
+	q, _ := newTestFairQueue(t, nil)
+	q.Add("a/1")
+	q.ShutDown()
+	q.Add("a/2")
+	if item, shutdown := q.Get(); shutdown || item != "a/1" {
+		t.Errorf("expected queued items to be handed out after shutting down, got %v, %t", item, shutdown)
+	}
+	if _, shutdown := q.Get(); !shutdown {
+		t.Errorf("expected Get to report the shutdown once the queue is empty")
+	}
+}
+
+func TestFooPriorities(t *testing.T) {
+	c := &Controller{started: fixtureTime}
+	listed := newFoo("listed", int32Ptr(1))
+	listed.CreationTimestamp = metav1.NewTime(fixtureTime.Add(-time.Hour))
+	created := newFoo("created", int32Ptr(1))
+	created.CreationTimestamp = metav1.NewTime(fixtureTime.Add(time.Minute))
+	if p := c.addPriority(listed); p != priorityBackground {
+		t.Errorf("expected a foo of the initial list to be synced in the background, got %v", p)
+	}
+	if p := c.addPriority(created); p != priorityUser {
+		t.Errorf("expected a foo created since the controller started to go first, got %v", p)
+	}
+
+	status := created.DeepCopy()
+	status.Status.AvailableReplicas = 1
+	status.Generation++
+	labelled := created.DeepCopy()
+	labelled.Labels = map[string]string{"tier": "frontend"}
+	scaled := created.DeepCopy()
+	scaled.Spec.Replicas = int32Ptr(2)
+	for _, test := range []struct {
+		name     string
+		new      *samplecontroller.Foo
+		expected priority
+	}{
+		{name: "status", new: status, expected: priorityBackground},
+		{name: "labels", new: labelled, expected: priorityBackground},
+		{name: "spec", new: scaled, expected: priorityUser},
+	} {
+		if p := updatePriority(created, test.new); p != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, p)
+		}
+	}
+}
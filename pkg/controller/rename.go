@@ -0,0 +1,153 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// RenameRefused is used as part of the Event 'reason' when a change of
+	// the deployment name of a Foo is refused
+	RenameRefused = "RenameRefused"
+	// RenameMigrating is used as the condition reason while a Foo is moving
+	// to a new deployment name
+	RenameMigrating = "RenameMigrating"
+	// RenameMigrated is used as part of the Event 'reason' when a Foo has
+	// moved to a new deployment name
+	RenameMigrated = "RenameMigrated"
+
+	// MessageRenameRefused is the message used when a change of the
+	// deployment name of a Foo is refused
+	MessageRenameRefused = "Deployment name changed from %q to %q but the rename policy is not Migrate; change the name back or set spec.deploymentRenamePolicy to Migrate"
+	// MessageRenameMigrating is the message used while a Foo is moving to a
+	// new deployment name
+	MessageRenameMigrating = "Waiting for Deployment %q to become available before deleting %q"
+	// MessageRenameMigrated is the message used when a Foo has moved to a new
+	// deployment name
+	MessageRenameMigrated = "Moved from Deployment %q to %q"
+)
+
+// refuseRename reports that the deployment name of the Foo was changed while
+// its rename policy does not allow it. Nothing else is synced until the name
+// is changed back or the policy is changed, either of which queues the Foo
+// again.
+func (p *planner) refuseRename(previousName string) {
+	foo := p.foo
+	msg := fmt.Sprintf(MessageRenameRefused, previousName, foo.Spec.DeploymentName)
+	status := foo.Status.DeepCopy()
+	previous := meta.FindStatusCondition(status.Conditions, samplev1alpha1.FooConditionDeploymentRenamed)
+	// The refusal is only worth an Event the first time it is reported.
+	refused := previous == nil || previous.Reason != RenameRefused || previous.Message != msg
+	p.setCondition(status, samplev1alpha1.FooConditionDeploymentRenamed, metav1.ConditionFalse, RenameRefused, msg)
+	p.setScheduleStatus(status)
+	p.setStatus(status)
+	if refused {
+		p.event(corev1.EventTypeWarning, RenameRefused, msg)
+	}
+}
+
+// migrateDeployments moves the Foo from its previous deployment name to the
+// current one, once the Deployment under the current name has been synced.
+// The objects managed under the previous name are only deleted after the new
+// Deployment is available; until then the status keeps pointing at the
+// previous name so that the migration is picked up again on the next sync.
+func (p *planner) migrateDeployments(previousName string, status *samplev1alpha1.FooStatus) {
+	foo := p.foo
+	name := primaryDeploymentName(foo, status)
+	deployment := p.deployment(name)
+	if deployment == nil || !deploymentComplete(deployment) {
+		// Updates to the new Deployment will queue the Foo again.
+		status.DeploymentName = previousName
+		p.setCondition(status, samplev1alpha1.FooConditionDeploymentRenamed, metav1.ConditionFalse, RenameMigrating,
+			fmt.Sprintf(MessageRenameMigrating, name, previousName))
+		return
+	}
+
+	// Besides those of the previous name, this deletes the objects left
+	// under names the Foo was renamed to and away from again before they
+	// were migrated to.
+	current := sets.NewString(managedDeploymentNames(foo.Spec.DeploymentName)...)
+	for _, observed := range p.observed.Deployments {
+		if current.Has(observed.Name) {
+			continue
+		}
+		if old := p.deployment(observed.Name); old != nil && metav1.IsControlledBy(old, foo) {
+			p.deleteDeployment(old)
+		}
+	}
+
+	// A blue/green Service without an explicit name is named after the
+	// deployment, so it has moved too.
+	for _, observed := range p.observed.Services {
+		if foo.Spec.Strategy != nil && foo.Spec.Strategy.BlueGreen != nil && blueGreenServiceName(foo) == observed.Name {
+			continue
+		}
+		if old := p.service(observed.Name); old != nil && metav1.IsControlledBy(old, foo) {
+			p.deleteService(old)
+		}
+	}
+
+	msg := fmt.Sprintf(MessageRenameMigrated, previousName, foo.Spec.DeploymentName)
+	p.setCondition(status, samplev1alpha1.FooConditionDeploymentRenamed, metav1.ConditionTrue, RenameMigrated, msg)
+	p.event(corev1.EventTypeNormal, RenameMigrated, msg)
+}
+
+// previousDeploymentName returns the deployment name the Foo was last synced
+// under. A Foo whose Deployment was created, but whose status was not updated
+// before it was renamed, is known to have been synced under the name of a
+// Deployment it controls.
+func (p *planner) previousDeploymentName() string {
+	if p.foo.Status.DeploymentName != "" {
+		return p.foo.Status.DeploymentName
+	}
+	current := sets.NewString(managedDeploymentNames(p.foo.Spec.DeploymentName)...)
+	for _, d := range p.observed.Deployments {
+		if !current.Has(d.Name) && metav1.IsControlledBy(d, p.foo) {
+			return d.Name
+		}
+	}
+	return ""
+}
+
+// primaryDeploymentName returns the name of the Deployment serving a Foo
+// under its current deployment name: the stable Deployment, or for the
+// blue/green strategy the Deployment of the active color.
+func primaryDeploymentName(foo *samplev1alpha1.Foo, status *samplev1alpha1.FooStatus) string {
+	if status.BlueGreen != nil {
+		return colorDeploymentName(foo, status.BlueGreen.ActiveColor)
+	}
+	return foo.Spec.DeploymentName
+}
+
+// managedDeploymentNames returns the names of all the Deployments the
+// controller may manage for a deployment name, across rollout strategies.
+func managedDeploymentNames(deploymentName string) []string {
+	return []string{
+		deploymentName,
+		deploymentName + "-canary",
+		fmt.Sprintf("%s-%s", deploymentName, samplev1alpha1.ColorBlue),
+		fmt.Sprintf("%s-%s", deploymentName, samplev1alpha1.ColorGreen),
+	}
+}
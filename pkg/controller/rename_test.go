@@ -0,0 +1,153 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func (r *rolloutFixture) expectRenameCondition(name string, status metav1.ConditionStatus, reason string) {
+	r.t.Helper()
+	cond := meta.FindStatusCondition(r.foo(name).Status.Conditions, samplecontroller.FooConditionDeploymentRenamed)
+	if cond == nil {
+		r.t.Fatalf("expected %s condition on foo %s", samplecontroller.FooConditionDeploymentRenamed, name)
+	}
+	if cond.Status != status || cond.Reason != reason {
+		r.t.Errorf("expected condition %s/%s, got %s/%s", status, reason, cond.Status, cond.Reason)
+	}
+}
+
+func TestRenameRefused(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+	if got := r.foo("test").Status.DeploymentName; got != "test-deployment" {
+		t.Fatalf("expected status to track test-deployment, got %q", got)
+	}
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.DeploymentName = "renamed" })
+	r.sync(foo)
+	if r.deployment("renamed") != nil {
+		t.Errorf("expected no deployment to be created under the new name")
+	}
+	if r.deployment("test-deployment") == nil {
+		t.Errorf("expected the old deployment to be kept")
+	}
+	if got := r.foo("test").Status.DeploymentName; got != "test-deployment" {
+		t.Errorf("expected status to keep tracking test-deployment, got %q", got)
+	}
+	r.expectRenameCondition("test", metav1.ConditionFalse, RenameRefused)
+
+	// Changing the name back resumes syncing.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.DeploymentName = "test-deployment" })
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Replicas = int32Ptr(2) })
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, defaultImage)
+}
+
+func TestRenameMigrated(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	foo.Spec.DeploymentRenamePolicy = samplecontroller.DeploymentRenamePolicyMigrate
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+	r.rollOut("test-deployment")
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.DeploymentName = "renamed" })
+	r.sync(foo)
+	r.expectReplicas("renamed", 2, defaultImage)
+	r.expectReplicas("test-deployment", 2, defaultImage)
+	if got := r.foo("test").Status.DeploymentName; got != "test-deployment" {
+		t.Errorf("expected status to track test-deployment until migrated, got %q", got)
+	}
+	r.expectRenameCondition("test", metav1.ConditionFalse, RenameMigrating)
+
+	r.rollOut("renamed")
+	r.sync(foo)
+	if r.deployment("test-deployment") != nil {
+		t.Errorf("expected the old deployment to be deleted")
+	}
+	if got := r.foo("test").Status.DeploymentName; got != "renamed" {
+		t.Errorf("expected status to track renamed, got %q", got)
+	}
+	r.expectRenameCondition("test", metav1.ConditionTrue, RenameMigrated)
+}
+
+func TestRenameMigratedTwice(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	foo.Spec.DeploymentRenamePolicy = samplecontroller.DeploymentRenamePolicyMigrate
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+	r.rollOut("test-deployment")
+
+	// Renaming again before the first migration completes leaves a
+	// Deployment under a name the Foo no longer has, nor had when synced.
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.DeploymentName = "renamed" })
+	r.sync(foo)
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.DeploymentName = "renamed-again" })
+	r.sync(foo)
+	r.rollOut("renamed-again")
+	r.sync(foo)
+	for _, name := range []string{"test-deployment", "renamed"} {
+		if r.deployment(name) != nil {
+			t.Errorf("expected deployment %s to be deleted", name)
+		}
+	}
+	r.expectReplicas("renamed-again", 2, defaultImage)
+	r.expectRenameCondition("test", metav1.ConditionTrue, RenameMigrated)
+}
+
+func TestRenameMigratedBeforeStatusUpdate(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	foo.Spec.DeploymentRenamePolicy = samplecontroller.DeploymentRenamePolicyMigrate
+	stale := newDeployment(foo)
+
+	// The Deployment was created, but the status never recorded its name.
+	foo.Spec.DeploymentName = "renamed"
+	r := newRolloutFixture(t, foo, stale)
+	r.sync(foo)
+	r.rollOut("renamed")
+	r.sync(foo)
+	if r.deployment("test-deployment") != nil {
+		t.Errorf("expected the old deployment to be deleted")
+	}
+	r.expectRenameCondition("test", metav1.ConditionTrue, RenameMigrated)
+}
+
+func TestRenameMigratedBlueGreen(t *testing.T) {
+	foo := newBlueGreenFoo("test", 1)
+	foo.Spec.DeploymentRenamePolicy = samplecontroller.DeploymentRenamePolicyMigrate
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+	r.rollOut("test-deployment-blue")
+
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.DeploymentName = "renamed" })
+	r.sync(foo)
+	r.rollOut("renamed-blue")
+	r.sync(foo)
+	if r.deployment("test-deployment-blue") != nil {
+		t.Errorf("expected the old blue deployment to be deleted")
+	}
+	r.expectServiceColor("renamed", samplecontroller.ColorBlue)
+	if _, err := r.k8sI.Core().V1().Services().Lister().Services(metav1.NamespaceDefault).Get("test-deployment"); err == nil {
+		t.Errorf("expected the old service to be deleted")
+	}
+}
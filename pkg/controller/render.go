@@ -0,0 +1,61 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// RenderObjects returns the objects the controller creates for a Foo, as they
+// are once any rollout has finished: the Deployment for the default and
+// canary strategies, and the Deployment of the active color together with the
+// Service for the blue/green strategy. They are the objects a sync of the Foo
+// plans to create in an empty namespace as of now.
+func RenderObjects(foo *samplev1alpha1.Foo, now time.Time) ([]runtime.Object, error) {
+	// Pausing and renaming only hold back the writes to objects that exist,
+	// and have no bearing on what the objects look like.
+	foo = foo.DeepCopy()
+	foo.Spec.Paused = false
+	foo.Status.DeploymentName = ""
+
+	plan := PlanSync(foo, nil, now)
+	if plan.Err != nil {
+		return nil, plan.Err
+	}
+	var objs []runtime.Object
+	for _, action := range plan.Actions {
+		if action.Type != ActionCreate && action.Type != ActionUpdate {
+			continue
+		}
+		switch obj := action.Object.DeepCopyObject().(type) {
+		case *appsv1.Deployment:
+			obj.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"}
+			objs = append(objs, obj)
+		case *corev1.Service:
+			obj.TypeMeta = metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Service"}
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func TestRenderObjects(t *testing.T) {
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	foo := newFoo("test", int32Ptr(3))
+	objs, err := RenderObjects(foo, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objs) != 1 || objs[0].(*apps.Deployment).Name != "test-deployment" || *objs[0].(*apps.Deployment).Spec.Replicas != 3 {
+		t.Errorf("expected a single deployment test-deployment with 3 replicas, got %v", objs)
+	}
+
+	blueGreen := newBlueGreenFoo("test", 2)
+	blueGreen.Status.BlueGreen = &samplecontroller.BlueGreenStatus{ActiveColor: samplecontroller.ColorGreen}
+	objs, err = RenderObjects(blueGreen, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objs) != 2 || objs[0].(*apps.Deployment).Name != "test-deployment-green" || objs[1].(*corev1.Service).Spec.Selector[colorLabel] != "green" {
+		t.Errorf("expected the green deployment and a service selecting it, got %v", objs)
+	}
+
+	invalid := newCanaryFoo("test", 2)
+	if _, err := RenderObjects(invalid, now); err == nil {
+		t.Errorf("expected an error for a canary strategy without steps")
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// rolloutPollInterval is how often a Foo is synced while one of its
+// Deployments is rolling out. Updates to the Deployment queue the Foo as
+// well, but a rollout that is stuck produces none.
+const rolloutPollInterval = 10 * time.Second
+
+// syncResult tells the worker when to sync a Foo again after a successful
+// sync, on top of the changes to the Foo and its objects that queue it anyway.
+type syncResult struct {
+	// requeueAfter queues the Foo again after this long, unless it is zero.
+	requeueAfter time.Duration
+}
+
+// requeueAfter returns a syncResult that queues the Foo again after d.
+func requeueAfter(d time.Duration) syncResult {
+	return syncResult{requeueAfter: d}
+}
+
+// merge returns the result that queues the Foo again soonest.
+func (r syncResult) merge(other syncResult) syncResult {
+	if r.requeueAfter <= 0 || (other.requeueAfter > 0 && other.requeueAfter < r.requeueAfter) {
+		return other
+	}
+	return r
+}
+
+// rolloutResult returns a syncResult that polls the Foo while any of the
+// given Deployments has not finished rolling out.
+func rolloutResult(deployments ...*appsv1.Deployment) syncResult {
+	for _, d := range deployments {
+		if !deploymentComplete(d) {
+			return requeueAfter(rolloutPollInterval)
+		}
+	}
+	return syncResult{}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// GenerationNotObserved is used as the Progressing condition reason while
+	// the deployment controller has not yet seen the latest spec of a
+	// Deployment
+	GenerationNotObserved = "GenerationNotObserved"
+
+	// MessageGenerationNotObserved is the message used while the deployment
+	// controller has not yet seen the latest spec of a Deployment
+	MessageGenerationNotObserved = "Deployment %q: waiting for generation %d to be observed, at %d"
+)
+
+// setRolloutConditions translates the conditions of the Deployments of a Foo
+// into its Progressing, Available and ReplicaFailure conditions. When several
+// Deployments are given, such as the stable and canary Deployments during a
+// canary rollout, the condition of the one in the worst state is reported.
+// A condition none of the Deployments report is removed.
+func (p *planner) setRolloutConditions(status *samplev1alpha1.FooStatus, deployments ...*appsv1.Deployment) {
+	// The Progressing condition of a Deployment whose spec has not been
+	// observed yet is about its previous spec, which would be misleading.
+	var unobserved *appsv1.Deployment
+	for _, d := range deployments {
+		if d.Status.ObservedGeneration < d.Generation {
+			unobserved = d
+			break
+		}
+	}
+	if unobserved != nil {
+		p.setCondition(status, samplev1alpha1.FooConditionProgressing, metav1.ConditionTrue, GenerationNotObserved,
+			fmt.Sprintf(MessageGenerationNotObserved, unobserved.Name, unobserved.Generation, unobserved.Status.ObservedGeneration))
+	} else {
+		p.copyDeploymentCondition(status, samplev1alpha1.FooConditionProgressing, appsv1.DeploymentProgressing, corev1.ConditionFalse, deployments)
+	}
+	p.copyDeploymentCondition(status, samplev1alpha1.FooConditionAvailable, appsv1.DeploymentAvailable, corev1.ConditionFalse, deployments)
+	p.copyDeploymentCondition(status, samplev1alpha1.FooConditionReplicaFailure, appsv1.DeploymentReplicaFailure, corev1.ConditionTrue, deployments)
+}
+
+// copyDeploymentCondition sets a condition of a Foo from a condition of its
+// Deployments. The first Deployment whose condition has the bad status wins,
+// and otherwise the first Deployment reporting the condition at all.
+func (p *planner) copyDeploymentCondition(status *samplev1alpha1.FooStatus, conditionType string,
+	deploymentConditionType appsv1.DeploymentConditionType, bad corev1.ConditionStatus, deployments []*appsv1.Deployment) {
+	var found *appsv1.DeploymentCondition
+	var from *appsv1.Deployment
+	for _, d := range deployments {
+		condition := deploymentCondition(d, deploymentConditionType)
+		if condition == nil {
+			continue
+		}
+		if found == nil || (condition.Status == bad && found.Status != bad) {
+			found, from = condition, d
+		}
+	}
+	if found == nil {
+		meta.RemoveStatusCondition(&status.Conditions, conditionType)
+		return
+	}
+	reason := found.Reason
+	if reason == "" {
+		reason = string(deploymentConditionType)
+	}
+	p.setCondition(status, conditionType, metav1.ConditionStatus(found.Status), reason,
+		fmt.Sprintf("Deployment %q: %s", from.Name, found.Message))
+}
+
+func deploymentCondition(deployment *appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
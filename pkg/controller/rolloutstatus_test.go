@@ -0,0 +1,129 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// setDeploymentStatus replaces the status of a Deployment, as the deployment
+// controller would.
+func (r *rolloutFixture) setDeploymentStatus(name string, update func(status *apps.DeploymentStatus)) {
+	r.t.Helper()
+	d := r.deployment(name)
+	update(&d.Status)
+	if _, err := r.kubeclient.AppsV1().Deployments(metav1.NamespaceDefault).UpdateStatus(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		r.t.Fatalf("error updating deployment %s: %v", name, err)
+	}
+	r.refresh()
+}
+
+func (r *rolloutFixture) expectCondition(fooName, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	r.t.Helper()
+	condition := meta.FindStatusCondition(r.foo(fooName).Status.Conditions, conditionType)
+	if condition == nil {
+		if status != "" {
+			r.t.Errorf("expected condition %s to be %s, got none", conditionType, status)
+		}
+		return
+	}
+	if condition.Status != status || condition.Reason != reason || condition.Message != message {
+		r.t.Errorf("expected condition %s to be %s with reason %q and message %q, got %s with reason %q and message %q",
+			conditionType, status, reason, message, condition.Status, condition.Reason, condition.Message)
+	}
+}
+
+func TestRolloutConditions(t *testing.T) {
+	foo := newFoo("test", int32Ptr(2))
+	r := newRolloutFixture(t, foo)
+	r.sync(foo)
+
+	r.setDeploymentStatus("test-deployment", func(status *apps.DeploymentStatus) {
+		status.Conditions = []apps.DeploymentCondition{
+			{Type: apps.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: `ReplicaSet "test-deployment-1" has timed out progressing.`},
+			{Type: apps.DeploymentAvailable, Status: corev1.ConditionFalse, Reason: "MinimumReplicasUnavailable", Message: "Deployment does not have minimum availability."},
+			{Type: apps.DeploymentReplicaFailure, Status: corev1.ConditionTrue, Reason: "FailedCreate", Message: `pods "test-deployment-1-abc" is forbidden: exceeded quota`},
+		}
+	})
+	r.sync(foo)
+	r.expectCondition("test", samplecontroller.FooConditionProgressing, metav1.ConditionFalse, "ProgressDeadlineExceeded",
+		`Deployment "test-deployment": ReplicaSet "test-deployment-1" has timed out progressing.`)
+	r.expectCondition("test", samplecontroller.FooConditionAvailable, metav1.ConditionFalse, "MinimumReplicasUnavailable",
+		`Deployment "test-deployment": Deployment does not have minimum availability.`)
+	r.expectCondition("test", samplecontroller.FooConditionReplicaFailure, metav1.ConditionTrue, "FailedCreate",
+		`Deployment "test-deployment": pods "test-deployment-1-abc" is forbidden: exceeded quota`)
+
+	// Until the deployment controller has seen a new spec, the Foo reports
+	// that rather than the stale Progressing condition.
+	r.setDeploymentStatus("test-deployment", func(status *apps.DeploymentStatus) {
+		status.ObservedGeneration = 1
+	})
+	d := r.deployment("test-deployment")
+	d.Generation = 2
+	if _, err := r.kubeclient.AppsV1().Deployments(metav1.NamespaceDefault).Update(context.TODO(), d, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r.refresh()
+	r.sync(foo)
+	r.expectCondition("test", samplecontroller.FooConditionProgressing, metav1.ConditionTrue, GenerationNotObserved,
+		`Deployment "test-deployment": waiting for generation 2 to be observed, at 1`)
+
+	r.setDeploymentStatus("test-deployment", func(status *apps.DeploymentStatus) {
+		status.ObservedGeneration = 2
+		status.Conditions = []apps.DeploymentCondition{
+			{Type: apps.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "NewReplicaSetAvailable", Message: `ReplicaSet "test-deployment-2" has successfully progressed.`},
+			{Type: apps.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable", Message: "Deployment has minimum availability."},
+		}
+	})
+	r.sync(foo)
+	r.expectCondition("test", samplecontroller.FooConditionProgressing, metav1.ConditionTrue, "NewReplicaSetAvailable",
+		`Deployment "test-deployment": ReplicaSet "test-deployment-2" has successfully progressed.`)
+	r.expectCondition("test", samplecontroller.FooConditionAvailable, metav1.ConditionTrue, "MinimumReplicasAvailable",
+		`Deployment "test-deployment": Deployment has minimum availability.`)
+	r.expectCondition("test", samplecontroller.FooConditionReplicaFailure, "", "", "")
+}
+
+func TestRolloutConditionsWorstDeployment(t *testing.T) {
+	foo := newCanaryFoo("test", 4, samplecontroller.CanaryStep{Weight: 50, Pause: &metav1.Duration{Duration: time.Minute}})
+	r := newRolloutFixture(t, foo, newDeployment(foo))
+	r.setDeploymentStatus("test-deployment", func(status *apps.DeploymentStatus) {
+		status.Conditions = []apps.DeploymentCondition{
+			{Type: apps.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable", Message: "Deployment has minimum availability."},
+		}
+	})
+	foo = r.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:broken" })
+	r.sync(foo)
+
+	// The canary failing to become available is what the Foo reports.
+	r.setDeploymentStatus("test-deployment-canary", func(status *apps.DeploymentStatus) {
+		status.Conditions = []apps.DeploymentCondition{
+			{Type: apps.DeploymentAvailable, Status: corev1.ConditionFalse, Reason: "MinimumReplicasUnavailable", Message: "Deployment does not have minimum availability."},
+		}
+	})
+	r.sync(foo)
+	r.expectCondition("test", samplecontroller.FooConditionAvailable, metav1.ConditionFalse, "MinimumReplicasUnavailable",
+		`Deployment "test-deployment-canary": Deployment does not have minimum availability.`)
+}
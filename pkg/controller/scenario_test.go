@@ -0,0 +1,562 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+)
+
+const (
+	// maxScenarioSyncs bounds the syncs of a single drain, so that a
+	// controller that never settles fails the test instead of hanging it.
+	maxScenarioSyncs = 1000
+	// scenarioSettlePolls is how many consecutive polls, scenarioSettleInterval
+	// apart, must find the queue empty and the caches up to date before the
+	// controller is considered quiescent. Informers deliver events to their
+	// handlers asynchronously, after their stores are updated.
+	scenarioSettlePolls    = 3
+	scenarioSettleInterval = 5 * time.Millisecond
+)
+
+// scenario runs the controller against real informers on the fake
+// clientsets. Tests change objects through the clientsets, then drain the
+// controller until it has nothing left to do and assert on the state of the
+// cluster, rather than on the actions that got it there.
+type scenario struct {
+	*fixture
+
+	c     *Controller
+	clock *clock.FakeClock
+	queue *scenarioQueue
+
+	fooInformer        cache.SharedIndexInformer
+	deploymentInformer cache.SharedIndexInformer
+	serviceInformer    cache.SharedIndexInformer
+}
+
+// newScenario starts a controller with the given objects in the cluster, and
+// waits for its informers to be watching.
+func newScenario(t *testing.T, objects ...runtime.Object) *scenario {
+	f := newFixture(t)
+	for _, obj := range objects {
+		obj = obj.DeepCopyObject()
+		if accessor, err := meta.Accessor(obj); err == nil && accessor.GetUID() == "" {
+			accessor.SetUID(uuid.NewUUID())
+		}
+		if foo, ok := obj.(*samplecontroller.Foo); ok {
+			foo.Generation = 1
+			f.objects = append(f.objects, obj)
+		} else {
+			f.kubeobjects = append(f.kubeobjects, obj)
+		}
+	}
+	f.client = fake.NewSimpleClientset(f.objects...)
+	f.kubeclient = k8sfake.NewSimpleClientset(f.kubeobjects...)
+
+	// Foos, Deployments and Services.
+	const informerCount = 3
+	watching := make(chan struct{}, informerCount)
+	serveAsAPIServer(&f.client.Fake, f.client.Tracker(), watching)
+	serveAsAPIServer(&f.kubeclient.Fake, f.kubeclient.Tracker(), watching)
+
+	i := informers.NewSharedInformerFactory(f.client, noResyncPeriodFunc())
+	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, noResyncPeriodFunc())
+	fakeClock := clock.NewFakeClock(fixtureTime)
+	c, err := NewController(Options{
+		KubeClientset:      f.kubeclient,
+		SampleClientset:    f.client,
+		DeploymentInformer: k8sI.Apps().V1().Deployments(),
+		ServiceInformer:    k8sI.Core().V1().Services(),
+		FooInformer:        i.Samplecontroller().V1alpha1().Foos(),
+		Recorder:           &record.FakeRecorder{},
+		Clock:              fakeClock,
+	})
+	if err != nil {
+		t.Fatalf("error creating controller: %v", err)
+	}
+	s := &scenario{
+		fixture:            f,
+		c:                  c,
+		clock:              fakeClock,
+		queue:              newScenarioQueue(fakeClock),
+		fooInformer:        i.Samplecontroller().V1alpha1().Foos().Informer(),
+		deploymentInformer: k8sI.Apps().V1().Deployments().Informer(),
+		serviceInformer:    k8sI.Core().V1().Services().Informer(),
+	}
+	c.workqueue = s.queue
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() {
+		close(stopCh)
+		s.queue.ShutDown()
+	})
+	i.Start(stopCh)
+	k8sI.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.foosSynced, c.deploymentsSynced, c.servicesSynced) {
+		t.Fatalf("timed out waiting for caches to sync")
+	}
+	// The fake clientsets do not replay changes made between the list and
+	// the watch of an informer, so nothing may change before every watch
+	// is established.
+	timeout := time.After(wait.ForeverTestTimeout)
+	for n := 0; n < informerCount; n++ {
+		select {
+		case <-watching:
+		case <-timeout:
+			t.Fatalf("timed out waiting for informers to watch")
+		}
+	}
+	return s
+}
+
+// serveAsAPIServer makes a fake clientset assign UIDs and resource versions,
+// and reject updates of stale objects, as the API server does. Without UIDs
+// every object would be controlled by every Foo, and the controller ignores
+// updates of Deployments and Services that do not change their resource
+// version. Foos get the generations and the status subresource of the CRD in
+// artifacts/examples. A watch is signaled on watching once it is established.
+func serveAsAPIServer(fake *core.Fake, tracker core.ObjectTracker, watching chan<- struct{}) {
+	versioned := &versionedTracker{ObjectTracker: tracker}
+	fake.PrependReactor("*", "*", core.ObjectReaction(versioned))
+	fake.PrependReactor("update", "foos", func(action core.Action) (bool, runtime.Object, error) {
+		return updateFoo(versioned, action.(core.UpdateAction))
+	})
+	fake.PrependWatchReactor("*", func(action core.Action) (bool, watch.Interface, error) {
+		w, err := tracker.Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return false, nil, err
+		}
+		watching <- struct{}{}
+		return true, w, nil
+	})
+}
+
+// updateFoo writes a Foo the way the status subresource does: an update of
+// the status only changes the status, and other updates leave it alone.
+func updateFoo(tracker *versionedTracker, action core.UpdateAction) (bool, runtime.Object, error) {
+	foo := action.GetObject().(*samplecontroller.Foo).DeepCopy()
+	gvr, ns := action.GetResource(), action.GetNamespace()
+	current, err := tracker.Get(gvr, ns, foo.Name)
+	if err != nil {
+		return true, nil, err
+	}
+	if action.GetSubresource() == "status" {
+		status := foo.Status
+		foo = current.(*samplecontroller.Foo).DeepCopy()
+		foo.Status = status
+		foo.ResourceVersion = action.GetObject().(*samplecontroller.Foo).ResourceVersion
+	} else {
+		foo.Status = current.(*samplecontroller.Foo).Status
+	}
+	if err := tracker.Update(gvr, foo, ns); err != nil {
+		return true, nil, err
+	}
+	obj, err := tracker.Get(gvr, ns, foo.Name)
+	return true, obj, err
+}
+
+// versionedTracker is an ObjectTracker that keeps the UIDs and resource
+// versions of its objects. The generation of a Foo starts at 1 and is bumped
+// by every change to its spec.
+type versionedTracker struct {
+	core.ObjectTracker
+
+	mu      sync.Mutex
+	version uint64
+}
+
+func (t *versionedTracker) Create(gvr schema.GroupVersionResource, obj runtime.Object, ns string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	obj, err := t.nextVersion(obj)
+	if err != nil {
+		return err
+	}
+	if accessor, err := meta.Accessor(obj); err == nil && accessor.GetUID() == "" {
+		accessor.SetUID(uuid.NewUUID())
+	}
+	if foo, ok := obj.(*samplecontroller.Foo); ok {
+		foo.Generation = 1
+	}
+	return t.ObjectTracker.Create(gvr, obj, ns)
+}
+
+func (t *versionedTracker) Update(gvr schema.GroupVersionResource, obj runtime.Object, ns string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if rv := accessor.GetResourceVersion(); rv != "" {
+		current, err := t.ObjectTracker.Get(gvr, ns, accessor.GetName())
+		if err != nil {
+			return err
+		}
+		currentAccessor, err := meta.Accessor(current)
+		if err != nil {
+			return err
+		}
+		if currentAccessor.GetResourceVersion() != rv {
+			return errors.NewConflict(gvr.GroupResource(), accessor.GetName(), fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+		}
+	}
+	obj, err = t.nextVersion(obj)
+	if err != nil {
+		return err
+	}
+	if foo, ok := obj.(*samplecontroller.Foo); ok {
+		current, err := t.ObjectTracker.Get(gvr, ns, foo.Name)
+		if err != nil {
+			return err
+		}
+		currentFoo := current.(*samplecontroller.Foo)
+		foo.Generation = currentFoo.Generation
+		if !apiequality.Semantic.DeepEqual(foo.Spec, currentFoo.Spec) {
+			foo.Generation++
+		}
+	}
+	return t.ObjectTracker.Update(gvr, obj, ns)
+}
+
+// nextVersion returns a copy of obj with the next resource version.
+func (t *versionedTracker) nextVersion(obj runtime.Object) (runtime.Object, error) {
+	obj = obj.DeepCopyObject()
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	t.version++
+	accessor.SetResourceVersion(strconv.FormatUint(t.version, 10))
+	return obj, nil
+}
+
+// scenarioQueue is a workqueue whose delays run on the fake clock of a
+// scenario. Items added with a delay are held until the clock has passed it.
+type scenarioQueue struct {
+	workqueue.Interface
+
+	clock       clock.Clock
+	rateLimiter workqueue.RateLimiter
+
+	mu      sync.Mutex
+	delayed map[interface{}]time.Time
+}
+
+var _ workqueue.RateLimitingInterface = &scenarioQueue{}
+
+func newScenarioQueue(clock clock.Clock) *scenarioQueue {
+	return &scenarioQueue{
+		Interface:   workqueue.New(),
+		clock:       clock,
+		rateLimiter: workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
+		delayed:     map[interface{}]time.Time{},
+	}
+}
+
+func (q *scenarioQueue) AddAfter(item interface{}, d time.Duration) {
+	if d <= 0 {
+		q.Add(item)
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	at := q.clock.Now().Add(d)
+	if due, ok := q.delayed[item]; !ok || at.Before(due) {
+		q.delayed[item] = at
+	}
+}
+
+func (q *scenarioQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *scenarioQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *scenarioQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+// release adds the items that are due to the queue.
+func (q *scenarioQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.clock.Now()
+	for item, at := range q.delayed {
+		if !at.After(now) {
+			delete(q.delayed, item)
+			q.Add(item)
+		}
+	}
+}
+
+// due returns how long until item is added to the queue, if it is held.
+func (q *scenarioQueue) due(item interface{}) (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	at, ok := q.delayed[item]
+	return at.Sub(q.clock.Now()), ok
+}
+
+// next returns how long until the first held item is added to the queue, if
+// any is held.
+func (q *scenarioQueue) next() (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var first time.Time
+	for _, at := range q.delayed {
+		if first.IsZero() || at.Before(first) {
+			first = at
+		}
+	}
+	return first.Sub(q.clock.Now()), !first.IsZero()
+}
+
+// drain syncs Foos until the controller is quiescent: its caches are up to
+// date and its queue is empty. Each Foo is synced against up to date caches,
+// so that scenarios do not depend on how fast the informers are. Foos queued
+// for later stay held until the clock is advanced.
+func (s *scenario) drain() {
+	s.t.Helper()
+	deadline := time.Now().Add(wait.ForeverTestTimeout)
+	syncs, idle := 0, 0
+	for idle < scenarioSettlePolls {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timed out waiting for the controller to settle")
+		}
+		if !s.cachesUpToDate() {
+			idle = 0
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if s.queue.Len() == 0 {
+			idle++
+			time.Sleep(scenarioSettleInterval)
+			continue
+		}
+		idle = 0
+		if syncs++; syncs > maxScenarioSyncs {
+			s.t.Fatalf("controller did not settle after %d syncs", maxScenarioSyncs)
+		}
+		s.c.processNextWorkItem()
+	}
+}
+
+// advance moves the clock forward, then drains the controller of the Foos
+// that have come due.
+func (s *scenario) advance(d time.Duration) {
+	s.t.Helper()
+	s.clock.Step(d)
+	s.queue.release()
+	s.drain()
+}
+
+// requeued returns how long until the named Foo is synced again, if it is
+// queued for later.
+func (s *scenario) requeued(name string) (time.Duration, bool) {
+	return s.queue.due(metav1.NamespaceDefault + "/" + name)
+}
+
+// cachesUpToDate returns whether the informers have seen every change made
+// in the clientsets.
+func (s *scenario) cachesUpToDate() bool {
+	s.t.Helper()
+	foos, err := s.client.Tracker().List(samplecontroller.SchemeGroupVersion.WithResource("foos"), samplecontroller.SchemeGroupVersion.WithKind("Foo"), metav1.NamespaceAll)
+	if err != nil {
+		s.t.Fatalf("error listing foos: %v", err)
+	}
+	deployments, err := s.kubeclient.Tracker().List(apps.SchemeGroupVersion.WithResource("deployments"), apps.SchemeGroupVersion.WithKind("Deployment"), metav1.NamespaceAll)
+	if err != nil {
+		s.t.Fatalf("error listing deployments: %v", err)
+	}
+	services, err := s.kubeclient.Tracker().List(corev1.SchemeGroupVersion.WithResource("services"), corev1.SchemeGroupVersion.WithKind("Service"), metav1.NamespaceAll)
+	if err != nil {
+		s.t.Fatalf("error listing services: %v", err)
+	}
+	return storeUpToDate(s.fooInformer.GetStore(), foos) &&
+		storeUpToDate(s.deploymentInformer.GetStore(), deployments) &&
+		storeUpToDate(s.serviceInformer.GetStore(), services)
+}
+
+// storeUpToDate returns whether store holds the objects of list, at the same
+// resource versions.
+func storeUpToDate(store cache.Store, list runtime.Object) bool {
+	items, err := meta.ExtractList(list)
+	if err != nil || len(items) != len(store.ListKeys()) {
+		return false
+	}
+	for _, item := range items {
+		key, err := cache.MetaNamespaceKeyFunc(item)
+		if err != nil {
+			return false
+		}
+		cached, exists, err := store.GetByKey(key)
+		if err != nil || !exists {
+			return false
+		}
+		want, err := meta.Accessor(item)
+		if err != nil {
+			return false
+		}
+		got, err := meta.Accessor(cached)
+		if err != nil || got.GetResourceVersion() != want.GetResourceVersion() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScenarioScale(t *testing.T) {
+	s := newScenario(t, newFoo("test", int32Ptr(1)))
+	s.drain()
+	s.expectReplicas("test-deployment", 1, defaultImage)
+	if _, ok := s.requeued("test"); !ok {
+		t.Errorf("expected the rollout to be polled")
+	}
+
+	s.rollOut("test-deployment")
+	s.drain()
+	if got := s.foo("test").Status.AvailableReplicas; got != 1 {
+		t.Errorf("expected 1 available replica, got %d", got)
+	}
+
+	s.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Replicas = int32Ptr(3) })
+	s.drain()
+	s.expectReplicas("test-deployment", 3, defaultImage)
+	s.rollOut("test-deployment")
+	s.drain()
+
+	foo := s.foo("test")
+	if foo.Status.AvailableReplicas != 3 {
+		t.Errorf("expected 3 available replicas, got %d", foo.Status.AvailableReplicas)
+	}
+	if cond := meta.FindStatusCondition(foo.Status.Conditions, samplecontroller.FooConditionSynced); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("expected foo to be synced, got %+v", cond)
+	}
+	// The rollout is polled one last time, and then no more.
+	s.advance(rolloutPollInterval)
+	if _, ok := s.requeued("test"); ok {
+		t.Errorf("expected no more syncs once the rollout is complete")
+	}
+}
+
+// expectObservedGeneration fails the test unless every condition of the
+// named Foo has observed its generation.
+func (s *scenario) expectObservedGeneration(name string, generation int64) *samplecontroller.Foo {
+	s.t.Helper()
+	foo := s.foo(name)
+	if foo.Generation != generation {
+		s.t.Errorf("expected generation %d, got %d", generation, foo.Generation)
+	}
+	for _, cond := range foo.Status.Conditions {
+		if cond.ObservedGeneration != generation {
+			s.t.Errorf("expected condition %s to observe generation %d, got %d", cond.Type, generation, cond.ObservedGeneration)
+		}
+	}
+	return foo
+}
+
+func TestScenarioStatusSettles(t *testing.T) {
+	s := newScenario(t, newFoo("test", int32Ptr(1)))
+	s.drain()
+	s.rollOut("test-deployment")
+	s.drain()
+	s.expectObservedGeneration("test", 1)
+
+	s.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Replicas = int32Ptr(2) })
+	s.drain()
+	s.rollOut("test-deployment")
+	s.drain()
+	settled := s.expectObservedGeneration("test", 2)
+
+	// Status writes do not change the generation, so syncing a Foo that has
+	// settled writes nothing.
+	s.c.enqueueFoo(settled)
+	s.drain()
+	if foo := s.foo("test"); foo.ResourceVersion != settled.ResourceVersion {
+		t.Errorf("expected a settled foo not to be written, got resource version %s, was %s", foo.ResourceVersion, settled.ResourceVersion)
+	}
+}
+
+func TestScenarioCanaryRollout(t *testing.T) {
+	foo := newCanaryFoo("test", 4,
+		samplecontroller.CanaryStep{Weight: 25, Pause: &metav1.Duration{Duration: time.Minute}},
+		samplecontroller.CanaryStep{Weight: 50, Pause: &metav1.Duration{Duration: time.Minute}},
+	)
+	s := newScenario(t, foo)
+	s.drain()
+	s.rollOut("test-deployment")
+	s.drain()
+
+	s.updateFoo("test", func(foo *samplecontroller.Foo) { foo.Spec.Image = "nginx:1.21" })
+	s.drain()
+	s.expectReplicas("test-deployment", 3, defaultImage)
+	s.expectReplicas("test-deployment-canary", 1, "nginx:1.21")
+	s.rollOut("test-deployment-canary")
+	s.drain()
+	s.expectCanaryStatus("test", 0, samplecontroller.CanaryPhaseProgressing)
+
+	// Each pause runs out without anything but time passing.
+	s.advance(time.Minute)
+	s.expectReplicas("test-deployment", 2, defaultImage)
+	s.expectReplicas("test-deployment-canary", 2, "nginx:1.21")
+	s.rollOut("test-deployment-canary")
+	s.drain()
+	s.advance(time.Minute)
+
+	// Passing the last step promotes the canary, which is removed once the
+	// stable Deployment has rolled out.
+	s.expectReplicas("test-deployment", 4, "nginx:1.21")
+	if s.foo("test").Status.Canary != nil {
+		t.Errorf("expected canary status to be cleared after promotion")
+	}
+	s.rollOut("test-deployment")
+	s.drain()
+	if s.deployment("test-deployment-canary") != nil {
+		t.Errorf("expected canary deployment to be removed")
+	}
+	s.expectReplicas("test-deployment", 4, "nginx:1.21")
+}
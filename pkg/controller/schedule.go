@@ -0,0 +1,164 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// scheduleLookback bounds how far into the past the most recent firing of a
+// schedule is searched for. Schedules that have not fired within it are not
+// in effect.
+const scheduleLookback = 366 * 24 * time.Hour
+
+// scheduleEvaluation is the outcome of evaluating the schedules of a Foo at a
+// point in time.
+type scheduleEvaluation struct {
+	// replicas is the replica count in effect. It is spec.replicas when no
+	// schedule is in effect.
+	replicas *int32
+	// active is the name of the schedule in effect, if any.
+	active string
+	// next is the next time a schedule fires or stops being in effect, or
+	// nil if the Foo has no schedules.
+	next *time.Time
+}
+
+// evaluateSchedules works out which of the schedules of a Foo is in effect at
+// now. Each schedule takes effect when its cron expression fires and stays in
+// effect for its duration, or until another schedule fires. When several are
+// in effect, the one that fired most recently wins, with ties going to the
+// one listed first.
+func evaluateSchedules(foo *samplev1alpha1.Foo, now time.Time) (*scheduleEvaluation, error) {
+	eval := &scheduleEvaluation{replicas: foo.Spec.Replicas}
+	var activeFired time.Time
+	for i := range foo.Spec.Schedules {
+		s := &foo.Spec.Schedules[i]
+		schedule, location, err := parseReplicaSchedule(s)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", s.Name, err)
+		}
+
+		local := now.In(location)
+		eval.next = earliest(eval.next, schedule.Next(local))
+
+		fired := lastFireTime(schedule, local)
+		if fired.IsZero() {
+			continue
+		}
+		if s.Duration != nil {
+			end := fired.Add(s.Duration.Duration)
+			if !end.After(now) {
+				continue
+			}
+			eval.next = earliest(eval.next, end)
+		}
+		if eval.active == "" || fired.After(activeFired) {
+			replicas := s.Replicas
+			eval.replicas = &replicas
+			eval.active = s.Name
+			activeFired = fired
+		}
+	}
+	return eval, nil
+}
+
+// desiredReplicas returns the number of replicas the Foo should currently
+// run, taking its schedules into account. Invalid schedules are reported when
+// the Foo is synced, and are ignored here.
+func (p *planner) desiredReplicas() *int32 {
+	eval, err := evaluateSchedules(p.foo, p.now)
+	if err != nil {
+		return p.foo.Spec.Replicas
+	}
+	return eval.replicas
+}
+
+// desiredReplicaCount is desiredReplicas with the Deployment default of one
+// replica applied.
+func (p *planner) desiredReplicaCount() int32 {
+	if replicas := p.desiredReplicas(); replicas != nil {
+		return *replicas
+	}
+	return 1
+}
+
+// setScheduleStatus records the schedule in effect and the next transition in
+// the status of the Foo.
+func (p *planner) setScheduleStatus(status *samplev1alpha1.FooStatus) {
+	status.ActiveSchedule = ""
+	status.NextScheduleTransition = nil
+	eval, err := evaluateSchedules(p.foo, p.now)
+	if err != nil {
+		return
+	}
+	status.ActiveSchedule = eval.active
+	if eval.next != nil {
+		next := metav1.NewTime(*eval.next)
+		status.NextScheduleTransition = &next
+	}
+}
+
+func parseReplicaSchedule(s *samplev1alpha1.ReplicaSchedule) (cron.Schedule, *time.Location, error) {
+	schedule, err := cron.ParseStandard(s.Schedule)
+	if err != nil {
+		return nil, nil, err
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.Duration != nil && s.Duration.Duration <= 0 {
+		return nil, nil, fmt.Errorf("duration must be positive")
+	}
+	return schedule, location, nil
+}
+
+// lastFireTime returns the most recent time at or before now that a schedule
+// fired, or the zero time if it has not fired within scheduleLookback. The
+// window searched doubles until a firing is found, so frequent schedules only
+// need a few iterations and rare ones only a few windows.
+func lastFireTime(schedule cron.Schedule, now time.Time) time.Time {
+	for window := time.Hour; ; window *= 2 {
+		if window > scheduleLookback {
+			window = scheduleLookback
+		}
+		var last time.Time
+		for t := schedule.Next(now.Add(-window)); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+			last = t
+		}
+		if !last.IsZero() || window == scheduleLookback {
+			return last
+		}
+	}
+}
+
+func earliest(current *time.Time, t time.Time) *time.Time {
+	if t.IsZero() {
+		return current
+	}
+	if current == nil || t.Before(*current) {
+		return &t
+	}
+	return current
+}
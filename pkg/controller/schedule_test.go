@@ -0,0 +1,172 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// businessHours scales up to 10 replicas at 9:00 and back down to 2 at 18:00
+// on weekdays in the given time zone.
+func businessHours(tz string) []samplecontroller.ReplicaSchedule {
+	return []samplecontroller.ReplicaSchedule{
+		{Name: "day", Schedule: "0 9 * * 1-5", TimeZone: tz, Replicas: 10},
+		{Name: "night", Schedule: "0 18 * * 1-5", TimeZone: tz, Replicas: 2},
+	}
+}
+
+func TestEvaluateSchedules(t *testing.T) {
+	// 2021-09-01 is a Wednesday.
+	wednesday := func(hour, min int) time.Time {
+		return time.Date(2021, 9, 1, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name      string
+		schedules []samplecontroller.ReplicaSchedule
+		now       time.Time
+		replicas  int32
+		active    string
+		next      time.Time
+	}{
+		{
+			name:      "before the day schedule",
+			schedules: businessHours(""),
+			now:       wednesday(8, 0),
+			replicas:  2,
+			active:    "night",
+			next:      wednesday(9, 0),
+		},
+		{
+			name:      "exactly when the day schedule fires",
+			schedules: businessHours(""),
+			now:       wednesday(9, 0),
+			replicas:  10,
+			active:    "day",
+			next:      wednesday(18, 0),
+		},
+		{
+			name:      "in another time zone",
+			schedules: businessHours("America/New_York"),
+			now:       wednesday(12, 0),
+			replicas:  2,
+			active:    "night",
+			next:      wednesday(13, 0),
+		},
+		{
+			name: "after a duration has run out",
+			schedules: []samplecontroller.ReplicaSchedule{
+				{Name: "batch", Schedule: "0 2 * * *", Replicas: 8, Duration: &metav1.Duration{Duration: 2 * time.Hour}},
+			},
+			now:      wednesday(5, 0),
+			replicas: 3,
+			next:     time.Date(2021, 9, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "within a duration",
+			schedules: []samplecontroller.ReplicaSchedule{
+				{Name: "batch", Schedule: "0 2 * * *", Replicas: 8, Duration: &metav1.Duration{Duration: 2 * time.Hour}},
+			},
+			now:      wednesday(3, 0),
+			replicas: 8,
+			active:   "batch",
+			next:     wednesday(4, 0),
+		},
+		{
+			name: "rare schedule fired long ago",
+			schedules: []samplecontroller.ReplicaSchedule{
+				{Name: "yearly", Schedule: "@yearly", Replicas: 5},
+			},
+			now:      wednesday(12, 0),
+			replicas: 5,
+			active:   "yearly",
+			next:     time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			foo := newFoo("test", int32Ptr(3))
+			foo.Spec.Schedules = test.schedules
+			eval, err := evaluateSchedules(foo, test.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *eval.replicas != test.replicas {
+				t.Errorf("expected %d replicas, got %d", test.replicas, *eval.replicas)
+			}
+			if eval.active != test.active {
+				t.Errorf("expected active schedule %q, got %q", test.active, eval.active)
+			}
+			if eval.next == nil || !eval.next.Equal(test.next) {
+				t.Errorf("expected next transition %v, got %v", test.next, eval.next)
+			}
+		})
+	}
+}
+
+func TestEvaluateSchedulesInvalid(t *testing.T) {
+	for _, s := range []samplecontroller.ReplicaSchedule{
+		{Name: "bad-cron", Schedule: "not a cron"},
+		{Name: "bad-zone", Schedule: "@daily", TimeZone: "Mars/Olympus_Mons"},
+		{Name: "bad-duration", Schedule: "@daily", Duration: &metav1.Duration{}},
+	} {
+		foo := newFoo("test", int32Ptr(1))
+		foo.Spec.Schedules = []samplecontroller.ReplicaSchedule{s}
+		if _, err := evaluateSchedules(foo, time.Now()); err == nil {
+			t.Errorf("%s: expected an error", s.Name)
+		}
+	}
+}
+
+func TestScheduledReplicas(t *testing.T) {
+	foo := newFoo("test", int32Ptr(3))
+	foo.Spec.Schedules = businessHours("")
+	r := newRolloutFixture(t, foo)
+
+	// The fixture clock starts on a Wednesday at noon. Until the Deployment
+	// has rolled out, its progress is polled.
+	if got := r.sync(foo); got != rolloutPollInterval {
+		t.Errorf("expected foo to be queued again in %v, got %v", rolloutPollInterval, got)
+	}
+	r.expectReplicas("test-deployment", 10, defaultImage)
+	r.rollOut("test-deployment")
+	if got := r.sync(foo); got != 6*time.Hour {
+		t.Errorf("expected foo to be queued again in 6h, got %v", got)
+	}
+	status := r.foo("test").Status
+	if status.ActiveSchedule != "day" {
+		t.Errorf("expected active schedule day, got %q", status.ActiveSchedule)
+	}
+	if status.NextScheduleTransition == nil || !status.NextScheduleTransition.Time.Equal(r.clock.Now().Add(6*time.Hour)) {
+		t.Errorf("unexpected next schedule transition %v", status.NextScheduleTransition)
+	}
+
+	r.clock.Step(6 * time.Hour)
+	r.sync(foo)
+	r.expectReplicas("test-deployment", 2, defaultImage)
+	r.rollOut("test-deployment")
+	if got := r.sync(foo); got != 15*time.Hour {
+		t.Errorf("expected foo to be queued again in 15h, got %v", got)
+	}
+	if status := r.foo("test").Status; status.ActiveSchedule != "night" {
+		t.Errorf("expected active schedule night, got %q", status.ActiveSchedule)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// DefaultSweepInterval is how often the sweeper looks for leaked
+	// Deployments unless SweepOptions.Interval is set.
+	DefaultSweepInterval = 10 * time.Minute
+	// DefaultSweepGracePeriod is how long a Deployment is reported as leaked
+	// before the sweeper deletes it unless SweepOptions.GracePeriod is set.
+	DefaultSweepGracePeriod = time.Hour
+
+	// LeakedDeployment is used as part of the Event 'reason' when the
+	// sweeper finds a Deployment whose Foo is gone
+	LeakedDeployment = "LeakedDeployment"
+	// LeakedDeploymentDeleted is used as part of the Event 'reason' when the
+	// sweeper deletes a leaked Deployment
+	LeakedDeploymentDeleted = "LeakedDeploymentDeleted"
+
+	// MessageLeakedDeployment is the message used for an Event fired when a
+	// leaked Deployment is found and will be deleted
+	MessageLeakedDeployment = "Deployment was created for Foo %q, which no longer exists; it will be deleted in %v"
+	// MessageLeakedDeploymentReported is the message used for an Event fired
+	// when a leaked Deployment is found by a sweeper that only reports
+	MessageLeakedDeploymentReported = "Deployment was created for Foo %q, which no longer exists"
+	// MessageLeakedDeploymentDeleted is the message used for an Event fired
+	// when a leaked Deployment is deleted
+	MessageLeakedDeploymentDeleted = "Deleted Deployment created for Foo %q, which no longer exists"
+)
+
+// SweepOptions configure the sweeper, which finds the Deployments created
+// for Foos that no longer exist. The garbage collector deletes them through
+// their owner references, but not when those were stripped or when it is
+// disabled.
+type SweepOptions struct {
+	// Interval is how often the Deployments are swept. It defaults to
+	// DefaultSweepInterval.
+	Interval time.Duration
+	// GracePeriod is how long a Deployment is reported as leaked before it
+	// is deleted, leaving time for the garbage collector or for its Foo to
+	// be created again. It defaults to DefaultSweepGracePeriod.
+	GracePeriod time.Duration
+	// ReportOnly makes the sweeper report leaked Deployments without ever
+	// deleting them.
+	ReportOnly bool
+}
+
+// sweeper holds what the sweeper knows between sweeps. Sweeps never
+// overlap, so it needs no lock.
+type sweeper struct {
+	opts    SweepOptions
+	metrics *sweepMetrics
+	// foundAt holds when each leaked Deployment was first found, by UID.
+	foundAt map[types.UID]time.Time
+}
+
+func newSweeper(opts SweepOptions, provider MetricsProvider) *sweeper {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultSweepInterval
+	}
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = DefaultSweepGracePeriod
+	}
+	return &sweeper{
+		opts:    opts,
+		metrics: newSweepMetrics(provider),
+		foundAt: map[types.UID]time.Time{},
+	}
+}
+
+// sweepLeakedDeployments reports the Deployments whose Foo is gone, and
+// deletes those found leaked for longer than the grace period.
+func (c *Controller) sweepLeakedDeployments() {
+	// The Deployments of Foos are only labelled in their pod template.
+	selector, err := labels.Parse(PodLabelSelector)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	deployments, err := c.deploymentsLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("error listing deployments to sweep: %v", err))
+		return
+	}
+
+	s := c.sweeper
+	now := c.clock.Now()
+	leaked := map[types.UID]bool{}
+	for _, d := range deployments {
+		if !selector.Matches(labels.Set(d.Spec.Template.Labels)) {
+			continue
+		}
+		fooName, ok, err := c.leakedBy(d)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("error checking whether deployment %s/%s leaked: %v", d.Namespace, d.Name, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		leaked[d.UID] = true
+		foundAt, found := s.foundAt[d.UID]
+		if !found {
+			foundAt = now
+			s.foundAt[d.UID] = now
+			s.metrics.found.Inc()
+			c.logger.Info("Found leaked deployment", "deployment", klog.KObj(d), "foo", fooName)
+			if s.opts.ReportOnly {
+				c.recorder.event(d, nil, corev1.EventTypeWarning, LeakedDeployment, fmt.Sprintf(MessageLeakedDeploymentReported, fooName))
+			} else {
+				c.recorder.event(d, nil, corev1.EventTypeWarning, LeakedDeployment, fmt.Sprintf(MessageLeakedDeployment, fooName, s.opts.GracePeriod))
+			}
+		}
+		if s.opts.ReportOnly || now.Sub(foundAt) < s.opts.GracePeriod {
+			continue
+		}
+		if err := c.deleteLeakedDeployment(d, fooName); err != nil {
+			utilruntime.HandleError(fmt.Errorf("error deleting leaked deployment %s/%s: %v", d.Namespace, d.Name, err))
+		}
+	}
+	// Deployments no longer leaked start over if they leak again.
+	for uid := range s.foundAt {
+		if !leaked[uid] {
+			delete(s.foundAt, uid)
+		}
+	}
+}
+
+// leakedBy tells whether a Deployment with the pod labels of a Foo was leaked,
+// and by which Foo. It was when it is controlled by a Foo that no longer
+// exists, or when it has no controller, carries the template hash annotation
+// the controller sets on the Deployments it creates, and no Foo may claim it.
+// Deployments controlled by anything else, being deleted, released on purpose
+// or merely labelled like those of a Foo are left alone.
+func (c *Controller) leakedBy(d *appsv1.Deployment) (string, bool, error) {
+	if d.DeletionTimestamp != nil {
+		return "", false, nil
+	}
+	if ref := metav1.GetControllerOf(d); ref != nil {
+		if ref.Kind != "Foo" || ref.APIVersion != samplev1alpha1.SchemeGroupVersion.String() {
+			return "", false, nil
+		}
+		foo, err := c.foosLister.Foos(d.Namespace).Get(ref.Name)
+		if errors.IsNotFound(err) {
+			return ref.Name, true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return ref.Name, foo.UID != ref.UID, nil
+	}
+	if _, ok := d.Annotations[releasedAnnotation]; ok {
+		return "", false, nil
+	}
+	// Without an owner, only the annotation shows that the controller
+	// created the Deployment.
+	if _, ok := d.Annotations[templateHashAnnotation]; !ok {
+		return "", false, nil
+	}
+	name := d.Spec.Template.Labels["controller"]
+	if _, err := c.foosLister.Foos(d.Namespace).Get(name); !errors.IsNotFound(err) {
+		return "", false, err
+	}
+	// A Foo that wants the name may adopt the Deployment.
+	foos, err := c.foosLister.Foos(d.Namespace).ByDeploymentName(d.Name)
+	if err != nil {
+		return "", false, err
+	}
+	return name, len(foos) == 0, nil
+}
+
+// deleteLeakedDeployment deletes a leaked Deployment, unless its Foo turns out
+// to exist after all: the informer may not have observed it yet. The UID
+// precondition keeps a Deployment created again under the same name.
+func (c *Controller) deleteLeakedDeployment(d *appsv1.Deployment, fooName string) error {
+	foo, err := c.sampleclientset.SamplecontrollerV1alpha1().Foos(d.Namespace).Get(context.TODO(), fooName, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		if ref := metav1.GetControllerOf(d); ref == nil || ref.UID == foo.UID {
+			delete(c.sweeper.foundAt, d.UID)
+			return nil
+		}
+	case !errors.IsNotFound(err):
+		return err
+	}
+
+	err = c.kubeclientset.AppsV1().Deployments(d.Namespace).Delete(context.TODO(), d.Name, metav1.DeleteOptions{
+		Preconditions: metav1.NewUIDPreconditions(string(d.UID)),
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		delete(c.sweeper.foundAt, d.UID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	delete(c.sweeper.foundAt, d.UID)
+	c.sweeper.metrics.deleted.Inc()
+	c.logger.Info("Deleted leaked deployment", "deployment", klog.KObj(d), "foo", fooName)
+	c.recorder.event(d, nil, corev1.EventTypeNormal, LeakedDeploymentDeleted, fmt.Sprintf(MessageLeakedDeploymentDeleted, fooName))
+	return nil
+}
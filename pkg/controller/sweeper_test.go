@@ -0,0 +1,198 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// fakeSweepMetricsProvider records the sweeper metrics by outcome.
+type fakeSweepMetricsProvider struct {
+	fakeMetricsProvider
+	leaked map[string]*fakeCounter
+}
+
+func (p *fakeSweepMetricsProvider) NewLeakedDeploymentsMetric(outcome string) CounterMetric {
+	p.leaked[outcome] = &fakeCounter{}
+	return p.leaked[outcome]
+}
+
+// leakedDeployment returns the Deployment of a Foo that no longer exists.
+func leakedDeployment(fooName string) *apps.Deployment {
+	gone := newFoo(fooName, int32Ptr(1))
+	gone.UID = types.UID(fooName + "-uid")
+	d := newDeployment(gone)
+	d.UID = types.UID(d.Name + "-uid")
+	return d
+}
+
+// newSweepFixture returns a fixture whose controller sweeps with opts, and
+// records its Events and sweeper metrics.
+func newSweepFixture(t *testing.T, opts SweepOptions, foo *samplecontroller.Foo, deployments ...*apps.Deployment) (*rolloutFixture, *record.FakeRecorder, *fakeSweepMetricsProvider) {
+	r := newRolloutFixture(t, foo, deployments...)
+	recorder := record.NewFakeRecorder(10)
+	provider := &fakeSweepMetricsProvider{leaked: map[string]*fakeCounter{}}
+	r.c.recorder = legacyRecorder{recorder}
+	r.c.sweeper = newSweeper(opts, provider)
+	return r, recorder, provider
+}
+
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, reasons ...string) {
+	t.Helper()
+	for _, reason := range reasons {
+		select {
+		case e := <-recorder.Events:
+			if !strings.Contains(e, reason) {
+				t.Errorf("expected a %s event, got %q", reason, e)
+			}
+		default:
+			t.Errorf("expected a %s event", reason)
+		}
+	}
+	select {
+	case e := <-recorder.Events:
+		t.Errorf("unexpected event %q", e)
+	default:
+	}
+}
+
+func TestSweepDeletesLeakedDeployments(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	foo.UID = "foo-uid"
+	owned := newDeployment(foo)
+	owned.UID = "owned-uid"
+	// The Deployment of a Foo deleted and created again under the same name
+	// is leaked as well.
+	recreated := newDeployment(foo)
+	recreated.Name = "recreated"
+	recreated.UID = "recreated-uid"
+	recreated.OwnerReferences[0].UID = "old-foo-uid"
+	r, recorder, metrics := newSweepFixture(t, SweepOptions{GracePeriod: time.Hour}, foo,
+		owned, recreated, leakedDeployment("gone"))
+
+	r.c.sweepLeakedDeployments()
+	expectEvents(t, recorder, LeakedDeployment, LeakedDeployment)
+	r.clock.Step(30 * time.Minute)
+	r.c.sweepLeakedDeployments()
+	expectEvents(t, recorder)
+	if r.deployment("gone-deployment") == nil || r.deployment("recreated") == nil {
+		t.Fatalf("expected leaked deployments to be kept during the grace period")
+	}
+
+	r.clock.Step(30 * time.Minute)
+	r.c.sweepLeakedDeployments()
+	expectEvents(t, recorder, LeakedDeploymentDeleted, LeakedDeploymentDeleted)
+	if r.deployment("gone-deployment") != nil || r.deployment("recreated") != nil {
+		t.Errorf("expected leaked deployments to be deleted after the grace period")
+	}
+	if r.deployment("test-deployment") == nil {
+		t.Errorf("expected the deployment of an existing foo to be kept")
+	}
+	if found, deleted := metrics.leaked["found"].count, metrics.leaked["deleted"].count; found != 2 || deleted != 2 {
+		t.Errorf("expected 2 leaked deployments found and deleted, got %d found and %d deleted", found, deleted)
+	}
+}
+
+func TestSweepReportOnly(t *testing.T) {
+	r, recorder, metrics := newSweepFixture(t, SweepOptions{GracePeriod: time.Minute, ReportOnly: true},
+		newFoo("test", int32Ptr(1)), leakedDeployment("gone"))
+
+	for i := 0; i < 3; i++ {
+		r.c.sweepLeakedDeployments()
+		r.clock.Step(time.Hour)
+	}
+	expectEvents(t, recorder, LeakedDeployment)
+	if r.deployment("gone-deployment") == nil {
+		t.Errorf("expected a sweeper that only reports not to delete deployments")
+	}
+	if found, deleted := metrics.leaked["found"].count, metrics.leaked["deleted"].count; found != 1 || deleted != 0 {
+		t.Errorf("expected 1 leaked deployment found and none deleted, got %d found and %d deleted", found, deleted)
+	}
+}
+
+func TestSweepKeepsClaimedDeployments(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	foo.UID = "foo-uid"
+	other := newFoo("other", int32Ptr(1))
+	other.Spec.DeploymentName = "wanted"
+
+	// The Foo of an uncontrolled Deployment exists, and may adopt it.
+	uncontrolled := newOrphanDeployment(foo)
+	// Another Foo wants the name of the Deployment.
+	wanted := leakedDeployment("gone")
+	wanted.Name = "wanted"
+	wanted.UID = "wanted-uid"
+	wanted.OwnerReferences = nil
+	// The Foo released the Deployment when it was deleted.
+	released := leakedDeployment("released")
+	released.OwnerReferences = nil
+	released.Annotations[releasedAnnotation] = "released"
+	// Something other than a Foo controls the Deployment.
+	controlled := leakedDeployment("controlled")
+	controlled.OwnerReferences[0].Kind = "Bar"
+	deleting := leakedDeployment("deleting")
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	// A Deployment made by hand with the same labels was never created by
+	// the controller.
+	lookalike := leakedDeployment("lookalike")
+	lookalike.OwnerReferences = nil
+	delete(lookalike.Annotations, templateHashAnnotation)
+
+	r, recorder, _ := newSweepFixture(t, SweepOptions{GracePeriod: time.Minute}, foo,
+		uncontrolled, wanted, released, controlled, deleting, lookalike)
+	r.i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Add(other)
+	r.c.sweepLeakedDeployments()
+	r.clock.Step(time.Hour)
+	r.c.sweepLeakedDeployments()
+
+	expectEvents(t, recorder)
+	if len(r.c.sweeper.foundAt) != 0 {
+		t.Errorf("expected no leaked deployments, got %v", r.c.sweeper.foundAt)
+	}
+}
+
+func TestSweepChecksFooBeforeDeleting(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	d := leakedDeployment("new")
+	d.OwnerReferences = nil
+	r, recorder, _ := newSweepFixture(t, SweepOptions{GracePeriod: time.Minute}, foo, d)
+
+	r.c.sweepLeakedDeployments()
+	expectEvents(t, recorder, LeakedDeployment)
+	// The Foo is created, but the informer has not observed it yet.
+	if _, err := r.client.SamplecontrollerV1alpha1().Foos(metav1.NamespaceDefault).Create(context.TODO(), newFoo("new", int32Ptr(1)), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("error creating foo: %v", err)
+	}
+	r.clock.Step(time.Hour)
+	r.c.sweepLeakedDeployments()
+
+	expectEvents(t, recorder)
+	if r.deployment("new-deployment") == nil {
+		t.Errorf("expected the deployment of a foo that exists not to be deleted")
+	}
+}
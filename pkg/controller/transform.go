@@ -0,0 +1,225 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/cache"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+)
+
+// TransformFunc changes an object an informer has listed or watched before
+// it is cached. It may modify the object, which nothing else refers to yet.
+type TransformFunc func(obj runtime.Object) error
+
+// StripManagedFields drops the managed fields of an object, which the
+// controller never reads and which are often most of its size. Objects
+// stripped this way can still be written back with an update, as the API
+// server keeps the managed fields of an object updated without any.
+func StripManagedFields(obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	accessor.SetManagedFields(nil)
+	return nil
+}
+
+// StripReadOnlyObject drops the managed fields of an object and the copy of
+// it kubectl apply keeps in an annotation. It is only meant for objects the
+// controller never writes back, as an update would remove the annotation.
+func StripReadOnlyObject(obj runtime.Object) error {
+	if err := StripManagedFields(obj); err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if annotations := accessor.GetAnnotations(); annotations != nil {
+		delete(annotations, corev1.LastAppliedConfigAnnotation)
+		if len(annotations) == 0 {
+			accessor.SetAnnotations(nil)
+		}
+	}
+	return nil
+}
+
+// NewTransformingListWatch returns a ListerWatcher that passes every object
+// lw lists or watches through transform.
+func NewTransformingListWatch(lw cache.ListerWatcher, transform TransformFunc) cache.ListerWatcher {
+	return &transformingListWatch{lw: lw, transform: transform}
+}
+
+type transformingListWatch struct {
+	lw        cache.ListerWatcher
+	transform TransformFunc
+}
+
+func (t *transformingListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := t.lw.List(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := meta.EachListItem(list, t.transform); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *transformingListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := t.lw.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Error {
+			return event, true
+		}
+		// An object that cannot be transformed is still cached, as
+		// dropping the event would leave the cache out of date.
+		if err := t.transform(event.Object); err != nil {
+			utilruntime.HandleError(fmt.Errorf("error transforming %T: %v", event.Object, err))
+		}
+		return event, true
+	}), nil
+}
+
+// newTransformingInformer returns an informer like those of the informer
+// factories, which lists and watches through a NewTransformingListWatch.
+func newTransformingInformer(lw *cache.ListWatch, tweak func(*metav1.ListOptions), transform TransformFunc, obj runtime.Object, resync time.Duration) cache.SharedIndexInformer {
+	if tweak != nil {
+		listFunc, watchFunc := lw.ListFunc, lw.WatchFunc
+		lw.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+			tweak(&options)
+			return listFunc(options)
+		}
+		lw.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+			tweak(&options)
+			return watchFunc(options)
+		}
+	}
+	return cache.NewSharedIndexInformer(NewTransformingListWatch(lw, transform), obj, resync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// StripKubeInformers makes factory cache the Deployments, Services and Pods
+// among objs without their managed fields. Pods are stripped with
+// StripReadOnlyObject, as the controller never writes them. It must be called
+// before the informers are requested from the factory. The factory does not
+// pass its own list options on, so tweak, when not nil, changes them instead.
+func StripKubeInformers(factory kubeinformers.SharedInformerFactory, tweak func(*metav1.ListOptions), objs ...runtime.Object) error {
+	for _, obj := range objs {
+		var newListWatch func(client kubernetes.Interface) *cache.ListWatch
+		transform := StripManagedFields
+		switch obj.(type) {
+		case *appsv1.Deployment:
+			newListWatch = func(client kubernetes.Interface) *cache.ListWatch {
+				deployments := client.AppsV1().Deployments(metav1.NamespaceAll)
+				return &cache.ListWatch{
+					ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+						return deployments.List(context.TODO(), options)
+					},
+					WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+						return deployments.Watch(context.TODO(), options)
+					},
+				}
+			}
+		case *corev1.Service:
+			newListWatch = func(client kubernetes.Interface) *cache.ListWatch {
+				services := client.CoreV1().Services(metav1.NamespaceAll)
+				return &cache.ListWatch{
+					ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+						return services.List(context.TODO(), options)
+					},
+					WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+						return services.Watch(context.TODO(), options)
+					},
+				}
+			}
+		case *corev1.Pod:
+			transform = StripReadOnlyObject
+			newListWatch = func(client kubernetes.Interface) *cache.ListWatch {
+				pods := client.CoreV1().Pods(metav1.NamespaceAll)
+				return &cache.ListWatch{
+					ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+						return pods.List(context.TODO(), options)
+					},
+					WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+						return pods.Watch(context.TODO(), options)
+					},
+				}
+			}
+		default:
+			return fmt.Errorf("cannot strip the informer of %T", obj)
+		}
+		obj, transform := obj, transform
+		factory.InformerFor(obj, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+			return newTransformingInformer(newListWatch(client), tweak, transform, obj, resync)
+		})
+	}
+	return nil
+}
+
+// StripFooInformer makes factory cache Foos without their managed fields, as
+// StripKubeInformers does for other objects.
+func StripFooInformer(factory informers.SharedInformerFactory, tweak func(*metav1.ListOptions)) {
+	factory.InformerFor(&samplev1alpha1.Foo{}, func(client clientset.Interface, resync time.Duration) cache.SharedIndexInformer {
+		foos := client.SamplecontrollerV1alpha1().Foos(metav1.NamespaceAll)
+		return newTransformingInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return foos.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return foos.Watch(context.TODO(), options)
+			},
+		}, tweak, StripManagedFields, &samplev1alpha1.Foo{}, resync)
+	})
+}
+
+// NewMetadataInformer returns an informer that caches only the metadata of
+// a resource, stripped with StripReadOnlyObject, for object types of which
+// only ownership matters. It caches *metav1.PartialObjectMetadata, which
+// metadatalister.New lists.
+func NewMetadataInformer(client metadata.Interface, resource schema.GroupVersionResource, resync time.Duration, tweak func(*metav1.ListOptions)) cache.SharedIndexInformer {
+	objects := client.Resource(resource)
+	return newTransformingInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return objects.List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return objects.Watch(context.TODO(), options)
+		},
+	}, tweak, StripReadOnlyObject, &metav1.PartialObjectMetadata{}, resync)
+}
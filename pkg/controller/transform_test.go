@@ -0,0 +1,283 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+)
+
+// bloat gives an object the managed fields and last applied configuration
+// of an object that is applied with kubectl and changed by a few managers.
+func bloat(obj metav1.Object) {
+	applied, _ := json.Marshal(obj)
+	obj.SetAnnotations(map[string]string{
+		corev1.LastAppliedConfigAnnotation: string(applied),
+		templateHashAnnotation:             "hash",
+	})
+	for _, manager := range []string{"kubectl-client-side-apply", "kube-controller-manager", "sample-controller"} {
+		obj.SetManagedFields(append(obj.GetManagedFields(), metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: "apps/v1",
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: applied},
+		}))
+	}
+}
+
+func bloatedDeployment(name string) *apps.Deployment {
+	d := newDeployment(newFoo(name, int32Ptr(1)))
+	bloat(d)
+	return d
+}
+
+func TestStripKubeInformers(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: metav1.NamespaceDefault, Labels: map[string]string{"controller": "test"}}}
+	bloat(pod)
+	otherPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other-pod", Namespace: metav1.NamespaceDefault}}
+	client := k8sfake.NewSimpleClientset(bloatedDeployment("test"), pod, otherPod)
+	factory := kubeinformers.NewSharedInformerFactory(client, 0)
+	if err := StripKubeInformers(factory, nil, &apps.Deployment{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := StripKubeInformers(factory, func(options *metav1.ListOptions) {
+		options.LabelSelector = "controller"
+	}, &corev1.Pod{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deployments := factory.Apps().V1().Deployments().Lister()
+	pods := factory.Core().V1().Pods().Lister()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	d, err := deployments.Deployments(metav1.NamespaceDefault).Get("test-deployment")
+	if err != nil {
+		t.Fatalf("error getting deployment: %v", err)
+	}
+	if d.ManagedFields != nil {
+		t.Errorf("expected managed fields to be stripped, got %d", len(d.ManagedFields))
+	}
+	if _, ok := d.Annotations[corev1.LastAppliedConfigAnnotation]; !ok {
+		t.Errorf("expected the last applied configuration of a deployment to be kept")
+	}
+	p, err := pods.Pods(metav1.NamespaceDefault).Get("pod")
+	if err != nil {
+		t.Fatalf("error getting pod: %v", err)
+	}
+	if p.ManagedFields != nil || len(p.Annotations) != 1 {
+		t.Errorf("expected managed fields and last applied configuration to be stripped, got %d fields and annotations %v", len(p.ManagedFields), p.Annotations)
+	}
+	if _, err := pods.Pods(metav1.NamespaceDefault).Get("other-pod"); err == nil {
+		t.Errorf("expected pods not selected by the tweaked list options to be left out")
+	}
+
+	// Watched objects are stripped as well.
+	if _, err := client.AppsV1().Deployments(metav1.NamespaceDefault).Create(context.TODO(), bloatedDeployment("watched"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("error creating deployment: %v", err)
+	}
+	err = wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		d, err = deployments.Deployments(metav1.NamespaceDefault).Get("watched-deployment")
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("deployment was not observed: %v", err)
+	}
+	if d.ManagedFields != nil {
+		t.Errorf("expected managed fields of watched deployment to be stripped, got %d", len(d.ManagedFields))
+	}
+
+	if err := StripKubeInformers(factory, nil, &apps.ReplicaSet{}); err == nil {
+		t.Errorf("expected stripping an unsupported informer to fail")
+	}
+}
+
+func TestStripFooInformer(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	bloat(foo)
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(foo), 0)
+	StripFooInformer(factory, nil)
+	foos := factory.Samplecontroller().V1alpha1().Foos().Lister()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	got, err := foos.Foos(metav1.NamespaceDefault).Get("test")
+	if err != nil {
+		t.Fatalf("error getting foo: %v", err)
+	}
+	if got.ManagedFields != nil || len(got.Annotations) != 2 {
+		t.Errorf("expected only managed fields to be stripped, got %d fields and annotations %v", len(got.ManagedFields), got.Annotations)
+	}
+}
+
+// metadataOf returns the metadata of a Deployment, as a metadata client
+// would.
+func metadataOf(d *apps.Deployment) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: d.ObjectMeta,
+	}
+}
+
+func newMetadataClient(objects ...k8sruntime.Object) *metadatafake.FakeMetadataClient {
+	scheme := k8sruntime.NewScheme()
+	metav1.AddMetaToScheme(scheme)
+	return metadatafake.NewSimpleMetadataClient(scheme, objects...)
+}
+
+func TestMetadataInformer(t *testing.T) {
+	d := bloatedDeployment("test")
+	informer := NewMetadataInformer(newMetadataClient(metadataOf(d)), apps.SchemeGroupVersion.WithResource("deployments"), 0, nil)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+	cache.WaitForCacheSync(stopCh, informer.HasSynced)
+
+	obj, exists, err := informer.GetIndexer().GetByKey("default/test-deployment")
+	if err != nil || !exists {
+		t.Fatalf("expected deployment metadata to be cached, got %v, %v", exists, err)
+	}
+	m := obj.(*metav1.PartialObjectMetadata)
+	if m.ManagedFields != nil || len(m.Annotations) != 1 {
+		t.Errorf("expected managed fields and last applied configuration to be stripped, got %d fields and annotations %v", len(m.ManagedFields), m.Annotations)
+	}
+	if owner := metav1.GetControllerOf(m); owner == nil || owner.Name != "test" {
+		t.Errorf("expected the owner references to be kept")
+	}
+}
+
+func TestOwnedInformers(t *testing.T) {
+	foo := newFoo("test", int32Ptr(1))
+	foo.UID = "foo-uid"
+	configMap := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "config",
+			Namespace:       metav1.NamespaceDefault,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(foo, samplecontroller.SchemeGroupVersion.WithKind("Foo"))},
+		},
+	}
+	owned := NewMetadataInformer(newMetadataClient(configMap), corev1.SchemeGroupVersion.WithResource("configmaps"), 0, nil)
+
+	client := fake.NewSimpleClientset()
+	kubeclient := k8sfake.NewSimpleClientset()
+	i := informers.NewSharedInformerFactory(client, noResyncPeriodFunc())
+	k8sI := kubeinformers.NewSharedInformerFactory(kubeclient, noResyncPeriodFunc())
+	c, err := NewController(Options{
+		KubeClientset:      kubeclient,
+		SampleClientset:    client,
+		DeploymentInformer: k8sI.Apps().V1().Deployments(),
+		ServiceInformer:    k8sI.Core().V1().Services(),
+		FooInformer:        i.Samplecontroller().V1alpha1().Foos(),
+		OwnedInformers:     []cache.SharedIndexInformer{owned},
+		Recorder:           &record.FakeRecorder{},
+	})
+	if err != nil {
+		t.Fatalf("error creating controller: %v", err)
+	}
+	if len(c.ownedSynced) != 1 {
+		t.Errorf("expected the controller to wait for the owned informer to sync")
+	}
+	i.Samplecontroller().V1alpha1().Foos().Informer().GetIndexer().Add(foo)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go owned.Run(stopCh)
+	err = wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return c.workqueue.Len() == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the foo controlling the config map to be queued")
+	}
+	if item, _ := c.workqueue.Get(); item != getKey(foo, t) {
+		t.Errorf("expected %s to be queued, got %v", getKey(foo, t), item)
+	}
+}
+
+// BenchmarkInformerMemory measures how much memory an informer takes to cache
+// Deployments applied with kubectl, in full, stripped of their managed fields
+// and as metadata only.
+func BenchmarkInformerMemory(b *testing.B) {
+	const deployments = 5000
+	var objects, metadata []k8sruntime.Object
+	for n := 0; n < deployments; n++ {
+		d := bloatedDeployment(fmt.Sprintf("foo-%d", n))
+		objects = append(objects, d)
+		metadata = append(metadata, metadataOf(d))
+	}
+	informers := map[string]func() cache.SharedIndexInformer{
+		"full": func() cache.SharedIndexInformer {
+			return kubeinformers.NewSharedInformerFactory(k8sfake.NewSimpleClientset(objects...), 0).Apps().V1().Deployments().Informer()
+		},
+		"stripped": func() cache.SharedIndexInformer {
+			factory := kubeinformers.NewSharedInformerFactory(k8sfake.NewSimpleClientset(objects...), 0)
+			StripKubeInformers(factory, nil, &apps.Deployment{})
+			return factory.Apps().V1().Deployments().Informer()
+		},
+		"metadata": func() cache.SharedIndexInformer {
+			return NewMetadataInformer(newMetadataClient(metadata...), apps.SchemeGroupVersion.WithResource("deployments"), 0, nil)
+		},
+	}
+	for _, name := range []string{"full", "stripped", "metadata"} {
+		b.Run(name, func(b *testing.B) {
+			var perObject uint64
+			for i := 0; i < b.N; i++ {
+				informer := informers[name]()
+				stopCh := make(chan struct{})
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				go informer.Run(stopCh)
+				cache.WaitForCacheSync(stopCh, informer.HasSynced)
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				if n := len(informer.GetStore().ListKeys()); n != deployments {
+					b.Fatalf("expected %d deployments to be cached, got %d", deployments, n)
+				}
+				close(stopCh)
+				if after.HeapAlloc > before.HeapAlloc {
+					perObject += (after.HeapAlloc - before.HeapAlloc) / deployments
+				}
+			}
+			b.ReportMetric(float64(perObject)/float64(b.N), "B/object")
+		})
+	}
+}
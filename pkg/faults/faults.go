@@ -0,0 +1,162 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package faults injects failures and latency into the requests of fake
+// clientsets, so that tests can check how controllers cope with an
+// unreliable API server.
+package faults
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	core "k8s.io/client-go/testing"
+)
+
+// Fault describes the failures injected into the requests for a verb and
+// resource, either of which may be "*" to match any.
+type Fault struct {
+	Verb     string
+	Resource string
+
+	// ErrorRate is the fraction of requests that fail with an internal
+	// server error.
+	ErrorRate float64
+	// TimeoutRate is the fraction of requests that fail with a server
+	// timeout, which asks the client to retry after a second.
+	TimeoutRate float64
+	// ConflictRate is the fraction of updates and patches that fail with a
+	// conflict, as if the object had changed since it was read.
+	ConflictRate float64
+	// Latency delays every request.
+	Latency time.Duration
+}
+
+func (f Fault) matches(action core.Action) bool {
+	return (f.Verb == "*" || f.Verb == action.GetVerb()) &&
+		(f.Resource == "*" || f.Resource == action.GetResource().Resource)
+}
+
+// Injector fails the requests of fake clientsets it is installed in. It
+// starts disabled, so that tests can set up the cluster first, and can be
+// disabled again while the test acts on the cluster itself. The faults it
+// injects only depend on its seed and on the order of the requests.
+type Injector struct {
+	faults []Fault
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	enabled bool
+	// injected counts the failures injected, by verb.
+	injected map[string]int
+}
+
+// NewInjector returns a disabled Injector drawing the given faults from seed.
+func NewInjector(seed int64, faults ...Fault) *Injector {
+	return &Injector{
+		faults:   faults,
+		rand:     rand.New(rand.NewSource(seed)),
+		injected: map[string]int{},
+	}
+}
+
+// Install puts the injector in front of every other reactor of the fakes.
+func (f *Injector) Install(fakes ...*core.Fake) {
+	for _, fake := range fakes {
+		fake.PrependReactor("*", "*", f.react)
+	}
+}
+
+// SetEnabled starts or stops injecting faults.
+func (f *Injector) SetEnabled(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled = enabled
+}
+
+func (f *Injector) react(action core.Action) (bool, runtime.Object, error) {
+	f.mu.Lock()
+	if !f.enabled {
+		f.mu.Unlock()
+		return false, nil, nil
+	}
+	var latency time.Duration
+	var err error
+	gr := action.GetResource().GroupResource()
+	for _, fault := range f.faults {
+		if !fault.matches(action) {
+			continue
+		}
+		latency += fault.Latency
+		if err != nil {
+			continue
+		}
+		switch roll := f.rand.Float64(); {
+		case roll < fault.ErrorRate:
+			err = errors.NewInternalError(fmt.Errorf("injected fault"))
+		case roll < fault.ErrorRate+fault.TimeoutRate:
+			err = errors.NewServerTimeout(gr, action.GetVerb(), 1)
+		case roll < fault.ErrorRate+fault.TimeoutRate+fault.ConflictRate && (action.Matches("update", gr.Resource) || action.Matches("patch", gr.Resource)):
+			err = errors.NewConflict(gr, objectName(action), fmt.Errorf("injected fault"))
+		}
+	}
+	if err != nil {
+		f.injected[action.GetVerb()]++
+	}
+	f.mu.Unlock()
+
+	time.Sleep(latency)
+	return err != nil, nil, err
+}
+
+// Injected returns how many failures have been injected into the requests
+// for a verb.
+func (f *Injector) Injected(verb string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected[verb]
+}
+
+// Total returns how many failures have been injected.
+func (f *Injector) Total() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, count := range f.injected {
+		n += count
+	}
+	return n
+}
+
+// objectName returns the name of the object an action is for.
+func objectName(action core.Action) string {
+	switch action := action.(type) {
+	case core.UpdateAction:
+		if accessor, err := meta.Accessor(action.GetObject()); err == nil {
+			return accessor.GetName()
+		}
+	case core.PatchAction:
+		return action.GetName()
+	case core.DeleteAction:
+		return action.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package faults
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// failures returns which of n updates of a ConfigMap fail under an injector
+// with the given seed, and how.
+func failures(t *testing.T, seed int64, n int) ([]string, *Injector) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault}}
+	client := fake.NewSimpleClientset(cm)
+	injector := NewInjector(seed, Fault{Verb: "update", Resource: "configmaps", ErrorRate: 0.2, ConflictRate: 0.2})
+	injector.Install(&client.Fake)
+	injector.SetEnabled(true)
+
+	var got []string
+	for i := 0; i < n; i++ {
+		_, err := client.CoreV1().ConfigMaps(cm.Namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		switch {
+		case err == nil:
+			got = append(got, "ok")
+		case errors.IsConflict(err):
+			got = append(got, "conflict")
+		case errors.IsInternalError(err):
+			got = append(got, "error")
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return got, injector
+}
+
+func TestInjectorIsDeterministic(t *testing.T) {
+	first, injector := failures(t, 1, 50)
+	second, _ := failures(t, 1, 50)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("expected the same seed to inject the same faults, got %v and %v", first, second)
+	}
+	if injector.Total() == 0 || injector.Total() != injector.Injected("update") {
+		t.Errorf("expected faults to be injected into updates, got %d in total and %d into updates", injector.Total(), injector.Injected("update"))
+	}
+}
+
+func TestInjectorDisabled(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	injector := NewInjector(1, Fault{Verb: "*", Resource: "*", ErrorRate: 1})
+	injector.Install(&client.Fake)
+
+	if _, err := client.CoreV1().ConfigMaps(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{}); err != nil {
+		t.Errorf("expected a disabled injector not to fail requests, got %v", err)
+	}
+	injector.SetEnabled(true)
+	if _, err := client.CoreV1().ConfigMaps(metav1.NamespaceDefault).List(context.TODO(), metav1.ListOptions{}); !errors.IsInternalError(err) {
+		t.Errorf("expected an enabled injector to fail requests, got %v", err)
+	}
+}
@@ -17,11 +17,3 @@ limitations under the License.
 // Code generated by lister-gen. DO NOT EDIT.
 
 package v1alpha1
-
-// FooListerExpansion allows custom methods to be added to
-// FooLister.
-type FooListerExpansion interface{}
-
-// FooNamespaceListerExpansion allows custom methods to be added to
-// FooNamespaceLister.
-type FooNamespaceListerExpansion interface{}
@@ -0,0 +1,156 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	v1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// FooDeploymentNameIndex indexes Foos by namespace/spec.deploymentName,
+	// as Deployment names are only unique within a namespace.
+	FooDeploymentNameIndex = "deploymentName"
+	// FooLabelIndex indexes Foos by each of their labels, as key=value.
+	FooLabelIndex = "label"
+)
+
+// FooIndexers returns the indexers the lookups of FooNamespaceLister use.
+// Without them, the lookups list every Foo of the namespace instead.
+func FooIndexers() cache.Indexers {
+	return cache.Indexers{
+		FooDeploymentNameIndex: fooDeploymentNameIndexFunc,
+		FooLabelIndex:          fooLabelIndexFunc,
+	}
+}
+
+// AddFooIndexers adds those of FooIndexers that the informer does not have
+// yet. Like any indexer, they must be added before the informer is started.
+func AddFooIndexers(informer cache.SharedIndexInformer) error {
+	existing := informer.GetIndexer().GetIndexers()
+	missing := cache.Indexers{}
+	for name, indexFunc := range FooIndexers() {
+		if _, ok := existing[name]; !ok {
+			missing[name] = indexFunc
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return informer.AddIndexers(missing)
+}
+
+func fooDeploymentNameIndexFunc(obj interface{}) ([]string, error) {
+	foo, ok := obj.(*v1alpha1.Foo)
+	if !ok {
+		return nil, fmt.Errorf("expected a Foo, got %T", obj)
+	}
+	if foo.Spec.DeploymentName == "" {
+		return nil, nil
+	}
+	return []string{deploymentNameIndexValue(foo.Namespace, foo.Spec.DeploymentName)}, nil
+}
+
+func deploymentNameIndexValue(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func fooLabelIndexFunc(obj interface{}) ([]string, error) {
+	foo, ok := obj.(*v1alpha1.Foo)
+	if !ok {
+		return nil, fmt.Errorf("expected a Foo, got %T", obj)
+	}
+	values := make([]string, 0, len(foo.Labels))
+	for key, value := range foo.Labels {
+		values = append(values, labelIndexValue(key, value))
+	}
+	return values, nil
+}
+
+func labelIndexValue(key, value string) string {
+	return key + "=" + value
+}
+
+// FooListerExpansion allows custom methods to be added to
+// FooLister.
+type FooListerExpansion interface{}
+
+// FooNamespaceListerExpansion allows custom methods to be added to
+// FooNamespaceLister.
+type FooNamespaceListerExpansion interface {
+	// ByDeploymentName lists the Foos whose spec.deploymentName is name.
+	// Objects returned here must be treated as read-only.
+	ByDeploymentName(name string) ([]*v1alpha1.Foo, error)
+	// ByLabel lists the Foos labelled key=value.
+	// Objects returned here must be treated as read-only.
+	ByLabel(key, value string) ([]*v1alpha1.Foo, error)
+}
+
+// ByDeploymentName lists the Foos whose spec.deploymentName is name.
+func (s fooNamespaceLister) ByDeploymentName(name string) ([]*v1alpha1.Foo, error) {
+	matches := func(foo *v1alpha1.Foo) bool {
+		return foo.Spec.DeploymentName == name
+	}
+	if s.namespace == metav1.NamespaceAll {
+		// The index is keyed by namespace, so it cannot look up every
+		// namespace at once.
+		return s.list(matches)
+	}
+	return s.byIndex(FooDeploymentNameIndex, deploymentNameIndexValue(s.namespace, name), matches)
+}
+
+// ByLabel lists the Foos labelled key=value.
+func (s fooNamespaceLister) ByLabel(key, value string) ([]*v1alpha1.Foo, error) {
+	return s.byIndex(FooLabelIndex, labelIndexValue(key, value), func(foo *v1alpha1.Foo) bool {
+		v, ok := foo.Labels[key]
+		return ok && v == value
+	})
+}
+
+// byIndex lists the Foos of the namespace with the given value in the named
+// index. When the indexer does not have the index, it lists the Foos that
+// match instead.
+func (s fooNamespaceLister) byIndex(indexName, indexedValue string, matches func(*v1alpha1.Foo) bool) (ret []*v1alpha1.Foo, err error) {
+	if _, ok := s.indexer.GetIndexers()[indexName]; !ok {
+		return s.list(matches)
+	}
+	objs, err := s.indexer.ByIndex(indexName, indexedValue)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range objs {
+		if foo := m.(*v1alpha1.Foo); s.namespace == metav1.NamespaceAll || foo.Namespace == s.namespace {
+			ret = append(ret, foo)
+		}
+	}
+	return ret, nil
+}
+
+// list lists the Foos of the namespace that match.
+func (s fooNamespaceLister) list(matches func(*v1alpha1.Foo) bool) (ret []*v1alpha1.Foo, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, labels.Everything(), func(m interface{}) {
+		if foo := m.(*v1alpha1.Foo); matches(foo) {
+			ret = append(ret, foo)
+		}
+	})
+	return ret, err
+}
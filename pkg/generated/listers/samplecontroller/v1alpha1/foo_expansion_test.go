@@ -0,0 +1,124 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	v1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func newFoo(namespace, name, deploymentName string, labels map[string]string) *v1alpha1.Foo {
+	return &v1alpha1.Foo{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       v1alpha1.FooSpec{DeploymentName: deploymentName},
+	}
+}
+
+func names(foos []*v1alpha1.Foo) []string {
+	var names []string
+	for _, foo := range foos {
+		names = append(names, foo.Namespace+"/"+foo.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFooNamespaceListerLookups(t *testing.T) {
+	foos := []*v1alpha1.Foo{
+		newFoo("default", "a", "web", map[string]string{"tier": "frontend"}),
+		newFoo("default", "b", "web", nil),
+		newFoo("default", "c", "api", map[string]string{"tier": "backend"}),
+		newFoo("other", "a", "web", map[string]string{"tier": "frontend"}),
+		newFoo("other", "b", "api", nil),
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		lookup    func(FooNamespaceLister) ([]*v1alpha1.Foo, error)
+		expected  []string
+	}{
+		{
+			name:      "deployment name",
+			namespace: "default",
+			lookup:    func(l FooNamespaceLister) ([]*v1alpha1.Foo, error) { return l.ByDeploymentName("web") },
+			expected:  []string{"default/a", "default/b"},
+		},
+		{
+			name:      "deployment name in all namespaces",
+			namespace: metav1.NamespaceAll,
+			lookup:    func(l FooNamespaceLister) ([]*v1alpha1.Foo, error) { return l.ByDeploymentName("web") },
+			expected:  []string{"default/a", "default/b", "other/a"},
+		},
+		{
+			name:      "deployment name in another namespace",
+			namespace: "other",
+			lookup:    func(l FooNamespaceLister) ([]*v1alpha1.Foo, error) { return l.ByDeploymentName("api") },
+			expected:  []string{"other/b"},
+		},
+		{
+			name:      "label",
+			namespace: "default",
+			lookup:    func(l FooNamespaceLister) ([]*v1alpha1.Foo, error) { return l.ByLabel("tier", "frontend") },
+			expected:  []string{"default/a"},
+		},
+		{
+			name:      "no match",
+			namespace: "default",
+			lookup:    func(l FooNamespaceLister) ([]*v1alpha1.Foo, error) { return l.ByLabel("tier", "cache") },
+		},
+	}
+	for _, indexed := range []bool{true, false} {
+		indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+		if indexed {
+			for name, indexFunc := range FooIndexers() {
+				indexers[name] = indexFunc
+			}
+		}
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+		for _, foo := range foos {
+			if err := indexer.Add(foo); err != nil {
+				t.Fatalf("error adding foo: %v", err)
+			}
+		}
+		lister := NewFooLister(indexer)
+		for _, test := range tests {
+			foos, err := test.lookup(lister.Foos(test.namespace))
+			if err != nil {
+				t.Fatalf("%s (indexed %t): unexpected error: %v", test.name, indexed, err)
+			}
+			if got := names(foos); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("%s (indexed %t): expected %v, got %v", test.name, indexed, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestFooDeploymentNameIndexIsNamespaced(t *testing.T) {
+	keys, err := fooDeploymentNameIndexFunc(newFoo("default", "a", "web", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"default/web"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected index keys %v, got %v", expected, keys)
+	}
+}
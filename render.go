@@ -0,0 +1,414 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/controller"
+	samplescheme "k8s.io/sample-controller/pkg/generated/clientset/versioned/scheme"
+)
+
+// errDifferences is returned by the diff subcommand when the rendered and
+// live objects differ, so that it can exit non-zero like diff(1).
+var errDifferences = fmt.Errorf("rendered objects differ from live objects")
+
+// runOffline runs the render and diff subcommands, which work on manifests
+// alone and never contact a cluster. It returns the exit code.
+func runOffline(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var filename, live, output, namespace string
+	fs := flag.NewFlagSet("sample-controller "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&filename, "f", "", "File containing Foo manifests, or - for stdin. Objects of other kinds are ignored.")
+	fs.StringVar(&namespace, "namespace", metav1.NamespaceDefault, "Namespace for Foos that do not set one.")
+	if name == "render" {
+		fs.StringVar(&output, "o", "yaml", "Output format. One of: yaml, json.")
+	} else {
+		fs.StringVar(&live, "live", "", "File containing the live objects to compare with, for example the output of kubectl get -o yaml.")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	err := func() error {
+		if filename == "" {
+			return fmt.Errorf("-f is required")
+		}
+		foos, err := readFoos(filename, stdin)
+		if err != nil {
+			return err
+		}
+		rendered, err := renderFoos(foos, namespace, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if name == "render" {
+			return printRendered(stdout, output, rendered)
+		}
+		if live == "" {
+			return fmt.Errorf("--live is required")
+		}
+		liveObjs, err := readUnstructured(live, stdin)
+		if err != nil {
+			return err
+		}
+		return diffRendered(stdout, foos, rendered, liveObjs)
+	}()
+	switch {
+	case err == errDifferences:
+		return 1
+	case err != nil:
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// renderFoos renders the objects of each Foo in turn, putting Foos that do
+// not set a namespace in the given one.
+func renderFoos(foos []*samplev1alpha1.Foo, namespace string, now time.Time) ([]runtime.Object, error) {
+	var rendered []runtime.Object
+	for _, foo := range foos {
+		if foo.Namespace == "" {
+			foo.Namespace = namespace
+		}
+		objs, err := controller.RenderObjects(foo, now)
+		if err != nil {
+			return nil, fmt.Errorf("foo %s/%s: %v", foo.Namespace, foo.Name, err)
+		}
+		rendered = append(rendered, objs...)
+	}
+	return rendered, nil
+}
+
+// readFoos decodes the Foos in a file of YAML or JSON documents.
+func readFoos(filename string, stdin io.Reader) ([]*samplev1alpha1.Foo, error) {
+	docs, err := readDocuments(filename, stdin)
+	if err != nil {
+		return nil, err
+	}
+	decoder := samplescheme.Codecs.UniversalDeserializer()
+	var foos []*samplev1alpha1.Foo
+	for _, doc := range docs {
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		if foo, ok := obj.(*samplev1alpha1.Foo); ok {
+			foos = append(foos, foo)
+		}
+	}
+	if len(foos) == 0 {
+		return nil, fmt.Errorf("%s: no Foos found", filename)
+	}
+	return foos, nil
+}
+
+// readUnstructured decodes the objects in a file of YAML or JSON documents,
+// expanding lists into their items.
+func readUnstructured(filename string, stdin io.Reader) ([]map[string]interface{}, error) {
+	docs, err := readDocuments(filename, stdin)
+	if err != nil {
+		return nil, err
+	}
+	var objs []map[string]interface{}
+	for _, doc := range docs {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(doc, &obj); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		items, isList := obj["items"].([]interface{})
+		if !isList || !strings.HasSuffix(fmt.Sprint(obj["kind"]), "List") {
+			objs = append(objs, obj)
+			continue
+		}
+		for _, item := range items {
+			if item, ok := item.(map[string]interface{}); ok {
+				objs = append(objs, item)
+			}
+		}
+	}
+	return objs, nil
+}
+
+// readDocuments splits a file into its YAML or JSON documents, each converted
+// to JSON. Empty documents are dropped.
+func readDocuments(filename string, stdin io.Reader) ([][]byte, error) {
+	r := stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	var docs [][]byte
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		data, err := utilyaml.ToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		if s := strings.TrimSpace(string(data)); s == "" || s == "null" {
+			continue
+		}
+		docs = append(docs, data)
+	}
+}
+
+func printRendered(w io.Writer, output string, objs []runtime.Object) error {
+	var values []map[string]interface{}
+	for _, obj := range objs {
+		u, err := toRenderedMap(obj)
+		if err != nil {
+			return err
+		}
+		values = append(values, u)
+	}
+	switch output {
+	case "yaml":
+		for i, v := range values {
+			data, err := yaml.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Fprintln(w, "---")
+			}
+			w.Write(data)
+		}
+		return nil
+	case "json":
+		var v interface{} = values[0]
+		if len(values) > 1 {
+			v = map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": values}
+		}
+		data, err := json.MarshalIndent(v, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", data)
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, must be yaml or json", output)
+	}
+}
+
+// toRenderedMap converts an object to its unstructured form, leaving out the
+// status and the fields that are empty because nothing set them.
+func toRenderedMap(obj runtime.Object) (map[string]interface{}, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(u, "status")
+	return dropEmpty(u).(map[string]interface{}), nil
+}
+
+func dropEmpty(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if e = dropEmpty(e); isEmpty(e) {
+				delete(v, k)
+			} else {
+				v[k] = e
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = dropEmpty(v[i])
+		}
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// diffRendered writes a unified diff from the live objects to the rendered
+// ones. Live fields the controller does not set, such as those defaulted or
+// maintained by the API server, are ignored. Live objects controlled by one
+// of the Foos but no longer rendered show up as removed.
+func diffRendered(w io.Writer, foos []*samplev1alpha1.Foo, rendered []runtime.Object, live []map[string]interface{}) error {
+	liveByKey := map[string]map[string]interface{}{}
+	for _, obj := range live {
+		liveByKey[objectKey(obj)] = obj
+	}
+
+	type pair struct{ live, rendered interface{} }
+	pairs := map[string]pair{}
+	for _, obj := range rendered {
+		r, err := toRenderedMap(obj)
+		if err != nil {
+			return err
+		}
+		key := objectKey(r)
+		var l interface{}
+		if obj, ok := liveByKey[key]; ok {
+			l = prune(obj, r)
+		}
+		pairs[key] = pair{live: l, rendered: r}
+	}
+	for key, obj := range liveByKey {
+		if _, ok := pairs[key]; !ok && controlledByFoo(obj, foos) {
+			pairs[key] = pair{live: obj}
+		}
+	}
+
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	differ := false
+	for _, key := range keys {
+		p := pairs[key]
+		a, err := yamlLines(p.live)
+		if err != nil {
+			return err
+		}
+		b, err := yamlLines(p.rendered)
+		if err != nil {
+			return err
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        a,
+			B:        b,
+			FromFile: "live/" + key,
+			ToFile:   "rendered/" + key,
+			Context:  3,
+		})
+		if err != nil {
+			return err
+		}
+		if diff != "" {
+			differ = true
+			fmt.Fprint(w, diff)
+		}
+	}
+	if differ {
+		return errDifferences
+	}
+	return nil
+}
+
+// prune removes the fields of live that rendered does not set. Lists are
+// pruned element by element.
+func prune(live, rendered interface{}) interface{} {
+	switch r := rendered.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		pruned := map[string]interface{}{}
+		for k, rv := range r {
+			if lv, ok := l[k]; ok {
+				pruned[k] = prune(lv, rv)
+			}
+		}
+		return pruned
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		pruned := make([]interface{}, len(l))
+		for i := range l {
+			if i < len(r) {
+				pruned[i] = prune(l[i], r[i])
+			} else {
+				pruned[i] = l[i]
+			}
+		}
+		return pruned
+	default:
+		return live
+	}
+}
+
+func objectKey(obj map[string]interface{}) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%s/%s/%s", obj["kind"], metadata["namespace"], metadata["name"])
+}
+
+func controlledByFoo(obj map[string]interface{}, foos []*samplev1alpha1.Foo) bool {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	refs, _ := metadata["ownerReferences"].([]interface{})
+	for _, ref := range refs {
+		ref, _ := ref.(map[string]interface{})
+		if ref["kind"] != "Foo" || ref["controller"] != true {
+			continue
+		}
+		for _, foo := range foos {
+			if ref["name"] == foo.Name && metadata["namespace"] == foo.Namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func yamlLines(v interface{}) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return difflib.SplitLines(strings.TrimSuffix(string(data), "\n")), nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestRenderGolden")
+
+// goldenTime is when the Foos of the golden files are rendered, a Wednesday
+// afternoon in Europe.
+var goldenTime = time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+
+const renderManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+---
+apiVersion: samplecontroller.k8s.io/v1alpha1
+kind: Foo
+metadata:
+  name: example-foo
+spec:
+  deploymentName: example-foo
+  replicas: 2
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", path, err)
+	}
+	return path
+}
+
+func TestRenderCommand(t *testing.T) {
+	path := writeFile(t, "foo.yaml", renderManifest)
+	var out, errOut bytes.Buffer
+	if code := runOffline("render", []string{"-f", path}, nil, &out, &errOut); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, errOut.String())
+	}
+	for _, want := range []string{"kind: Deployment", "name: example-foo", "namespace: default", "replicas: 2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "status") || strings.Contains(out.String(), "creationTimestamp") {
+		t.Errorf("expected fields nothing sets to be left out, got:\n%s", out.String())
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	path := writeFile(t, "foo.yaml", renderManifest)
+	var rendered, errOut bytes.Buffer
+	if code := runOffline("render", []string{"-f", path}, nil, &rendered, &errOut); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, errOut.String())
+	}
+
+	// Fields set by the API server and other controllers are not differences.
+	live := strings.Replace(rendered.String(), "metadata:\n", "metadata:\n  resourceVersion: \"42\"\n  uid: 1234\n", 1) +
+		"status:\n  replicas: 2\n"
+	var out bytes.Buffer
+	if code := runOffline("diff", []string{"-f", path, "--live", writeFile(t, "live.yaml", live)}, nil, &out, &errOut); code != 0 {
+		t.Fatalf("expected no differences, got exit code %d: %s%s", code, out.String(), errOut.String())
+	}
+
+	live = strings.Replace(live, "replicas: 2\n  selector", "replicas: 5\n  selector", 1)
+	out.Reset()
+	if code := runOffline("diff", []string{"-f", path, "--live", writeFile(t, "live.yaml", live)}, nil, &out, &errOut); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, errOut.String())
+	}
+	for _, want := range []string{"-  replicas: 5", "+  replicas: 2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected diff to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestRenderGolden renders the Foos of each testdata/render/*.yaml file and
+// compares the objects with the .golden file next to it, so that changes to
+// the objects the controller creates show up in review. Run it with -update
+// to rewrite the golden files.
+func TestRenderGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "render", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no inputs found in testdata/render")
+	}
+	for _, input := range inputs {
+		input := input
+		golden := strings.TrimSuffix(input, ".yaml") + ".golden"
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			foos, err := readFoos(input, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rendered, err := renderFoos(foos, metav1.NamespaceDefault, goldenTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := printRendered(&got, "yaml", rendered); err != nil {
+				t.Fatal(err)
+			}
+
+			if *update {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatalf("error writing %s: %v", golden, err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("error reading %s, run with -update to create it: %v", golden, err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+					A:        difflib.SplitLines(string(want)),
+					B:        difflib.SplitLines(got.String()),
+					FromFile: golden,
+					ToFile:   "rendered",
+					Context:  3,
+				})
+				t.Errorf("rendered objects differ from %s, run with -update to accept them:\n%s", golden, diff)
+			}
+		})
+	}
+}